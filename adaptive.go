@@ -0,0 +1,62 @@
+package watcher
+
+import "time"
+
+// 设置自适应轮询：连续idle轮扫描都没有发送事件时把轮询间隔加倍，最多到max；
+// 一旦有事件就回到min，用户正在编辑的时候保持灵敏，空闲的时候少占CPU；
+// idle小于1时按1处理，max小于等于0时关闭自适应，保持当前的间隔；开启时当前间隔会被限制在min和max之间
+func (w *Watcher) SetAdaptivePolling(min, max time.Duration, idle int) error {
+	if max > 0 && min < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	if max < min {
+		max = min
+	}
+	if idle < 1 {
+		idle = 1
+	}
+	w.mu.Lock()
+	w.adaptiveMin = min
+	w.adaptiveMax = max
+	w.adaptiveIdle = idle
+	w.idleScans = 0
+	if max > 0 {
+		w.interval = clampInterval(w.interval, min, max)
+	}
+	w.mu.Unlock()
+	select {
+	case w.intervalChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func clampInterval(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// 根据这一轮有没有发送事件调整轮询间隔
+func (w *Watcher) adaptInterval(changed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.adaptiveMax <= 0 {
+		return
+	}
+	if changed {
+		w.idleScans = 0
+		w.interval = w.adaptiveMin
+		return
+	}
+	w.idleScans++
+	if w.idleScans >= w.adaptiveIdle {
+		w.idleScans = 0
+		w.interval = clampInterval(w.interval*2, w.adaptiveMin, w.adaptiveMax)
+	}
+}
@@ -0,0 +1,471 @@
+// agent 把watcher的事件转发到中心服务，用来在很多台机器上监控文件：
+// 每个事件带上主机名，以JSON行的格式POST到中心服务的HTTP接口，网络中断时先缓存在本地，恢复之后按顺序补发
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pythonsite/watcher"
+)
+
+const (
+	defaultInterval  = time.Second // 默认的轮询间隔
+	defaultFlush     = time.Second // 默认多久发送一批事件
+	defaultBatch     = 500         // 一批最多发送的事件数
+	defaultMemBuffer = 10000       // 内存里最多缓存的事件数
+	defaultSpoolSize = 64 << 20    // 缓存文件默认的大小上限
+	maxSpoolLine     = 1 << 20     // 缓存文件里一行的大小上限，更长的行被跳过
+)
+
+// 缓存文件里的行超过maxSpoolLine
+var errLineTooLong = errors.New("error: agent spool line too long")
+
+// Config 是agent的配置，可以从JSON文件读取，只有Endpoint和Paths是必须的
+type Config struct {
+	Endpoint  string   `json:"endpoint"`            // 中心服务接收事件的URL
+	Paths     []string `json:"paths"`               // 递归监控的路径
+	Ignore    []string `json:"ignore,omitempty"`    // 忽略的路径
+	Interval  string   `json:"interval,omitempty"`  // 轮询间隔，默认1s
+	Flush     string   `json:"flush,omitempty"`     // 多久发送一批事件，默认1s
+	Spool     string   `json:"spool,omitempty"`     // 网络中断时缓存事件的文件，为空时缓存在内存里，超过上限丢弃最早的
+	SpoolSize int64    `json:"spoolSize,omitempty"` // 缓存文件的大小上限(字节)，超过时丢弃最早的事件，默认64MB
+	Host      string   `json:"host,omitempty"`      // 事件上标记的主机名，默认os.Hostname()
+	SignKey   string   `json:"signKey,omitempty"`   // 不为空时每个事件带有HMAC签名，见watcher.MarshalEvent
+	AuthToken string   `json:"authToken,omitempty"` // 不为空时作为Bearer token发送
+	Expr      string   `json:"expr,omitempty"`      // 事件过滤表达式，只转发为true的事件，见watcher.CompileExpr
+}
+
+// 读取JSON格式的配置文件
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = json.Unmarshal(data, &cfg)
+	return cfg, err
+}
+
+// 解析配置里的时间，为空时返回def
+func duration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// 发送到中心服务的一行
+type message struct {
+	Host  string          `json:"host"`
+	Event json.RawMessage `json:"event"` // watcher.MarshalEvent的输出
+}
+
+// Agent 从一个Notifier读取事件并转发到中心服务
+type Agent struct {
+	endpoint string
+	host     string
+	key      []byte
+	token    string
+	spool    string
+	maxSpool int64
+	flush    time.Duration
+	client   *http.Client
+
+	flushMu sync.Mutex // 保证同一时间只有一个Flush在读写缓存文件
+
+	mu      sync.Mutex
+	pending [][]byte // 还没有发送成功的行，有缓存文件时只保存这一轮新来的
+	dropped uint64
+	onError func(error)
+}
+
+// 按照配置创建一个Agent
+func New(cfg Config) (*Agent, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("error: agent endpoint is required")
+	}
+	flush, err := duration(cfg.Flush, defaultFlush)
+	if err != nil {
+		return nil, err
+	}
+	host := cfg.Host
+	if host == "" {
+		if host, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	maxSpool := cfg.SpoolSize
+	if maxSpool <= 0 {
+		maxSpool = defaultSpoolSize
+	}
+	return &Agent{
+		endpoint: cfg.Endpoint,
+		host:     host,
+		key:      []byte(cfg.SignKey),
+		token:    cfg.AuthToken,
+		spool:    cfg.Spool,
+		maxSpool: maxSpool,
+		flush:    flush,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// 设置处理错误的函数，watcher的错误和转发失败都会交给它，不设置时错误会被丢弃
+func (a *Agent) HandleError(f func(error)) {
+	a.mu.Lock()
+	a.onError = f
+	a.mu.Unlock()
+}
+
+// 返回因为缓存满了而丢弃的事件数，包括缓存文件里超长被跳过的行
+func (a *Agent) Dropped() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.dropped
+}
+
+func (a *Agent) drop(n uint64) {
+	a.mu.Lock()
+	a.dropped += n
+	a.mu.Unlock()
+}
+
+func (a *Agent) handleError(err error) {
+	a.mu.Lock()
+	f := a.onError
+	a.mu.Unlock()
+	if f != nil {
+		f(err)
+	}
+}
+
+// Serve 从n读取事件并定期转发，直到done被关闭，关闭前会最后尝试发送一次
+// 对于watcher.Watcher可以把w.Closed作为done
+func (a *Agent) Serve(n watcher.Notifier, done <-chan struct{}) {
+	events, errs := n.Events(), n.Errors()
+	ticker := time.NewTicker(a.flush)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-events:
+			if err := a.add(e); err != nil {
+				a.handleError(err)
+			}
+		case err := <-errs:
+			a.handleError(err)
+		case <-ticker.C:
+			if err := a.Flush(); err != nil {
+				a.handleError(err)
+			}
+		case <-done:
+			if err := a.Flush(); err != nil {
+				a.handleError(err)
+			}
+			return
+		}
+	}
+}
+
+func (a *Agent) add(e watcher.Event) error {
+	data, err := watcher.MarshalEvent(e, a.key)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(message{Host: a.host, Event: data})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.pending = append(a.pending, line)
+	// 有缓存文件时写不进去的事件也留在内存里，同样需要上限
+	if len(a.pending) > defaultMemBuffer {
+		a.dropped += uint64(len(a.pending) - defaultMemBuffer)
+		a.pending = a.pending[len(a.pending)-defaultMemBuffer:]
+	}
+	a.mu.Unlock()
+	return nil
+}
+
+// Flush 立即发送缓存的事件，先补发缓存文件里的，再发送新的；发送失败的事件留到下一次
+func (a *Agent) Flush() error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	lines := a.pending
+	a.pending = nil
+	a.mu.Unlock()
+
+	if a.spool == "" {
+		sent, err := a.sendAll(lines)
+		if err != nil {
+			a.mu.Lock()
+			a.pending = append(lines[sent:], a.pending...)
+			a.mu.Unlock()
+		}
+		return err
+	}
+
+	// 有缓存文件时，新来的事件先追加到文件末尾，保证补发的顺序
+	if err := appendSpool(a.spool, lines); err != nil {
+		a.mu.Lock()
+		a.pending = append(lines, a.pending...)
+		if len(a.pending) > defaultMemBuffer {
+			a.dropped += uint64(len(a.pending) - defaultMemBuffer)
+			a.pending = a.pending[len(a.pending)-defaultMemBuffer:]
+		}
+		a.mu.Unlock()
+		return err
+	}
+	trimmed, err := trimSpool(a.spool, a.maxSpool)
+	a.drop(trimmed)
+	if err != nil {
+		return err
+	}
+	return a.sendSpool()
+}
+
+// 按批读取缓存文件并发送，全部发送成功时删除文件，否则用没有发送的部分替换它
+func (a *Agent) sendSpool() error {
+	f, err := os.Open(a.spool)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var sent int64 // 已经发送或者跳过的字节数
+	var batch [][]byte
+	var batchSize int64
+	var skipped uint64
+	commit := func() error {
+		if len(batch) > 0 {
+			if err := a.post(batch); err != nil {
+				return err
+			}
+		}
+		sent += batchSize
+		if skipped > 0 {
+			a.drop(skipped)
+			a.handleError(fmt.Errorf("error: skipped %d agent spool lines longer than %d bytes", skipped, maxSpoolLine))
+		}
+		batch, batchSize, skipped = nil, 0, 0
+		return nil
+	}
+	for {
+		line, n, rerr := readLine(r, maxSpoolLine)
+		batchSize += n
+		if rerr == errLineTooLong {
+			skipped++
+			continue
+		}
+		if rerr != nil && rerr != io.EOF {
+			f.Close()
+			return rerr
+		}
+		if len(line) > 0 {
+			batch = append(batch, line)
+		}
+		if rerr == io.EOF || len(batch) == defaultBatch {
+			if err = commit(); err != nil || rerr == io.EOF {
+				break
+			}
+		}
+	}
+	if err == nil {
+		f.Close()
+		return os.Remove(a.spool)
+	}
+	if sent > 0 {
+		if _, serr := f.Seek(sent, io.SeekStart); serr != nil {
+			f.Close()
+			return serr
+		}
+		if werr := replaceSpool(a.spool, f, f); werr != nil {
+			return werr
+		}
+		return err
+	}
+	f.Close()
+	return err
+}
+
+// 按批发送，返回发送成功的行数
+func (a *Agent) sendAll(lines [][]byte) (int, error) {
+	sent := 0
+	for sent < len(lines) {
+		end := sent + defaultBatch
+		if end > len(lines) {
+			end = len(lines)
+		}
+		if err := a.post(lines[sent:end]); err != nil {
+			return sent, err
+		}
+		sent = end
+	}
+	return sent, nil
+}
+
+func (a *Agent) post(lines [][]byte) error {
+	var body bytes.Buffer
+	for _, line := range lines {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequest(http.MethodPost, a.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("error: agent endpoint %s: %s", a.endpoint, resp.Status)
+	}
+	return nil
+}
+
+func appendSpool(path string, lines [][]byte) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err = f.Write(append(line, '\n')); err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 读取一行，返回不带换行符的内容和读取的字节数，超过max字节的行读完之后返回errLineTooLong
+func readLine(r *bufio.Reader, max int) ([]byte, int64, error) {
+	var line []byte
+	var n int64
+	long := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		n += int64(len(chunk))
+		if !long {
+			line = append(line, chunk...)
+			if len(bytes.TrimSuffix(line, []byte("\n"))) > max {
+				long, line = true, nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if long {
+			return nil, n, errLineTooLong
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), n, err
+	}
+}
+
+// 缓存文件超过limit字节时丢掉最早的行，返回丢掉的行数
+func trimSpool(path string, limit int64) (uint64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil || info.Size() <= limit {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	r := bufio.NewReader(f)
+	var skipped int64
+	var dropped uint64
+	for skipped < info.Size()-limit {
+		_, n, err := readLine(r, maxSpoolLine)
+		skipped += n
+		if n > 0 {
+			dropped++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != errLineTooLong {
+			f.Close()
+			return 0, err
+		}
+	}
+	return dropped, replaceSpool(path, r, f)
+}
+
+// 用r里剩下的内容替换缓存文件，src是r读取的缓存文件，在改名之前关闭
+func replaceSpool(path string, r io.Reader, src io.Closer) error {
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	src.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Run 按照配置创建watcher并开始转发，直到watcher被关闭或者出错
+func Run(cfg Config) error {
+	if len(cfg.Paths) == 0 {
+		return errors.New("error: agent has no paths to watch")
+	}
+	interval, err := duration(cfg.Interval, defaultInterval)
+	if err != nil {
+		return err
+	}
+	a, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	a.HandleError(func(err error) {
+		fmt.Fprintln(os.Stderr, "agent:", err)
+	})
+
+	w := watcher.New()
+	for _, path := range cfg.Paths {
+		if err := w.AddRecursive(path); err != nil {
+			return err
+		}
+	}
+	if err := w.Ignore(cfg.Ignore...); err != nil {
+		return err
+	}
+	if err := w.FilterExpr(cfg.Expr); err != nil {
+		return err
+	}
+	go a.Serve(w, w.Closed)
+	return w.Start(interval)
+}
@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pythonsite/watcher"
+)
+
+// 记录收到的行的中心服务，failing为true时返回503
+type endpoint struct {
+	mu      sync.Mutex
+	failing bool
+	lines   []string
+}
+
+func (e *endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(nil, 4*maxSpoolLine)
+	for scanner.Scan() {
+		e.lines = append(e.lines, scanner.Text())
+	}
+}
+
+func newTestAgent(t *testing.T, e *endpoint, spoolSize int64) *Agent {
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	a, err := New(Config{Endpoint: srv.URL, Host: "test", Spool: filepath.Join(t.TempDir(), "spool"), SpoolSize: spoolSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestSpoolDropsOldest(t *testing.T) {
+	e := &endpoint{failing: true}
+	a := newTestAgent(t, e, 0)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if err := a.add(watcher.Event{Op: watcher.Create, Path: path}); err != nil {
+			t.Fatal(err)
+		}
+		// 上限只够放一行
+		a.maxSpool = int64(len(a.pending[0]) + 1)
+		if err := a.Flush(); err == nil {
+			t.Fatal("flush succeeded against a failing endpoint")
+		}
+	}
+	if dropped := a.Dropped(); dropped != 2 {
+		t.Errorf("got %d dropped, want 2", dropped)
+	}
+
+	e.mu.Lock()
+	e.failing = false
+	e.mu.Unlock()
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.lines) != 1 || !strings.Contains(e.lines[0], `"/c"`) {
+		t.Errorf("got %q, want only /c", e.lines)
+	}
+	if _, err := os.Stat(a.spool); !os.IsNotExist(err) {
+		t.Errorf("spool not removed: %v", err)
+	}
+}
+
+func TestSpoolSkipsLongLines(t *testing.T) {
+	e := &endpoint{}
+	a := newTestAgent(t, e, 0)
+	long := strings.Repeat("x", maxSpoolLine+1)
+	if err := os.WriteFile(a.spool, []byte("first\n"+long+"\nlast\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var errs []error
+	a.HandleError(func(err error) { errs = append(errs, err) })
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(e.lines) != 2 || e.lines[0] != "first" || e.lines[1] != "last" {
+		t.Errorf("got %d lines, want first and last", len(e.lines))
+	}
+	if a.Dropped() != 1 || len(errs) != 1 {
+		t.Errorf("got %d dropped and errors %v, want 1 of each", a.Dropped(), errs)
+	}
+}
@@ -0,0 +1,30 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+)
+
+// 设置是否跟踪文件实际分配的块数(st_blocks)，开启后分配的空间变化时发送Allocated事件，
+// 文件大小不变也会发送，比如虚拟磁盘镜像和数据库打洞(punch hole)或者预分配空间的时候
+// Detail里的块数以512字节为单位，在不能获得块数的平台上(Windows)没有效果
+func (w *Watcher) TrackAllocation(enable bool) {
+	w.mu.Lock()
+	w.trackAlloc = enable
+	w.mu.Unlock()
+}
+
+// 分配的块数变化时返回Allocated事件，调用的时候需要持有w.mu
+func (w *Watcher) allocation(path string, oldInfo, info os.FileInfo) (Event, bool) {
+	if !w.trackAlloc || info.IsDir() {
+		return Event{}, false
+	}
+	oldBlocks, ok1 := fileBlocks(oldInfo)
+	blocks, ok2 := fileBlocks(info)
+	if !ok1 || !ok2 || oldBlocks == blocks {
+		return Event{}, false
+	}
+	detail := fmt.Sprintf("allocated blocks %d -> %d, size %d -> %d", oldBlocks, blocks, oldInfo.Size(), info.Size())
+	w.trace(path, Allocated, "detected: %s", detail)
+	return Event{Op: Allocated, Path: path, FileInfo: info, Detail: detail}, true
+}
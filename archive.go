@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 需要对比成员的压缩包扩展名
+var archiveExts = map[string]bool{
+	".zip": true,
+	".jar": true,
+	".war": true,
+}
+
+// 压缩包里一个成员的信息
+type archiveEntry struct {
+	info os.FileInfo
+	crc  uint32
+}
+
+// 设置是否对比压缩包(.zip/.jar/.war)的成员
+// 开启后压缩包发生Write的时候，会额外为每个变化的成员发送Create/Write/Remove事件，
+// 成员事件的Path格式为 "压缩包路径!/成员名"；设置了ScanAsUser时不能开启
+func (w *Watcher) DiffArchives(enable bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !enable {
+		w.archives = nil
+		return nil
+	}
+	if err := w.refuseContent("DiffArchives"); err != nil {
+		return err
+	}
+	if w.archives != nil {
+		return nil
+	}
+	w.archives = make(map[string]map[string]archiveEntry)
+	for path, info := range w.files {
+		w.loadArchive(path, info)
+	}
+	return nil
+}
+
+// 读取压缩包的成员列表，不是压缩包或者读取失败的时候返回nil
+func readArchive(path string, info os.FileInfo) map[string]archiveEntry {
+	if info.IsDir() || !archiveExts[strings.ToLower(filepath.Ext(path))] {
+		return nil
+	}
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+
+	entries := make(map[string]archiveEntry, len(r.File))
+	for _, f := range r.File {
+		entries[f.Name] = archiveEntry{info: f.FileInfo(), crc: f.CRC32}
+	}
+	return entries
+}
+
+// 记录压缩包当前的成员列表，调用的时候需要持有w.mu
+func (w *Watcher) loadArchive(path string, info os.FileInfo) {
+	if w.archives == nil {
+		return
+	}
+	if entries := readArchive(path, info); entries != nil {
+		w.archives[path] = entries
+	}
+}
+
+// 文件被重命名或者移动之后，把缓存的成员列表挪到新的路径下，调用的时候需要持有w.mu
+func (w *Watcher) moveArchive(oldPath, newPath string) {
+	if entries, found := w.archives[oldPath]; found {
+		delete(w.archives, oldPath)
+		w.archives[newPath] = entries
+	}
+}
+
+// 对比压缩包前后的成员列表，返回每个成员的事件，调用的时候需要持有w.mu
+func (w *Watcher) diffArchive(path string, info os.FileInfo) []Event {
+	if w.archives == nil {
+		return nil
+	}
+	entries := readArchive(path, info)
+	if entries == nil {
+		return nil
+	}
+	old := w.archives[path]
+	w.archives[path] = entries
+
+	var events []Event
+	for name, entry := range entries {
+		member := path + "!/" + name
+		oldEntry, found := old[name]
+		if !found {
+			events = append(events, Event{Op: Create, Path: member, FileInfo: entry.info})
+			continue
+		}
+		if oldEntry.crc != entry.crc || !oldEntry.info.ModTime().Equal(entry.info.ModTime()) {
+			events = append(events, Event{Op: Write, Path: member, FileInfo: entry.info})
+		}
+	}
+	for name, entry := range old {
+		if _, found := entries[name]; !found {
+			events = append(events, Event{Op: Remove, Path: path + "!/" + name, FileInfo: entry.info})
+		}
+	}
+	return events
+}
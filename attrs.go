@@ -0,0 +1,203 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Attr 是可以跟踪变化的文件属性，这些属性的变化不会修改文件的修改时间和权限位
+type Attr uint32
+
+const (
+	AttrACL        Attr = iota // POSIX ACL(Linux)
+	AttrFlags                  // chattr的immutable和append-only标志(Linux)
+	AttrSELinux                // SELinux安全上下文(Linux)
+	AttrStreams                // NTFS备用数据流，比如下载文件的Zone.Identifier(Windows)
+	AttrFinderTags             // Finder标签和颜色标签(macOS)
+	AttrQuarantine             // 下载文件的com.apple.quarantine隔离属性(macOS)
+)
+
+var attrNames = map[Attr]string{
+	AttrACL:        "acl",
+	AttrFlags:      "flags",
+	AttrSELinux:    "selinux",
+	AttrStreams:    "streams",
+	AttrFinderTags: "finder-tags",
+	AttrQuarantine: "quarantine",
+}
+
+func (a Attr) String() string {
+	if name, found := attrNames[a]; found {
+		return name
+	}
+	return "???"
+}
+
+// 当前平台不支持要跟踪的属性时，TrackAttrs返回这个错误
+var ErrAttrUnsupported = errors.New("error: attribute is not supported on this platform")
+
+// 每种属性在当前平台上的读取函数，由各平台的文件在init里注册
+// 返回属性的值，文件没有这个属性的时候返回空字符串
+var attrReaders = map[Attr]func(path string) (string, error){}
+
+// 设置需要跟踪的属性，属性变化时发送Attrib事件，Detail里说明是哪个属性，不传属性时停止跟踪
+// 每次轮询都会读取所有文件的这些属性，文件很多的时候会有额外的开销；设置了ScanAsUser时不能开启
+func (w *Watcher) TrackAttrs(attrs ...Attr) error {
+	for _, attr := range attrs {
+		if _, found := attrReaders[attr]; !found {
+			return fmt.Errorf("%w: %s", ErrAttrUnsupported, attr)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(attrs) > 0 {
+		if err := w.refuseContent("TrackAttrs"); err != nil {
+			return err
+		}
+	}
+	w.trackedAttrs = attrs
+	w.attrs = nil
+	if len(attrs) == 0 {
+		return nil
+	}
+	w.attrs = make(map[string]map[Attr]string)
+	for path, info := range w.files {
+		w.loadAttrs(path, info)
+	}
+	return nil
+}
+
+// 读取文件的所有被跟踪的属性，读取失败的属性会被跳过
+func (w *Watcher) readAttrs(path string) map[Attr]string {
+	values := make(map[Attr]string, len(w.trackedAttrs))
+	for _, attr := range w.trackedAttrs {
+		if value, err := attrReaders[attr](path); err == nil {
+			values[attr] = value
+		}
+	}
+	return values
+}
+
+// 记录文件当前的属性，调用的时候需要持有w.mu
+func (w *Watcher) loadAttrs(path string, info os.FileInfo) {
+	if w.attrs == nil {
+		return
+	}
+	w.attrs[path] = w.readAttrs(path)
+}
+
+// 对比文件的属性，为每个变化的属性返回一个Attrib事件，调用的时候需要持有w.mu
+func (w *Watcher) diffAttrs(path string, info os.FileInfo) []Event {
+	if w.attrs == nil {
+		return nil
+	}
+	values := w.readAttrs(path)
+	old, found := w.attrs[path]
+	w.attrs[path] = values
+	if !found {
+		return nil
+	}
+
+	var events []Event
+	for _, attr := range w.trackedAttrs {
+		oldValue, hadOld := old[attr]
+		value, hasNew := values[attr]
+		if !hadOld || !hasNew || oldValue == value {
+			continue
+		}
+		detail := describeAttr(attr, oldValue, value)
+		w.trace(path, Attrib, "detected: %s", detail)
+		events = append(events, Event{Op: Attrib, Path: path, FileInfo: info, Detail: detail})
+	}
+	return events
+}
+
+// 属性变化的说明
+func describeAttr(attr Attr, oldValue, value string) string {
+	switch attr {
+	case AttrFlags:
+		return describeFlags(oldValue, value)
+	case AttrSELinux:
+		// 安全上下文是可读的字符串，直接带上前后的值
+		return fmt.Sprintf("selinux context %q -> %q", oldValue, value)
+	case AttrStreams:
+		return describeStreams(oldValue, value)
+	case AttrQuarantine:
+		return fmt.Sprintf("quarantine %q -> %q", oldValue, value)
+	}
+	switch {
+	case oldValue == "":
+		return attr.String() + " added"
+	case value == "":
+		return attr.String() + " removed"
+	}
+	return attr.String() + " changed"
+}
+
+// 标志的变化说明，比如 "flags: immutable set, append-only cleared"
+func describeFlags(oldValue, value string) string {
+	split := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, flag := range strings.Split(s, ",") {
+			if flag != "" {
+				set[flag] = true
+			}
+		}
+		return set
+	}
+	oldFlags, flags := split(oldValue), split(value)
+	var changes []string
+	for _, flag := range strings.Split(value, ",") {
+		if flag != "" && !oldFlags[flag] {
+			changes = append(changes, flag+" set")
+		}
+	}
+	for _, flag := range strings.Split(oldValue, ",") {
+		if flag != "" && !flags[flag] {
+			changes = append(changes, flag+" cleared")
+		}
+	}
+	return "flags: " + strings.Join(changes, ", ")
+}
+
+// 备用数据流的变化说明，比如 "streams: Zone.Identifier added, notes changed"
+func describeStreams(oldValue, value string) string {
+	// 每行是"名字\t大小\t内容哈希"
+	split := func(s string) map[string]string {
+		streams := make(map[string]string)
+		for _, line := range strings.Split(s, "\n") {
+			if line == "" {
+				continue
+			}
+			parts := strings.SplitN(line, "\t", 2)
+			if len(parts) == 2 {
+				streams[parts[0]] = parts[1]
+			}
+		}
+		return streams
+	}
+	oldStreams, streams := split(oldValue), split(value)
+	var changes []string
+	for _, line := range strings.Split(value, "\n") {
+		name := strings.SplitN(line, "\t", 2)[0]
+		old, found := oldStreams[name]
+		switch {
+		case name == "":
+		case !found:
+			changes = append(changes, name+" added")
+		case old != streams[name]:
+			changes = append(changes, name+" changed")
+		}
+	}
+	for _, line := range strings.Split(oldValue, "\n") {
+		name := strings.SplitN(line, "\t", 2)[0]
+		if _, found := streams[name]; name != "" && !found {
+			changes = append(changes, name+" removed")
+		}
+	}
+	return "streams: " + strings.Join(changes, ", ")
+}
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	attrReaders[AttrFinderTags] = readFinderTags
+	attrReaders[AttrQuarantine] = readQuarantine
+}
+
+// getxattr的options，不跟随符号链接
+const xattrNoFollow = 0x0001
+
+// 读取扩展属性，属性不存在的时候返回空，syscall包在macOS上没有导出Getxattr
+func getxattr(path, name string) ([]byte, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		size, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), 0, 0, 0, xattrNoFollow)
+		if errno == syscall.ENOATTR || errno == syscall.ENOTSUP {
+			return nil, nil
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		got, _, errno := syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)), uintptr(unsafe.Pointer(&buf[0])), size, 0, xattrNoFollow)
+		if errno == syscall.ERANGE {
+			// 两次调用之间属性变大了，重新获取大小
+			continue
+		}
+		if errno == syscall.ENOATTR {
+			return nil, nil
+		}
+		if errno != 0 {
+			return nil, errno
+		}
+		return buf[:got], nil
+	}
+}
+
+// 读取Finder标签和FinderInfo(里面有旧式的颜色标签)，标签是二进制plist，只比较原始内容
+func readFinderTags(path string) (string, error) {
+	tags, err := getxattr(path, "com.apple.metadata:_kMDItemUserTags")
+	if err != nil {
+		return "", err
+	}
+	info, err := getxattr(path, "com.apple.FinderInfo")
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 && len(info) == 0 {
+		return "", nil
+	}
+	return string(tags) + "\x00" + string(info), nil
+}
+
+// 读取下载文件的隔离属性，格式是"标志;时间戳;下载程序;UUID"
+func readQuarantine(path string) (string, error) {
+	value, err := getxattr(path, "com.apple.quarantine")
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
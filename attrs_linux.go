@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	attrReaders[AttrACL] = readACL
+	attrReaders[AttrFlags] = readFlags
+	attrReaders[AttrSELinux] = readSELinux
+}
+
+const (
+	// _IOR('f', 1, long)
+	fsIocGetflags = 2<<30 | unsafe.Sizeof(uintptr(0))<<16 | 'f'<<8 | 1
+
+	fsImmutableFl = 0x00000010
+	fsAppendFl    = 0x00000020
+)
+
+// 读取扩展属性，属性不存在的时候返回空
+func getxattr(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err == syscall.ENODATA || err == syscall.ENOTSUP {
+			return nil, nil
+		}
+		if err != nil || size == 0 {
+			return nil, err
+		}
+		buf := make([]byte, size)
+		n, err := syscall.Getxattr(path, name, buf)
+		if err == syscall.ERANGE {
+			// 两次调用之间属性变大了，重新获取大小
+			continue
+		}
+		if err == syscall.ENODATA {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
+
+// 读取访问ACL和目录的默认ACL
+func readACL(path string) (string, error) {
+	access, err := getxattr(path, "system.posix_acl_access")
+	if err != nil {
+		return "", err
+	}
+	def, err := getxattr(path, "system.posix_acl_default")
+	if err != nil {
+		return "", err
+	}
+	if len(access) == 0 && len(def) == 0 {
+		return "", nil
+	}
+	return string(access) + "\x00" + string(def), nil
+}
+
+// 通过FS_IOC_GETFLAGS读取chattr的immutable和append-only标志
+func readFlags(path string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	// 只读取普通文件和目录，打开设备文件可能会有副作用
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return "", nil
+	}
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_NOFOLLOW|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer syscall.Close(fd)
+
+	var flags int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), fsIocGetflags, uintptr(unsafe.Pointer(&flags)))
+	if errno == syscall.ENOTTY || errno == syscall.ENOTSUP || errno == syscall.EINVAL {
+		// 文件系统不支持这些标志
+		return "", nil
+	}
+	if errno != 0 {
+		return "", errno
+	}
+
+	var names []string
+	if flags&fsImmutableFl != 0 {
+		names = append(names, "immutable")
+	}
+	if flags&fsAppendFl != 0 {
+		names = append(names, "append-only")
+	}
+	return strings.Join(names, ","), nil
+}
+
+// 读取SELinux安全上下文，没有开启SELinux的系统上返回空
+func readSELinux(path string) (string, error) {
+	label, err := getxattr(path, "security.selinux")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(label), "\x00"), nil
+}
@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+func init() {
+	attrReaders[AttrStreams] = readStreams
+}
+
+var (
+	modkernel32          = syscall.NewLazyDLL("kernel32.dll")
+	procFindFirstStreamW = modkernel32.NewProc("FindFirstStreamW")
+	procFindNextStreamW  = modkernel32.NewProc("FindNextStreamW")
+)
+
+const errHandleEOF syscall.Errno = 38
+
+// 读取流内容计算哈希时最多读取的字节数
+const streamHashLimit = 1 << 20
+
+// WIN32_FIND_STREAM_DATA
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// 列出文件的备用数据流，每个流一行"名字\t大小\t内容哈希"，按名字排序，没有备用数据流时返回空
+func readStreams(path string) (string, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	var data win32FindStreamData
+	h, _, e := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		if e == errHandleEOF {
+			return "", nil
+		}
+		return "", e
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+
+	var lines []string
+	for {
+		// 流的名字是":Zone.Identifier:$DATA"这样的格式，主数据流是"::$DATA"
+		name := strings.TrimSuffix(syscall.UTF16ToString(data.StreamName[:]), ":$DATA")
+		if name != ":" {
+			name = strings.TrimPrefix(name, ":")
+			lines = append(lines, name+"\t"+strconv.FormatInt(data.StreamSize, 10)+"\t"+hashStream(path+":"+name))
+		}
+		r, _, e := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			if e == errHandleEOF {
+				break
+			}
+			return "", e
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+// 计算流内容的哈希，读取失败的时候返回空
+func hashStream(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, streamHashLimit); err != nil && err != io.EOF {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// AutoAdd 注册一个路径模式(filepath.Match的语法，比如/data/customers/*/inbox)，
+// 之后每一轮扫描出现新的匹配路径时自动把它添加为root，并发送一个RootAdded事件，
+// 新root里已有的文件会在同一轮里以Create事件发送；recursive表示按AddRecursive还是Add添加
+// 只有匹配到的目录会被添加，匹配到的文件被跳过；注册时已经存在的匹配路径直接添加，不发送事件
+func (w *Watcher) AutoAdd(pattern string, recursive bool) error {
+	pattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return err
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range matches {
+		if info, err := os.Stat(name); err != nil || !info.IsDir() {
+			continue
+		}
+		if recursive {
+			err = w.AddRecursive(name)
+		} else {
+			err = w.Add(name)
+		}
+		if err != nil && !errors.Is(err, ErrRootOverlap) {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	if w.globs == nil {
+		w.globs = make(map[string]bool)
+	}
+	w.globs[pattern] = recursive
+	w.mu.Unlock()
+	return nil
+}
+
+// 把新出现的匹配路径注册为root，RootAdded事件留给detectEvents发送，调用的时候需要持有w.mu
+// 这里只注册不列出文件，这样新root里的文件在这一轮扫描里都是新出现的
+func (w *Watcher) expandGlobs() {
+	for pattern, recursive := range w.globs {
+		matches, _ := filepath.Glob(pattern)
+		for _, name := range matches {
+			if _, found := w.names[name]; found {
+				continue
+			}
+			if w.ignoredPath(name) || (w.ignoreHidden && hiddenPath(name)) {
+				continue
+			}
+			info, err := os.Stat(name)
+			if err != nil || !info.IsDir() {
+				continue
+			}
+			if register, _ := w.checkOverlap(name, recursive); !register {
+				continue
+			}
+			w.names[name] = recursive
+			w.setRootStatus(name, recursive, nil)
+			w.trace(name, RootAdded, "detected: matches %s", pattern)
+			w.rootEvents = append(w.rootEvents, Event{Op: RootAdded, Path: name, FileInfo: info, Detail: "matches " + pattern})
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+)
+
+// Backend 是Watcher发现文件系统变化的方式
+type Backend uint32
+
+const (
+	// 每隔Start的间隔重新扫描所有root，适用于所有文件系统，默认的方式
+	Polling Backend = iota
+	// 使用系统的变化通知(Linux上是inotify)，收到通知之后马上扫描，Start的间隔只作为兜底的轮询间隔；
+	// 网络文件系统上的目录以及watch描述符用完之后没有监控上的目录收不到通知，靠兜底的轮询发现变化
+	Native
+)
+
+var backends = map[Backend]string{
+	Polling: "POLLING",
+	Native:  "NATIVE",
+}
+
+func (b Backend) String() string {
+	if name, found := backends[b]; found {
+		return name
+	}
+	return "???"
+}
+
+// 当前平台不支持原生通知时，SetBackend返回这个错误
+var ErrNativeUnsupported = errors.New("error: native notification is not supported on this platform")
+
+// watch描述符用完了，剩下的目录退回到轮询，用完之后只报告一次，直到又能添加watch为止
+var ErrWatchLimit = errors.New("error: out of native watch descriptors, falling back to polling")
+
+// notifyBackend 是原生通知的实现，只负责告诉watcher"有变化了"，事件仍然由扫描对比得出，
+// 所以事件的内容和轮询时完全一样，各种过滤和检测也都照常工作
+type notifyBackend interface {
+	watch(path string) error   // 开始监控一个目录或者文件
+	unwatch(path string)       // 停止监控
+	watching(path string) bool // 是否正在监控
+	paths() []string           // 正在监控的路径
+	wake() <-chan struct{}     // 有变化时可读
+	close()
+}
+
+// 设置发现变化的方式，默认是Polling；设置Native时在下一次Start的时候生效，
+// 当前平台不支持时返回ErrNativeUnsupported，仍然使用轮询；Step和Scan总是直接扫描，不受影响
+func (w *Watcher) SetBackend(b Backend) error {
+	if b == Native && !nativeSupported {
+		return ErrNativeUnsupported
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.backend = b
+	if b != Native {
+		w.closeNative()
+	}
+	return nil
+}
+
+// 按照设置打开原生通知，返回有变化时可读的channel，轮询时返回nil，调用的时候需要持有w.mu
+func (w *Watcher) openNative() (<-chan struct{}, error) {
+	if w.backend != Native {
+		return nil, nil
+	}
+	if w.native == nil {
+		native, err := newNotifyBackend()
+		if err != nil {
+			return nil, err
+		}
+		w.native = native
+	}
+	return w.native.wake(), nil
+}
+
+// 关闭原生通知，调用的时候需要持有w.mu
+func (w *Watcher) closeNative() {
+	if w.native == nil {
+		return
+	}
+	w.native.close()
+	w.native = nil
+	w.watchExhausted = false
+	w.statsMu.Lock()
+	w.stats.Watches = 0
+	w.statsMu.Unlock()
+}
+
+// 让原生通知监控的路径和这一轮扫描到的目录(以及作为root的文件)一致，
+// watch描述符用完时第一次返回包装了ErrWatchLimit的WatchError，调用的时候需要持有w.mu
+func (w *Watcher) syncWatches(files map[string]os.FileInfo) error {
+	if w.native == nil {
+		return nil
+	}
+	want := make(map[string]bool)
+	for path, info := range files {
+		if _, root := w.names[path]; root || info.IsDir() {
+			want[path] = true
+		}
+	}
+	for _, path := range w.native.paths() {
+		if !want[path] {
+			w.native.unwatch(path)
+		}
+	}
+
+	var err error
+	exhausted, limited := false, ""
+	for path := range want {
+		if w.native.watching(path) || remoteFS(path) {
+			continue
+		}
+		if werr := w.native.watch(path); werr != nil {
+			if isWatchLimit(werr) {
+				exhausted, limited = true, path
+				break
+			}
+			// 目录在扫描之后被删除之类的错误，下一轮扫描会处理
+			w.trace(path, Create, "not watched natively: %v", werr)
+		}
+	}
+	if exhausted && !w.watchExhausted {
+		root, _ := w.rootOf(limited)
+		err = &WatchError{Op: "watch", Path: limited, Root: root, Err: ErrWatchLimit, Class: ClassOther, Recursive: w.names[root]}
+	}
+	w.watchExhausted = exhausted
+
+	w.statsMu.Lock()
+	w.stats.Watches = len(w.native.paths())
+	w.statsMu.Unlock()
+	return err
+}
@@ -0,0 +1,155 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const nativeSupported = true
+
+// 需要通知的inotify事件
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// 基于inotify的原生通知
+type inotifyBackend struct {
+	f      *os.File
+	fd     int // 不能用f.Fd()，它会把描述符改回阻塞模式
+	mu     sync.Mutex
+	closed bool
+	wds    map[string]int
+	byWd   map[int]string
+	notify chan struct{}
+}
+
+func newNotifyBackend() (notifyBackend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	b := &inotifyBackend{
+		// 非阻塞的描述符交给os.File之后由runtime的poller等待，close的时候read会返回
+		f:      os.NewFile(uintptr(fd), "inotify"),
+		fd:     fd,
+		wds:    make(map[string]int),
+		byWd:   make(map[int]string),
+		notify: make(chan struct{}, 1),
+	}
+	go b.read()
+	return b, nil
+}
+
+func (b *inotifyBackend) watch(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return os.ErrClosed
+	}
+	wd, err := syscall.InotifyAddWatch(b.fd, path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	b.wds[path] = wd
+	b.byWd[wd] = path
+	return nil
+}
+
+func (b *inotifyBackend) unwatch(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wd, found := b.wds[path]
+	if !found || b.closed {
+		return
+	}
+	// 目录已经被删除时内核已经移除了watch，这里的错误可以忽略
+	syscall.InotifyRmWatch(b.fd, uint32(wd))
+	delete(b.wds, path)
+	delete(b.byWd, wd)
+}
+
+func (b *inotifyBackend) watching(path string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, found := b.wds[path]
+	return found
+}
+
+func (b *inotifyBackend) paths() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	paths := make([]string, 0, len(b.wds))
+	for path := range b.wds {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func (b *inotifyBackend) wake() <-chan struct{} {
+	return b.notify
+}
+
+func (b *inotifyBackend) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.wds = make(map[string]int)
+	b.byWd = make(map[int]string)
+	b.f.Close()
+}
+
+// 读取inotify事件，有事件时通知watcher扫描；内核移除的watch(IN_IGNORED)从记录里删掉，下一轮扫描会重新添加
+func (b *inotifyBackend) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := b.f.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				b.mu.Lock()
+				if path, found := b.byWd[int(event.Wd)]; found {
+					delete(b.wds, path)
+					delete(b.byWd, int(event.Wd))
+				}
+				b.mu.Unlock()
+			}
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+		}
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func isWatchLimit(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.ENOSPC
+}
+
+// 网络文件系统和FUSE的magic number，这些文件系统上inotify收不到其他机器上的修改
+var remoteMagics = map[uint32]bool{
+	0x6969:     true, // NFS
+	0x517b:     true, // SMB
+	0xff534d42: true, // CIFS
+	0xfe534d42: true, // SMB2
+	0x65735546: true, // FUSE
+	0x01021997: true, // 9P
+	0x00c36400: true, // Ceph
+	0x5346414f: true, // AFS
+}
+
+// path是否在网络文件系统上
+func remoteFS(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return remoteMagics[uint32(st.Type)]
+}
@@ -0,0 +1,49 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNativeWakesOnWrite(t *testing.T) {
+	root := t.TempDir()
+	w := New()
+	if err := w.SetBackend(Native); err != nil {
+		t.Fatal(err)
+	}
+	w.FilterOps(Create)
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	// 兜底轮询的间隔远远长于测试，事件只能来自inotify的通知
+	go w.Start(time.Hour)
+	defer w.Close()
+
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		w.mu.Lock()
+		watching := w.native != nil && w.native.watching(root)
+		w.mu.Unlock()
+		if watching {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("root is not watched natively")
+		}
+	}
+	path := filepath.Join(root, "a")
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-w.Event:
+		if e.Op != Create || e.Path != path {
+			t.Fatalf("got %v, want CREATE %s", e, path)
+		}
+	case err := <-w.Error:
+		t.Fatal(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event before the fallback poll")
+	}
+}
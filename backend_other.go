@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+const nativeSupported = false
+
+func newNotifyBackend() (notifyBackend, error) {
+	return nil, ErrNativeUnsupported
+}
+
+func isWatchLimit(err error) bool {
+	return false
+}
+
+func remoteFS(path string) bool {
+	return false
+}
@@ -0,0 +1,95 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 窗口里的一次变化
+type burstEntry struct {
+	t      time.Time
+	path   string
+	newExt string // 改成了新扩展名的重命名，记录新的扩展名
+}
+
+// 设置突发变化检测：window时间内的Create、Write、Rename、Move事件达到threshold个时，
+// 发送一个Anomaly事件汇总这次突发(数量、改成新扩展名的重命名、涉及的目录)，
+// 用来发现勒索软件那样的批量改写；Anomaly不经过FilterOps、FilterExpr等过滤；同一次突发在window时间内只报告一次，threshold小于等于0时关闭
+func (w *Watcher) DetectBursts(threshold int, window time.Duration) {
+	w.mu.Lock()
+	w.burstThreshold = threshold
+	w.burstWindow = window
+	w.burstEntries = nil
+	w.mu.Unlock()
+}
+
+// 返回扩展名变化了的重命名的新扩展名
+func renamedExt(e Event) string {
+	if e.Op != Rename && e.Op != Move {
+		return ""
+	}
+	paths := eventPaths(e)
+	if len(paths) != 2 {
+		return ""
+	}
+	oldExt, newExt := filepath.Ext(paths[0]), filepath.Ext(paths[1])
+	if newExt == "" || strings.EqualFold(oldExt, newExt) {
+		return ""
+	}
+	return strings.ToLower(newExt)
+}
+
+// 记录这一轮的变化，超过阈值的时候返回Anomaly事件
+func (w *Watcher) detectBurst(events []Event) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.burstThreshold <= 0 {
+		return nil
+	}
+	now := w.clock.Now()
+	for _, e := range events {
+		switch e.Op {
+		case Create, Write, Rename, Move:
+			paths := eventPaths(e)
+			w.burstEntries = append(w.burstEntries, burstEntry{t: now, path: paths[len(paths)-1], newExt: renamedExt(e)})
+		}
+	}
+	i := 0
+	for i < len(w.burstEntries) && now.Sub(w.burstEntries[i].t) > w.burstWindow {
+		i++
+	}
+	w.burstEntries = w.burstEntries[i:]
+
+	if len(w.burstEntries) < w.burstThreshold || now.Sub(w.lastBurst) < w.burstWindow {
+		return nil
+	}
+	w.lastBurst = now
+
+	exts := make(map[string]int)
+	renames := 0
+	common := filepath.Dir(w.burstEntries[0].path)
+	for _, entry := range w.burstEntries {
+		if entry.newExt != "" {
+			exts[entry.newExt]++
+			renames++
+		}
+		for !underPath(entry.path, common) && filepath.Dir(common) != common {
+			common = filepath.Dir(common)
+		}
+	}
+	detail := fmt.Sprintf("%d changes within %s under %s", len(w.burstEntries), w.burstWindow, common)
+	if renames > 0 {
+		var top []string
+		for ext, n := range exts {
+			top = append(top, fmt.Sprintf("%s x%d", ext, n))
+		}
+		sort.Strings(top)
+		detail += fmt.Sprintf(", %d renamed to new extensions (%s)", renames, strings.Join(top, ", "))
+	}
+	w.trace(common, Anomaly, "detected: %s", detail)
+	return []Event{{Op: Anomaly, Path: common, FileInfo: &fileInfo{name: filepath.Base(common), modTime: now, dir: true}, Detail: detail}}
+}
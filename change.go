@@ -0,0 +1,83 @@
+package watcher
+
+import "os"
+
+// ChangeKind 是Write事件的变化类型
+type ChangeKind uint32
+
+const (
+	ChangeUnknown  ChangeKind = iota // 没有开启ClassifyChanges，或者大小没变又没有比较哈希，无法确定
+	ContentChanged                   // 文件内容变了
+	MetadataOnly                     // 只有修改时间等元数据变了，内容和之前一样(比如touch)
+)
+
+var changeKinds = map[ChangeKind]string{
+	ChangeUnknown:  "UNKNOWN",
+	ContentChanged: "CONTENT_CHANGED",
+	MetadataOnly:   "METADATA_ONLY",
+}
+
+func (k ChangeKind) String() string {
+	if kind, found := changeKinds[k]; found {
+		return kind
+	}
+	return "???"
+}
+
+// 设置是否给Write事件分类，结果放在Event.Change里：大小变了的是ContentChanged；
+// hash为true时大小没变的文件再比较SHA-256，内容相同的是MetadataOnly，同步工具可以跳过这种没有意义的复制
+// 开启hash时会马上计算所有被跟踪的普通文件的哈希，之后每次Write都要读一遍文件；设置了ScanAsUser时不能开启hash
+func (w *Watcher) ClassifyChanges(enable, hash bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if enable && hash {
+		if err := w.refuseContent("ClassifyChanges hash"); err != nil {
+			return err
+		}
+	}
+	w.classify = enable
+	w.classifyHash = enable && hash
+	w.hashes = nil
+	if !w.classifyHash {
+		return nil
+	}
+	w.hashes = make(map[string]string)
+	for path, info := range w.files {
+		w.loadHash(path, info)
+	}
+	return nil
+}
+
+// 记录文件的哈希，调用的时候需要持有w.mu
+func (w *Watcher) loadHash(path string, info os.FileInfo) {
+	if w.hashes == nil || !info.Mode().IsRegular() {
+		return
+	}
+	if sum, err := hashFile(path); err == nil {
+		w.hashes[path] = sum
+	}
+}
+
+// 判断一个Write事件的变化类型，调用的时候需要持有w.mu
+func (w *Watcher) classifyChange(path string, oldInfo, info os.FileInfo) ChangeKind {
+	if !w.classify || info.IsDir() {
+		return ChangeUnknown
+	}
+	old, found := w.hashes[path]
+	if w.hashes != nil {
+		delete(w.hashes, path)
+		w.loadHash(path, info)
+	}
+	if oldInfo.Size() != info.Size() {
+		return ContentChanged
+	}
+	sum, ok := w.hashes[path]
+	if !found || !ok {
+		return ChangeUnknown
+	}
+	if sum == old {
+		return MetadataOnly
+	}
+	return ContentChanged
+}
@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+)
+
+// ChangeDetection 是判断文件内容有没有变化的方式
+type ChangeDetection uint32
+
+const (
+	// 比较修改时间，默认的方式；保留时间戳的工具做的修改发现不了，touch也会被当成修改
+	ModTime ChangeDetection = iota
+	// 比较文件内容的哈希，只有内容真的变了才发送Write；每一轮扫描都要完整读取每个普通文件，
+	// 超过大小上限的文件仍然比较修改时间，见SetHashOptions
+	Hash
+)
+
+var changeDetections = map[ChangeDetection]string{
+	ModTime: "MODTIME",
+	Hash:    "HASH",
+}
+
+func (d ChangeDetection) String() string {
+	if name, found := changeDetections[d]; found {
+		return name
+	}
+	return "???"
+}
+
+// Hash模式默认只对不超过64MB的文件计算哈希
+const defaultHashLimit = 64 << 20
+
+// 设置判断文件内容变化的方式，切换到Hash时会马上计算所有被跟踪的普通文件的哈希；设置了ScanAsUser时不能切换到Hash
+func (w *Watcher) SetChangeDetection(mode ChangeDetection) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if mode == Hash {
+		if err := w.refuseContent("Hash change detection"); err != nil {
+			return err
+		}
+	}
+	w.sums = nil
+	if mode != Hash {
+		return nil
+	}
+	w.sums = make(map[string]string)
+	for path, info := range w.files {
+		w.loadSum(path, info)
+	}
+	return nil
+}
+
+// 设置Hash模式使用的哈希算法和文件大小上限，newHash为nil时使用SHA-256，
+// maxSize小于等于0时使用默认的64MB；已经计算过的哈希会按新的设置重新计算
+func (w *Watcher) SetHashOptions(newHash func() hash.Hash, maxSize int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.newHash = newHash
+	w.hashLimit = maxSize
+	if w.sums == nil {
+		return
+	}
+	w.sums = make(map[string]string)
+	for path, info := range w.files {
+		w.loadSum(path, info)
+	}
+}
+
+// 文件是否需要比较哈希，调用的时候需要持有w.mu
+func (w *Watcher) hashed(info os.FileInfo) bool {
+	if w.sums == nil || !info.Mode().IsRegular() {
+		return false
+	}
+	limit := w.hashLimit
+	if limit <= 0 {
+		limit = defaultHashLimit
+	}
+	return info.Size() <= limit
+}
+
+// 记录文件内容的哈希，调用的时候需要持有w.mu
+func (w *Watcher) loadSum(path string, info os.FileInfo) {
+	if !w.hashed(info) {
+		return
+	}
+	if sum, err := w.sumFile(path); err == nil {
+		w.sums[path] = sum
+	}
+}
+
+// 用设置的算法计算文件内容的哈希
+func (w *Watcher) sumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var h hash.Hash
+	if w.newHash != nil {
+		h = w.newHash()
+	} else {
+		h = sha256.New()
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return string(h.Sum(nil)), nil
+}
+
+// Hash模式下比较文件内容，found为false时表示这个文件不比较哈希，调用的时候需要持有w.mu
+func (w *Watcher) hashChanged(path string, oldInfo, info os.FileInfo) (changed bool, reason string, found bool) {
+	if !w.hashed(info) {
+		return false, "", false
+	}
+	old, hadSum := w.sums[path]
+	delete(w.sums, path)
+	sum, err := w.sumFile(path)
+	if err != nil {
+		modified := oldInfo.ModTime() != info.ModTime()
+		return modified, modtimeReason(modified, " (hash failed: "+err.Error()+")"), true
+	}
+	w.sums[path] = sum
+	switch {
+	case !hadSum:
+		modified := oldInfo.ModTime() != info.ModTime()
+		return modified, modtimeReason(modified, " (no previous hash)"), true
+	case old != sum:
+		return true, "content hash changed", true
+	case oldInfo.ModTime() != info.ModTime():
+		return false, "modtime changed but content hash unchanged", true
+	}
+	return false, "", true
+}
@@ -0,0 +1,41 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 目录oldDir被重命名或者移动到newDir之后，把它下面的文件直接挪到新路径下，
+// 为每个文件返回一个ChildMoved事件代替Remove和Create，订阅者可以据此迁移按路径保存的状态
+// 新路径下找不到对应文件的(比如移动的同时被删除了)留给后面按Remove和Create处理，调用的时候需要持有w.mu
+func (w *Watcher) moveChildren(oldDir, newDir string, removes, creates map[string]os.FileInfo) []Event {
+	var events []Event
+	for path, info := range removes {
+		if !underPath(path, oldDir) || path == oldDir {
+			continue
+		}
+		rel, err := filepath.Rel(oldDir, path)
+		if err != nil {
+			continue
+		}
+		newPath := filepath.Join(newDir, rel)
+		newInfo, found := creates[newPath]
+		if !found || !sameFile(info, newInfo) {
+			continue
+		}
+		delete(removes, path)
+		delete(creates, newPath)
+		w.moveTracked(path, newPath)
+		w.trace(newPath, ChildMoved, "detected: parent moved from %s", oldDir)
+		events = append(events, Event{
+			Op:       ChildMoved,
+			Path:     fmt.Sprintf("%s -> %s", path, newPath),
+			FileInfo: info,
+			OldPath:  path,
+			NewPath:  newPath,
+			OldInfo:  info,
+		})
+	}
+	return events
+}
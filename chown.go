@@ -0,0 +1,19 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+)
+
+// 属主或属组变化时返回Chown事件，Detail里说明uid和gid的变化，调用的时候需要持有w.mu
+// 在FileInfo里没有uid和gid的平台上(Windows)不会发送
+func (w *Watcher) ownerChanged(path string, oldInfo, info os.FileInfo) (Event, bool) {
+	oldUID, oldGID, ok1 := fileOwner(oldInfo)
+	uid, gid, ok2 := fileOwner(info)
+	if !ok1 || !ok2 || (oldUID == uid && oldGID == gid) {
+		return Event{}, false
+	}
+	detail := fmt.Sprintf("owner %d:%d -> %d:%d", oldUID, oldGID, uid, gid)
+	w.trace(path, Chown, "detected: %s", detail)
+	return Event{Op: Chown, Path: path, FileInfo: info, Detail: detail}, true
+}
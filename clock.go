@@ -0,0 +1,36 @@
+package watcher
+
+import "time"
+
+// Clock 抽象了watcher用到的时间函数，测试的时候可以换成手动推进的时钟，不用真的等待轮询间隔
+type Clock interface {
+	Now() time.Time
+	// After 在经过d之后往返回的channel里发送当前时间
+	After(d time.Duration) <-chan time.Time
+}
+
+// 默认使用的系统时钟
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// 设置watcher使用的时钟，需要在Start之前调用，c为nil时恢复成系统时钟
+func (w *Watcher) SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	w.mu.Lock()
+	w.clock = c
+	w.mu.Unlock()
+}
+
+// 返回从t到现在经过的时间
+func (w *Watcher) since(t time.Time) time.Duration {
+	return w.clock.Now().Sub(t)
+}
@@ -0,0 +1,150 @@
+package watcher_test
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pythonsite/watcher"
+	"github.com/pythonsite/watcher/watchertest"
+)
+
+// 用FakeClock驱动Start，返回watcher、时钟和已经完成的扫描轮数
+func startFake(t *testing.T, root string, d time.Duration, setup func(w *watcher.Watcher)) (*watcher.Watcher, *watchertest.FakeClock, *int32) {
+	t.Helper()
+	clk := watchertest.NewFakeClock(time.Unix(0, 0))
+	w := watcher.New()
+	w.SetClock(clk)
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	scans := new(int32)
+	w.OnScanComplete(func(watcher.ScanSummary) { atomic.AddInt32(scans, 1) })
+	if setup != nil {
+		setup(w)
+	}
+	go w.Start(d)
+	t.Cleanup(func() {
+		go func() {
+			for range w.Event {
+			}
+		}()
+		w.Close()
+	})
+	w.Wait()
+	clk.BlockUntil(1)
+	return w, clk, scans
+}
+
+// 等一个事件，没有的话返回false
+func nextEvent(w *watcher.Watcher, wait time.Duration) (watcher.Event, bool) {
+	select {
+	case e := <-w.Event:
+		return e, true
+	case <-time.After(wait):
+		return watcher.Event{}, false
+	}
+}
+
+func TestStartWaitsForPollInterval(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w, clk, scans := startFake(t, root, 10*time.Second, func(w *watcher.Watcher) { w.FilterOps(watcher.Create) })
+
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"))
+	clk.Advance(9 * time.Second)
+	if e, ok := nextEvent(w, 50*time.Millisecond); ok {
+		t.Fatalf("got %v before the poll interval", e)
+	}
+	if n := atomic.LoadInt32(scans); n != 1 {
+		t.Fatalf("%d scans before the poll interval, want 1", n)
+	}
+	clk.Advance(time.Second)
+	e, ok := nextEvent(w, time.Second)
+	if !ok || e.Op != watcher.Create || e.Path != filepath.Join(root, "a") {
+		t.Fatalf("got %v, %v, want CREATE a", e, ok)
+	}
+}
+
+func TestSetPollIntervalWhileWaiting(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w, clk, _ := startFake(t, root, time.Hour, func(w *watcher.Watcher) { w.FilterOps(watcher.Create) })
+
+	if err := w.SetPollInterval(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// 等待重新计算之后的After
+	clk.BlockUntil(2)
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"))
+	clk.Advance(time.Second)
+	if e, ok := nextEvent(w, time.Second); !ok || e.Op != watcher.Create {
+		t.Fatalf("got %v, %v, want CREATE after the new interval", e, ok)
+	}
+}
+
+func TestAdaptivePollingBacksOff(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	_, clk, scans := startFake(t, root, time.Second, func(w *watcher.Watcher) {
+		w.SetAdaptivePolling(time.Second, 4*time.Second, 1)
+	})
+
+	// 每一轮没有事件间隔就加倍：2s、4s，之后不超过4s
+	want := int32(1)
+	for _, interval := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		clk.Advance(interval - time.Second)
+		waitScans(t, scans, want)
+		clk.Advance(time.Second)
+		want++
+		waitScans(t, scans, want)
+		clk.BlockUntil(1)
+	}
+}
+
+func waitScans(t *testing.T, scans *int32, want int32) {
+	t.Helper()
+	// 多等一会儿，确认不会多扫描
+	deadline := time.Now().Add(50 * time.Millisecond)
+	for atomic.LoadInt32(scans) <= want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadInt32(scans); n != want {
+		t.Fatalf("%d scans, want %d", n, want)
+	}
+}
+
+func TestRootIntervalHonored(t *testing.T) {
+	fast := watchertest.TempTree(t, nil)
+	slow := watchertest.TempTree(t, nil)
+	w, clk, _ := startFake(t, fast, time.Second, func(w *watcher.Watcher) {
+		w.FilterOps(watcher.Create)
+		if err := w.AddWithOptions(slow, watcher.Interval(3*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	watchertest.Apply(t, fast, watchertest.WriteFile("a", "a"))
+	watchertest.Apply(t, slow, watchertest.WriteFile("b", "b"))
+	for i := 1; i <= 3; i++ {
+		clk.Advance(time.Second)
+		var got []string
+		for {
+			e, ok := nextEvent(w, 50*time.Millisecond)
+			if !ok {
+				break
+			}
+			got = append(got, e.Path)
+		}
+		clk.BlockUntil(1)
+		var want []string
+		switch i {
+		case 1:
+			// 没有单独间隔的root按全局间隔扫描
+			want = []string{filepath.Join(fast, "a")}
+		case 3:
+			want = []string{filepath.Join(slow, "b")}
+		}
+		if len(got) != len(want) || (len(want) == 1 && got[0] != want[0]) {
+			t.Fatalf("after %ds: got %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// watcher 是watcher包的命令行工具
+//
+//	watcher [-cmd=COMMAND] [-interval=1s] [-ops=OPS] [-ignore=PATTERNS] [-expr=EXPR] [-scan-as=UID:GID] [-manage-addr=ADDR]
+//	        [-plugin=PATHS] [-wasm=FILE] [-wasm-fail-open] [-recursive] [-hidden] [-dry-run] [PATH...]
+//	                                           监控PATH(默认当前目录)，打印事件，有变化时运行COMMAND，
+//	                                           以/...结尾的路径递归监控，比如 watcher -cmd="go test ./..." ./...
+//	                                           设置了-manage-addr时在ADDR上提供管理接口，给status和ls查询
+//	                                           -plugin加载Go插件，-wasm用WebAssembly插件过滤和转换事件，
+//	                                           命令行工具不带WebAssembly运行时，需要由-plugin加载的插件注册
+//	watcher status [-addr=ADDR] [-json]        查看常驻进程的监控状态
+//	watcher ls [-addr=ADDR] [-json] [ROOT]     列出被跟踪的文件
+//	watcher agent [-config=FILE] [-endpoint=URL] [-spool=FILE] [-expr=EXPR] [PATH...]
+//	                                           把事件转发到中心服务
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pythonsite/watcher"
+	"github.com/pythonsite/watcher/agent"
+	"github.com/pythonsite/watcher/manage"
+)
+
+func main() {
+	// -scan-as启动的扫描子进程是这个程序自己，处理完父进程的请求之后直接退出
+	watcher.ServeScanHelper()
+
+	var err error
+	if len(os.Args) < 2 {
+		err = watch(nil)
+	} else {
+		err = dispatch(os.Args[1], os.Args[2:])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "watcher:", err)
+		os.Exit(1)
+	}
+}
+
+// 第一个参数不是子命令时按监控模式处理
+func dispatch(name string, args []string) error {
+	switch name {
+	case "status":
+		return status(args)
+	case "ls":
+		return ls(args)
+	case "agent":
+		return runAgent(args)
+	case "help", "-h", "-help", "--help":
+		usage()
+	}
+	return watch(append([]string{name}, args...))
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: watcher [-cmd=COMMAND] [-interval=1s] [-ops=OPS] [-ignore=PATTERNS] [-expr=EXPR] [-scan-as=UID:GID] [-manage-addr=ADDR]")
+	fmt.Fprintln(os.Stderr, "               [-plugin=PATHS] [-wasm=FILE] [-wasm-fail-open] [-recursive] [-hidden] [-dry-run] [PATH...]")
+	fmt.Fprintln(os.Stderr, "       watcher status [-addr=ADDR] [-json]")
+	fmt.Fprintln(os.Stderr, "       watcher ls [-addr=ADDR] [-json] [ROOT]")
+	fmt.Fprintln(os.Stderr, "       watcher agent [-config=FILE] [-endpoint=URL] [-spool=FILE] [-interval=1s] [-expr=EXPR] [PATH...]")
+	os.Exit(2)
+}
+
+// 管理命令共用的参数
+func manageFlags(name string) (*flag.FlagSet, *string, *bool) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	addr := fs.String("addr", manage.DefaultAddr, "address of the management API")
+	asJSON := fs.Bool("json", false, "print JSON")
+	return fs, addr, asJSON
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func status(args []string) error {
+	fs, addr, asJSON := manageFlags("status")
+	fs.Parse(args)
+
+	st, err := manage.NewClient(*addr).Status()
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(st)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "files\t%d\n", st.Files)
+	fmt.Fprintf(tw, "dirs\t%d\n", st.Dirs)
+	fmt.Fprintf(tw, "last scan\t%s (%s)\n", formatTime(st.LastScan), st.ScanDuration)
+	fmt.Fprintf(tw, "errors\t%d\n", st.Errors)
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "ROOT\tRECURSIVE\tSTATE\tLAST SCAN\tERROR")
+	for _, r := range st.Roots {
+		fmt.Fprintf(tw, "%s\t%t\t%s\t%s\t%s\n", r.Path, r.Recursive, r.State, formatTime(r.LastScan), r.Err)
+	}
+	if len(st.Recent) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "TIME\tOP\tPATH\tDETAIL")
+		for _, e := range st.Recent {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", formatTime(e.Time), e.Op, e.Path, e.Detail)
+		}
+	}
+	return tw.Flush()
+}
+
+func ls(args []string) error {
+	fs, addr, asJSON := manageFlags("ls")
+	fs.Parse(args)
+
+	root := fs.Arg(0)
+	if root != "" {
+		var err error
+		if root, err = filepath.Abs(root); err != nil {
+			return err
+		}
+	}
+	entries, err := manage.NewClient(*addr).List(root)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(entries)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", e.Mode, e.Size, formatTime(e.ModTime), e.Path)
+	}
+	return tw.Flush()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// 命令行参数覆盖配置文件里的设置
+func runAgent(args []string) error {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	config := fs.String("config", "", "JSON config file")
+	endpoint := fs.String("endpoint", "", "URL of the central endpoint")
+	spool := fs.String("spool", "", "file to buffer events in while the endpoint is unreachable")
+	interval := fs.String("interval", "", "poll interval (default 1s)")
+	host := fs.String("host", "", "hostname to tag events with (default os.Hostname)")
+	expr := fs.String("expr", "", `filter expression, e.g. op == "WRITE" && path matches "\\.log$"`)
+	fs.Parse(args)
+
+	var cfg agent.Config
+	if *config != "" {
+		var err error
+		if cfg, err = agent.LoadConfig(*config); err != nil {
+			return err
+		}
+	}
+	if *endpoint != "" {
+		cfg.Endpoint = *endpoint
+	}
+	if *spool != "" {
+		cfg.Spool = *spool
+	}
+	if *interval != "" {
+		cfg.Interval = *interval
+	}
+	if *host != "" {
+		cfg.Host = *host
+	}
+	if *expr != "" {
+		cfg.Expr = *expr
+	}
+	if fs.NArg() > 0 {
+		cfg.Paths = fs.Args()
+	}
+	return agent.Run(cfg)
+}
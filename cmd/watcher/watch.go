@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pythonsite/watcher"
+	"github.com/pythonsite/watcher/manage"
+	"github.com/pythonsite/watcher/plugins"
+)
+
+// 监控命令行上的路径，打印事件，有变化时运行-cmd
+// 以/...结尾的路径递归监控，比如 ./...
+func watch(args []string) error {
+	fs := flag.NewFlagSet("watcher", flag.ExitOnError)
+	command := fs.String("cmd", "", "command to run after each round of changes")
+	interval := fs.Duration("interval", time.Second, "poll interval")
+	opsFlag := fs.String("ops", "", "comma separated ops to report, e.g. create,write (default all)")
+	ignore := fs.String("ignore", "", "comma separated paths or glob patterns to ignore, e.g. *.log,node_modules")
+	expr := fs.String("expr", "", `only report events matching the filter expression, e.g. op == "WRITE" && size > 1<<20`)
+	scanAs := fs.String("scan-as", "", "list directories in a helper process running as UID:GID (Unix only)")
+	recursive := fs.Bool("recursive", false, "watch directories recursively (PATH/... is always recursive)")
+	hidden := fs.Bool("hidden", false, "also watch hidden files and directories")
+	dryRun := fs.Bool("dry-run", false, "print what would be watched and excluded, then exit")
+	manageAddr := fs.String("manage-addr", "", "serve the management API for watcher status and ls on this address, e.g. "+manage.DefaultAddr)
+	pluginPaths := fs.String("plugin", "", "comma separated Go plugins to load, e.g. one that registers a WebAssembly runtime (Linux, macOS and FreeBSD only)")
+	wasmPath := fs.String("wasm", "", "filter and transform events with this WebAssembly plugin, needs a runtime registered by -plugin")
+	wasmFailOpen := fs.Bool("wasm-fail-open", false, "keep events when the WebAssembly plugin fails instead of dropping them")
+	fs.Parse(args)
+
+	// 插件在init里注册Sink、Filter或者WebAssembly运行时，要在用到它们之前加载
+	if *pluginPaths != "" {
+		for _, path := range strings.Split(*pluginPaths, ",") {
+			if err := plugins.Load(path); err != nil {
+				return fmt.Errorf("error: loading plugin %s: %v", path, err)
+			}
+		}
+	}
+
+	w := watcher.New()
+	// 要在Add之前启动扫描子进程，第一次列出也不在当前进程里进行
+	if *scanAs != "" {
+		var uid, gid uint32
+		if _, err := fmt.Sscanf(*scanAs, "%d:%d", &uid, &gid); err != nil {
+			return fmt.Errorf("error: invalid -scan-as %q, want UID:GID", *scanAs)
+		}
+		if err := w.ScanAsUser(uid, gid); err != nil {
+			return err
+		}
+	}
+	w.IgnoreHiddenFiles(!*hidden)
+	if *opsFlag != "" {
+		var ops []watcher.Op
+		for _, name := range strings.Split(*opsFlag, ",") {
+			op, err := watcher.ParseOp(name)
+			if err != nil {
+				return err
+			}
+			ops = append(ops, op)
+		}
+		w.FilterOps(ops...)
+	}
+	if err := w.FilterExpr(*expr); err != nil {
+		return err
+	}
+	if *wasmPath != "" {
+		p, err := watcher.LoadWASM(*wasmPath)
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+		if *wasmFailOpen {
+			p.SetFailure(watcher.WASMFailOpen)
+		}
+		w.Use(p.Middleware())
+	}
+	// 忽略要在Add之前设置，这样被忽略的路径一开始就不会被列出
+	if *ignore != "" {
+		if err := w.IgnoreGlob(strings.Split(*ignore, ",")...); err != nil {
+			return err
+		}
+	}
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	for _, path := range paths {
+		var err error
+		if strings.HasSuffix(path, "/...") || strings.HasSuffix(path, `\...`) {
+			err = w.AddRecursive(strings.TrimSuffix(path, "..."))
+		} else if *recursive {
+			err = w.AddRecursive(path)
+		} else {
+			err = w.Add(path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if *dryRun {
+		return printPreview(w.Preview())
+	}
+
+	if wd, err := os.Getwd(); err == nil {
+		watcher.SetEventFormatter(watcher.FormatRelative(wd))
+	}
+	// 先监听，地址被占用时直接报错退出
+	if *manageAddr != "" {
+		ln, err := net.Listen("tcp", *manageAddr)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		srv := manage.New(w)
+		go func() {
+			if err := http.Serve(ln, srv); err != nil {
+				fmt.Fprintln(os.Stderr, "watcher: management API:", err)
+			}
+		}()
+	}
+	w.SetBatchMode(true)
+	go func() {
+		for err := range w.Error {
+			fmt.Fprintln(os.Stderr, "watcher:", err)
+		}
+	}()
+	go func() {
+		for batch := range w.Batch {
+			for _, e := range batch {
+				fmt.Println(e)
+			}
+			if *command != "" {
+				run(*command)
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		cancel()
+	}()
+	if err := w.StartContext(ctx, *interval); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// 用shell运行命令，输出直接交给终端，失败只打印出来，不退出
+func run(command string) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "watcher: %s: %v\n", command, err)
+	}
+}
+
+func printPreview(p watcher.WatchPreview) error {
+	fmt.Println("roots:")
+	roots := make([]string, 0, len(p.Roots))
+	for root := range p.Roots {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		if p.Roots[root] {
+			fmt.Printf("  %s (recursive)\n", root)
+		} else {
+			fmt.Printf("  %s\n", root)
+		}
+	}
+	fmt.Println("tracked:")
+	for _, path := range p.Tracked {
+		fmt.Printf("  %s\n", path)
+	}
+	printReasons("excluded:", p.Excluded)
+	printReasons("filtered:", p.Filtered)
+	return nil
+}
+
+func printReasons(title string, reasons map[string]string) {
+	if len(reasons) == 0 {
+		return
+	}
+	fmt.Println(title)
+	paths := make([]string, 0, len(reasons))
+	for path := range reasons {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Printf("  %s: %s\n", path, reasons[path])
+	}
+}
@@ -0,0 +1,139 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 默认认为是上传中临时文件的后缀
+var defaultTempSuffixes = []string{".part", ".partial", ".tmp", ".crdownload", ".filepart"}
+
+// CompletionPolicy 决定投递目录里的文件什么时候算是上传完成
+type CompletionPolicy struct {
+	StableFor     time.Duration // 大小和修改时间保持不变的时间，为0时只要求一轮扫描没有变化
+	TempSuffixes  []string      // 上传中的临时文件后缀，为nil时使用.part、.tmp等默认值
+	ExclusiveOpen bool          // 在Windows上还要求文件能被独占打开，其它平台上忽略
+}
+
+// 投递目录里每个文件的状态
+type completionState struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // 大小和修改时间从什么时候开始没有变化
+	done    bool      // 已经发送过Complete事件
+}
+
+// 把dir作为投递目录，目录下的文件按照policy判断上传完成之后发送一个Complete事件，
+// 文件之后再发生变化会重新判断，dir需要已经通过Add或者AddRecursive添加
+// 同一目录下还有临时文件在变化时，认为上传还没有结束
+// 调用时已经存在的文件不会发送Complete事件
+func (w *Watcher) DetectCompletion(dir string, policy CompletionPolicy) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if policy.TempSuffixes == nil {
+		policy.TempSuffixes = defaultTempSuffixes
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dropDirs == nil {
+		w.dropDirs = make(map[string]CompletionPolicy)
+		w.completion = make(map[string]completionState)
+	}
+	w.dropDirs[dir] = policy
+	now := w.clock.Now()
+	for path, info := range w.files {
+		if underPath(path, dir) && !info.IsDir() {
+			w.completion[path] = completionState{size: info.Size(), modTime: info.ModTime(), since: now, done: true}
+		}
+	}
+	return nil
+}
+
+// 返回path所在投递目录的策略
+func (w *Watcher) dropPolicy(path string) (CompletionPolicy, bool) {
+	for dir, policy := range w.dropDirs {
+		if underPath(path, dir) && path != dir {
+			return policy, true
+		}
+	}
+	return CompletionPolicy{}, false
+}
+
+func isTempFile(path string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查投递目录里的文件是否上传完成，返回Complete事件，调用的时候需要持有w.mu
+func (w *Watcher) detectCompletion(files map[string]os.FileInfo) []Event {
+	if len(w.dropDirs) == 0 {
+		return nil
+	}
+	for path := range w.completion {
+		if _, found := files[path]; !found {
+			delete(w.completion, path)
+		}
+	}
+
+	now := w.clock.Now()
+	busy := make(map[string]bool) // 有临时文件正在变化的目录
+	var candidates []string
+	for path, info := range files {
+		if info.IsDir() {
+			continue
+		}
+		policy, found := w.dropPolicy(path)
+		if !found {
+			continue
+		}
+		st, found := w.completion[path]
+		changed := !found || st.size != info.Size() || !st.modTime.Equal(info.ModTime())
+		if changed {
+			w.completion[path] = completionState{size: info.Size(), modTime: info.ModTime(), since: now}
+		}
+		if isTempFile(path, policy.TempSuffixes) {
+			if changed {
+				busy[filepath.Dir(path)] = true
+			}
+			continue
+		}
+		if !changed && !st.done {
+			candidates = append(candidates, path)
+		}
+	}
+
+	var events []Event
+	for _, path := range candidates {
+		st := w.completion[path]
+		policy, _ := w.dropPolicy(path)
+		if busy[filepath.Dir(path)] {
+			st.since = now
+			w.completion[path] = st
+			w.trace(path, Complete, "not detected: temp files in the same directory are still changing")
+			continue
+		}
+		if now.Sub(st.since) < policy.StableFor {
+			continue
+		}
+		if policy.ExclusiveOpen && !exclusiveOpen(path) {
+			w.trace(path, Complete, "not detected: file is still open by another process")
+			continue
+		}
+		st.done = true
+		w.completion[path] = st
+		detail := fmt.Sprintf("size %d stable for %s", st.size, now.Sub(st.since))
+		w.trace(path, Complete, "detected: %s", detail)
+		events = append(events, Event{Op: Complete, Path: path, FileInfo: files[path], Detail: detail})
+	}
+	return events
+}
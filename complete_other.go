@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package watcher
+
+// 其它平台上没有强制的独占打开，总是返回true
+func exclusiveOpen(path string) bool {
+	return true
+}
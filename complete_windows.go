@@ -0,0 +1,19 @@
+package watcher
+
+import "syscall"
+
+const errSharingViolation syscall.Errno = 32
+
+// 尝试以不共享的方式打开文件，其它进程还在写的时候会失败
+func exclusiveOpen(path string) bool {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ, 0, nil, syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return err != errSharingViolation
+	}
+	syscall.CloseHandle(h)
+	return true
+}
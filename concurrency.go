@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 设置递归列出目录时同时读取目录的worker数，n小于等于1时在扫描的goroutine里顺序遍历，默认顺序遍历
+// 几十万个文件的目录树大部分时间花在读目录和lstat上，多个worker可以把这部分时间分摊开；
+// 忽略、过滤等判断仍然在扫描的goroutine里进行，结果和顺序遍历一样，只是遍历的顺序不同
+func (w *Watcher) SetConcurrency(n int) {
+	w.mu.Lock()
+	w.concurrency = n
+	w.mu.Unlock()
+}
+
+// 一个目录的读取结果
+type dirListing struct {
+	path  string
+	info  os.FileInfo
+	infos []os.FileInfo
+	err   error
+}
+
+// 读取一个目录下的条目，info是目录本身的信息
+type readDirFunc func(path string, info os.FileInfo) ([]os.FileInfo, error)
+
+func readDir(path string, info os.FileInfo) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+// 和filepath.Walk一样遍历root并对每个路径调用fn，目录由n个worker用read并发读取，fn只在调用者的goroutine里调用
+// 每个目录下的路径按文件名顺序交给fn，但是目录之间的顺序不是深度优先的；listed不为nil时每个目录读取之后都会调用
+func walkParallel(root string, n int, read readDirFunc, listed func(dirListing), fn filepath.WalkFunc) error {
+	if n < 1 {
+		n = 1
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = fn(root, info, nil)
+	}
+	if err != nil || info == nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	jobs := make(chan dirListing)
+	results := make(chan dirListing)
+	done := make(chan struct{})
+	defer close(done)
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				select {
+				case job := <-jobs:
+					job.infos, job.err = read(job.path, job.info)
+					select {
+					case results <- job:
+					case <-done:
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	queue := []dirListing{{path: root, info: info}}
+	pending := 0
+	for len(queue) > 0 || pending > 0 {
+		var send chan dirListing
+		var next dirListing
+		if len(queue) > 0 {
+			send, next = jobs, queue[0]
+		}
+		select {
+		case send <- next:
+			queue = queue[1:]
+			pending++
+		case r := <-results:
+			pending--
+			if r.err != nil {
+				if err := fn(r.path, r.info, r.err); err != nil && err != filepath.SkipDir {
+					return err
+				}
+				continue
+			}
+			if listed != nil {
+				listed(r)
+			}
+			for _, child := range r.infos {
+				path := filepath.Join(r.path, child.Name())
+				err := fn(path, child, nil)
+				if err == filepath.SkipDir {
+					if child.IsDir() {
+						continue
+					}
+					// 和filepath.Walk一样，文件返回SkipDir时跳过这个目录里剩下的路径
+					break
+				}
+				if err != nil {
+					return err
+				}
+				if child.IsDir() {
+					queue = append(queue, dirListing{path: path, info: child})
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 生成一个dirs*dirs个目录、每个目录files个文件的目录树
+func benchTree(tb testing.TB, dirs, files int) string {
+	root := tb.TempDir()
+	for i := 0; i < dirs; i++ {
+		for j := 0; j < dirs; j++ {
+			dir := filepath.Join(root, fmt.Sprintf("d%d", i), fmt.Sprintf("d%d", j))
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				tb.Fatal(err)
+			}
+			for k := 0; k < files; k++ {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d", k)), nil, 0644); err != nil {
+					tb.Fatal(err)
+				}
+			}
+		}
+	}
+	return root
+}
+
+func TestListRecursiveConcurrency(t *testing.T) {
+	root := benchTree(t, 4, 5)
+	w := New()
+	serial, err := w.listRecursive(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SetConcurrency(4)
+	parallel, err := w.listRecursive(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial) != 1+4+16+16*5 {
+		t.Errorf("listed %d paths", len(serial))
+	}
+	if !reflect.DeepEqual(keys(serial), keys(parallel)) {
+		t.Error("parallel listing differs from serial listing")
+	}
+}
+
+func keys(m map[string]os.FileInfo) map[string]bool {
+	out := make(map[string]bool, len(m))
+	for k := range m {
+		out[k] = true
+	}
+	return out
+}
+
+// go test -bench ListRecursive 比较顺序遍历和多个worker遍历，多核机器上workers越多越快，单核上差别不大
+func BenchmarkListRecursive(b *testing.B) {
+	root := benchTree(b, 20, 20)
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			w := New()
+			w.SetConcurrency(n)
+			for i := 0; i < b.N; i++ {
+				if _, err := w.listRecursive(root); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 模拟网络文件系统上每次读目录都有延迟的情况，等待IO的时间可以重叠，单核机器上也能看出差别
+func BenchmarkWalkParallelLatency(b *testing.B) {
+	root := benchTree(b, 10, 5)
+	slow := func(path string, info os.FileInfo) ([]os.FileInfo, error) {
+		time.Sleep(200 * time.Microsecond)
+		return readDir(path, info)
+	}
+	walk := func(path string, info os.FileInfo, err error) error { return err }
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := walkParallel(root, n, slow, nil, walk); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
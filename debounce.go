@@ -0,0 +1,71 @@
+package watcher
+
+import "time"
+
+// 等待合并的事件
+type debounced struct {
+	event Event
+	last  time.Time // 这个路径最后一个事件的时间
+}
+
+// 设置去抖：同一个路径上相隔不超过d的Create、Write、Remove、Rename、Chmod、Chown、Move事件合并成一个，
+// 这个路径安静了d之后才发送，编辑器保存时的写临时文件、改名、改权限只会触发一次重新构建
+// 合并后的事件是最后一个事件，但是Create之后的Write、Chmod和Chown仍然是Create，Create之后又被删除的文件不发送事件；
+// 时间按扫描计算，d应该比轮询间隔长；d小于等于0时关闭，还在等待的事件会在下一轮发送
+func (w *Watcher) SetDebounce(d time.Duration) {
+	w.mu.Lock()
+	w.debounce = d
+	w.mu.Unlock()
+}
+
+// 需要去抖的事件类型
+var debouncedOps = map[Op]bool{Create: true, Write: true, Remove: true, Rename: true, Chmod: true, Chown: true, Move: true}
+
+// 把这一轮的事件放进去抖队列，返回已经安静了足够久的事件
+func (w *Watcher) debounceEvents(events []Event) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.debounce <= 0 && len(w.debouncing) == 0 {
+		return events
+	}
+	now := w.clock.Now()
+	var out []Event
+	for _, e := range events {
+		if w.debounce <= 0 || !debouncedOps[e.Op] {
+			out = append(out, e)
+			continue
+		}
+		if w.debouncing == nil {
+			w.debouncing = make(map[string]*debounced)
+		}
+		p, found := w.debouncing[e.Path]
+		switch {
+		case !found:
+			w.debouncing[e.Path] = &debounced{event: e, last: now}
+			continue
+		case p.event.Op == Create && (e.Op == Write || e.Op == Chmod || e.Op == Chown):
+			p.event.FileInfo = e.FileInfo
+		case p.event.Op == Create && e.Op == Remove:
+			w.trace(e.Path, Remove, "suppressed: created and removed within debounce window")
+			delete(w.debouncing, e.Path)
+			continue
+		case p.event.Op == Write && e.Op == Write:
+			// 保留第一次修改之前的信息，内容过滤检查的是这段时间里追加的全部内容
+			oldInfo := p.event.OldInfo
+			p.event = e
+			p.event.OldInfo = oldInfo
+		default:
+			p.event = e
+		}
+		w.trace(e.Path, e.Op, "coalesced: within debounce window")
+		p.last = now
+	}
+	for path, p := range w.debouncing {
+		if w.debounce <= 0 || now.Sub(p.last) >= w.debounce {
+			out = append(out, p.event)
+			delete(w.debouncing, path)
+		}
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package watcher
+
+import "sync"
+
+// HandlerFunc 处理一个事件
+type HandlerFunc func(Event)
+
+// Middleware 包装HandlerFunc，可以在处理前后做一些事情，或者直接不调用next来丢弃事件
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Dispatcher 按事件类型把事件分发给注册的处理函数，代替每个使用者都要写一遍的select加switch
+type Dispatcher struct {
+	mu         sync.Mutex
+	handlers   map[Op][]HandlerFunc
+	all        []HandlerFunc
+	onError    func(error)
+	middleware []Middleware
+}
+
+// 创建一个Dispatcher
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{handlers: make(map[Op][]HandlerFunc)}
+}
+
+// 为某一种事件注册处理函数，同一种事件可以注册多个，按注册顺序调用
+func (d *Dispatcher) Handle(op Op, h HandlerFunc) {
+	d.mu.Lock()
+	d.handlers[op] = append(d.handlers[op], h)
+	d.mu.Unlock()
+}
+
+// 注册处理所有事件的函数，在按类型注册的函数之后调用
+func (d *Dispatcher) HandleAll(h HandlerFunc) {
+	d.mu.Lock()
+	d.all = append(d.all, h)
+	d.mu.Unlock()
+}
+
+// 设置处理错误的函数
+func (d *Dispatcher) HandleError(f func(error)) {
+	d.mu.Lock()
+	d.onError = f
+	d.mu.Unlock()
+}
+
+// 添加中间件，先添加的在最外层
+func (d *Dispatcher) Use(mw ...Middleware) {
+	d.mu.Lock()
+	d.middleware = append(d.middleware, mw...)
+	d.mu.Unlock()
+}
+
+// Dispatch 让一个事件经过中间件之后交给对应的处理函数
+func (d *Dispatcher) Dispatch(e Event) {
+	d.mu.Lock()
+	handlers := append(append([]HandlerFunc(nil), d.handlers[e.Op]...), d.all...)
+	middleware := d.middleware
+	d.mu.Unlock()
+
+	h := wrapMiddleware(func(e Event) {
+		for _, handler := range handlers {
+			handler(e)
+		}
+	}, middleware)
+	h(e)
+}
+
+// Serve 从n读取事件和错误并分发，直到done被关闭
+// 对于Watcher可以把w.Closed作为done
+func (d *Dispatcher) Serve(n Notifier, done <-chan struct{}) {
+	events, errors := n.Events(), n.Errors()
+	for {
+		select {
+		case e := <-events:
+			d.Dispatch(e)
+		case err := <-errors:
+			d.mu.Lock()
+			onError := d.onError
+			d.mu.Unlock()
+			if onError != nil {
+				onError(err)
+			}
+		case <-done:
+			return
+		}
+	}
+}
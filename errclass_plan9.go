@@ -0,0 +1,6 @@
+package watcher
+
+// plan9的错误是字符串，不做分类
+func classifyErrno(err error) ErrorClass {
+	return ClassOther
+}
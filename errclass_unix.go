@@ -0,0 +1,26 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package watcher
+
+import (
+	"errors"
+	"syscall"
+)
+
+// 按errno分类
+func classifyErrno(err error) ErrorClass {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ClassOther
+	}
+	switch errno {
+	case syscall.ENOSPC, syscall.EDQUOT:
+		return ClassDiskFull
+	case syscall.EROFS:
+		return ClassReadOnly
+	case syscall.EIO:
+		return ClassIO
+	}
+	return ClassOther
+}
@@ -0,0 +1,33 @@
+package watcher
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows的错误码
+const (
+	errorWriteProtect    syscall.Errno = 19
+	errorCRC             syscall.Errno = 23
+	errorHandleDiskFull  syscall.Errno = 39
+	errorDiskFull        syscall.Errno = 112
+	errorIODevice        syscall.Errno = 1117
+	errorDiskQuotaExceed syscall.Errno = 1295
+)
+
+// 按Windows错误码分类
+func classifyErrno(err error) ErrorClass {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return ClassOther
+	}
+	switch errno {
+	case errorHandleDiskFull, errorDiskFull, errorDiskQuotaExceed:
+		return ClassDiskFull
+	case errorWriteProtect:
+		return ClassReadOnly
+	case errorCRC, errorIODevice:
+		return ClassIO
+	}
+	return ClassOther
+}
@@ -0,0 +1,108 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// 按底层错误分类之后，WatchError可以用errors.Is和这些错误比较，
+// 比如 errors.Is(err, ErrDiskFull)，这样磁盘满、只读和硬件故障可以分别告警
+var (
+	ErrDiskFull = errors.New("error: no space left on device")
+	ErrReadOnly = errors.New("error: read-only file system")
+	ErrIO       = errors.New("error: input/output error")
+)
+
+// ErrorClass 是扫描错误的类别
+type ErrorClass uint32
+
+const (
+	ClassOther      ErrorClass = iota // 其他错误
+	ClassNotExist                     // 路径不存在
+	ClassPermission                   // 没有权限
+	ClassDiskFull                     // 磁盘空间或者配额用完(ENOSPC、EDQUOT)
+	ClassReadOnly                     // 文件系统是只读的，比如出错之后被重新挂载成只读(EROFS)
+	ClassIO                           // 底层IO错误，通常说明磁盘或者网络存储出了问题(EIO)
+)
+
+var errorClasses = map[ErrorClass]string{
+	ClassOther:      "OTHER",
+	ClassNotExist:   "NOT_EXIST",
+	ClassPermission: "PERMISSION",
+	ClassDiskFull:   "DISK_FULL",
+	ClassReadOnly:   "READ_ONLY",
+	ClassIO:         "IO",
+}
+
+func (c ErrorClass) String() string {
+	if class, found := errorClasses[c]; found {
+		return class
+	}
+	return "???"
+}
+
+// 返回err的类别
+func classifyError(err error) ErrorClass {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return ClassNotExist
+	case errors.Is(err, os.ErrPermission):
+		return ClassPermission
+	}
+	return classifyErrno(err)
+}
+
+// WatchError 是扫描过程中发送到Error的错误，带上了出错的路径和所属的root，
+// 底层的os错误可以用errors.Is/As取出来，比如 errors.Is(err, os.ErrPermission)，
+// 没有权限和被删除也可以直接看Class区分
+type WatchError struct {
+	Op    string     // 出错时在做的操作，比如"list"
+	Path  string     // 出错的路径
+	Root  string     // 出错路径所属的root，也就是传给Add或AddRecursive的路径
+	Err   error      // 底层错误
+	Class ErrorClass // 底层错误的类别
+	// root是否是通过AddRecursive添加的
+	Recursive bool
+	// root已经不存在，被从监控列表里移除了，之后可以根据Recursive用Add或AddRecursive重新添加
+	Removed bool
+}
+
+func (e *WatchError) Error() string {
+	if e.Path != e.Root {
+		return fmt.Sprintf("error: %s %s (root %s): %v", e.Op, e.Path, e.Root, e.Err)
+	}
+	return fmt.Sprintf("error: %s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *WatchError) Unwrap() error {
+	return e.Err
+}
+
+// 被监控的路径不存在的时候，errors.Is(err, ErrWatchedFileDeleted)也成立，
+// 错误类别是ClassDiskFull、ClassReadOnly或ClassIO时分别和ErrDiskFull、ErrReadOnly、ErrIO匹配
+func (e *WatchError) Is(target error) bool {
+	switch target {
+	case ErrWatchedFileDeleted:
+		return errors.Is(e.Err, os.ErrNotExist)
+	case ErrDiskFull:
+		return e.Class == ClassDiskFull
+	case ErrReadOnly:
+		return e.Class == ClassReadOnly
+	case ErrIO:
+		return e.Class == ClassIO
+	}
+	return false
+}
+
+// 把列出root时的错误包装成WatchError，路径优先使用底层错误里的路径，
+// root不存在时会被移除，所以同时设置Removed
+func listError(root string, recursive bool, err error) error {
+	path := root
+	var pathErr *os.PathError
+	if errors.As(err, &pathErr) {
+		path = pathErr.Path
+	}
+	return &WatchError{Op: "list", Path: path, Root: root, Err: err, Class: classifyError(err),
+		Recursive: recursive, Removed: os.IsNotExist(err)}
+}
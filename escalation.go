@@ -0,0 +1,63 @@
+package watcher
+
+import (
+	"os"
+	"runtime"
+	"strings"
+)
+
+// 获得之后会发送Escalation事件的权限位，0002是其他用户可写
+const dangerousModes = os.ModeSetuid | os.ModeSetgid | 0002
+
+// 设置是否检测权限提升，开启后文件获得setuid、setgid位或者变成所有人可写的时候(包括新出现的带这些位的文件)，
+// 以及目录失去sticky位的时候(所有人都可以删除、改名别人的文件)，除了Chmod或Create之外还会发送一个Escalation事件，
+// Detail里说明具体的变化；符号链接的权限位没有意义，Windows上的权限位是模拟出来的，这两种情况不检查所有人可写
+func (w *Watcher) DetectEscalation(enable bool) {
+	w.mu.Lock()
+	w.detectEscalation = enable
+	w.mu.Unlock()
+}
+
+// 返回从oldMode到newMode权限变危险的说明，没有的时候返回空字符串
+func gainedModes(oldMode, newMode os.FileMode) string {
+	gained := newMode & dangerousModes &^ oldMode
+	if newMode&os.ModeSymlink != 0 || runtime.GOOS == "windows" {
+		gained &^= 0002
+	}
+	var bits []string
+	if gained&os.ModeSetuid != 0 {
+		bits = append(bits, "setuid")
+	}
+	if gained&os.ModeSetgid != 0 {
+		bits = append(bits, "setgid")
+	}
+	if gained&0002 != 0 {
+		bits = append(bits, "world-writable")
+	}
+	var changes []string
+	if len(bits) > 0 {
+		changes = append(changes, "gained "+strings.Join(bits, " and "))
+	}
+	if newMode.IsDir() && oldMode&os.ModeSticky != 0 && newMode&os.ModeSticky == 0 {
+		changes = append(changes, "lost sticky")
+	}
+	return strings.Join(changes, ", ")
+}
+
+// 如果文件的权限变危险了返回Escalation事件，调用的时候需要持有w.mu
+// 新文件的oldInfo为nil
+func (w *Watcher) escalation(path string, oldInfo, info os.FileInfo) (Event, bool) {
+	if !w.detectEscalation {
+		return Event{}, false
+	}
+	var oldMode os.FileMode
+	if oldInfo != nil {
+		oldMode = oldInfo.Mode()
+	}
+	detail := gainedModes(oldMode, info.Mode())
+	if detail == "" {
+		return Event{}, false
+	}
+	w.trace(path, Escalation, "detected: %s", detail)
+	return Event{Op: Escalation, Path: path, FileInfo: info, Detail: detail}, true
+}
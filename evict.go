@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// 设置最多跟踪的条目数，超过之后淘汰最久没有修改过的文件(按修改时间)，为每个被淘汰的文件发送一个Evicted事件，
+// 防止某个目录失控增长耗尽常驻进程的内存；n小于等于0时不限制
+// 被淘汰的文件之后不再跟踪，也不会发送事件，直到它被删除或者改名之后重新出现；root和目录不会被淘汰
+func (w *Watcher) SetMaxEntries(n int) {
+	w.mu.Lock()
+	w.maxEntries = n
+	w.mu.Unlock()
+}
+
+// 从列出的文件里去掉已经淘汰的，已经不存在的淘汰记录一起清理掉，调用的时候需要持有w.mu
+func (w *Watcher) filterEvicted(files map[string]os.FileInfo) {
+	if len(w.evicted) == 0 {
+		return
+	}
+	for path := range w.evicted {
+		if _, found := files[path]; found {
+			delete(files, path)
+		} else {
+			delete(w.evicted, path)
+		}
+	}
+}
+
+// 条目数超过上限时淘汰最久没有修改过的文件，直接从files里删除，调用的时候需要持有w.mu
+func (w *Watcher) evict(files map[string]os.FileInfo) []Event {
+	if w.maxEntries <= 0 || len(files) <= w.maxEntries {
+		return nil
+	}
+	var candidates []string
+	for path, info := range files {
+		if _, root := w.names[path]; !root && !info.IsDir() {
+			candidates = append(candidates, path)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return files[candidates[i]].ModTime().Before(files[candidates[j]].ModTime())
+	})
+	n := len(files) - w.maxEntries
+	if n > len(candidates) {
+		n = len(candidates)
+	}
+	if w.evicted == nil {
+		w.evicted = make(map[string]bool)
+	}
+	detail := fmt.Sprintf("entry limit %d reached", w.maxEntries)
+	events := make([]Event, 0, n)
+	for _, path := range candidates[:n] {
+		info := files[path]
+		delete(files, path)
+		w.untrackFile(path)
+		w.evicted[path] = true
+		w.trace(path, Evicted, "detected: %s", detail)
+		events = append(events, Event{Op: Evicted, Path: path, FileInfo: info, Detail: detail})
+	}
+	return events
+}
@@ -0,0 +1,580 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr 是编译好的事件过滤表达式，语法接近Go，比如
+//
+//	op == "WRITE" && size > 1<<20 && path matches "\\.log$"
+//	op in ["CREATE", "REMOVE"] && !isdir
+//
+// 可以使用的字段：
+//
+//	op       事件类型，比如"WRITE"
+//	path     事件的路径，Rename和Move是新路径
+//	oldpath  Rename和Move的旧路径，其他事件和path一样
+//	name     文件名
+//	dir      所在目录
+//	ext      扩展名，比如".log"
+//	size     文件大小
+//	mode     权限位，比如 mode & 0o111 != 0
+//	isdir    是否是目录
+//	modtime  修改时间的Unix时间戳(秒)
+//	detail   事件的补充说明
+//	keys     结构化文件发生变化的key，用逗号连接
+//
+// 运算符按优先级从高到低：! 和一元-，* / % << >> &，+ - |，== != < <= > >= matches contains in，&&，||
+// 字符串可以用双引号或者反引号，+可以连接字符串
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// 编译表达式，语法错误或者使用了不存在的字段时返回错误
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	root, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+func (x *Expr) String() string {
+	return x.src
+}
+
+// Eval 对事件求值，表达式的结果不是bool或者求值出错(比如类型不匹配)时返回错误
+func (x *Expr) Eval(e Event) (bool, error) {
+	v, err := x.root.eval(e)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("error: expression %q is %T, not bool", x.src, v)
+	}
+	return b, nil
+}
+
+// Match 对事件求值，出错的时候返回false
+func (x *Expr) Match(e Event) bool {
+	b, err := x.Eval(e)
+	return err == nil && b
+}
+
+// Filter 把表达式转换成Filter
+func (x *Expr) Filter() Filter {
+	return x.Match
+}
+
+// 设置事件过滤表达式，只有表达式为true的事件才会发送，可以在运行的时候随时修改，src为空时取消过滤
+func (w *Watcher) FilterExpr(src string) error {
+	var x *Expr
+	if src != "" {
+		var err error
+		if x, err = CompileExpr(src); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	w.expr = x
+	w.mu.Unlock()
+	return nil
+}
+
+// 判断事件是否通过表达式过滤
+func (w *Watcher) matchExpr(e Event) bool {
+	w.mu.Lock()
+	x := w.expr
+	w.mu.Unlock()
+	return x == nil || x.Match(e)
+}
+
+func init() {
+	// 配置expr是表达式
+	RegisterFilter("expr", func(config map[string]string) (Filter, error) {
+		x, err := CompileExpr(config["expr"])
+		if err != nil {
+			return nil, err
+		}
+		return x.Filter(), nil
+	})
+}
+
+// 事件里可以在表达式中使用的字段
+var exprFields = map[string]func(e Event) interface{}{
+	"op": func(e Event) interface{} { return e.Op.String() },
+	"path": func(e Event) interface{} {
+		paths := eventPaths(e)
+		return paths[len(paths)-1]
+	},
+	"oldpath": func(e Event) interface{} { return eventPaths(e)[0] },
+	"name": func(e Event) interface{} {
+		paths := eventPaths(e)
+		return filepath.Base(paths[len(paths)-1])
+	},
+	"dir": func(e Event) interface{} {
+		paths := eventPaths(e)
+		return filepath.Dir(paths[len(paths)-1])
+	},
+	"ext": func(e Event) interface{} {
+		paths := eventPaths(e)
+		return filepath.Ext(paths[len(paths)-1])
+	},
+	"size": func(e Event) interface{} {
+		if e.FileInfo == nil {
+			return int64(0)
+		}
+		return e.Size()
+	},
+	"mode": func(e Event) interface{} {
+		if e.FileInfo == nil {
+			return int64(0)
+		}
+		return int64(e.Mode().Perm())
+	},
+	"isdir": func(e Event) interface{} { return e.FileInfo != nil && e.IsDir() },
+	"modtime": func(e Event) interface{} {
+		if e.FileInfo == nil {
+			return int64(0)
+		}
+		return e.ModTime().Unix()
+	},
+	"detail": func(e Event) interface{} { return e.Detail },
+	"keys":   func(e Event) interface{} { return strings.Join(e.ChangedKeys, ",") },
+}
+
+type exprNode interface {
+	eval(e Event) (interface{}, error)
+}
+
+type exprLiteral struct{ v interface{} }
+
+func (n exprLiteral) eval(Event) (interface{}, error) { return n.v, nil }
+
+type exprField struct{ get func(Event) interface{} }
+
+func (n exprField) eval(e Event) (interface{}, error) { return n.get(e), nil }
+
+type exprList []exprNode
+
+func (n exprList) eval(e Event) (interface{}, error) {
+	values := make([]interface{}, len(n))
+	for i, item := range n {
+		v, err := item.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// 比较两个值是否相等，列表不能比较，直接用==比较会panic
+func exprEqual(l, r interface{}, op string) (bool, error) {
+	if _, ok := l.([]interface{}); ok {
+		return false, fmt.Errorf("error: invalid operand %T for %s", l, op)
+	}
+	if _, ok := r.([]interface{}); ok {
+		return false, fmt.Errorf("error: invalid operand %T for %s", r, op)
+	}
+	return l == r, nil
+}
+
+type exprUnary struct {
+	op string
+	x  exprNode
+}
+
+func (n exprUnary) eval(e Event) (interface{}, error) {
+	v, err := n.x.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case bool:
+		if n.op == "!" {
+			return !v, nil
+		}
+	case int64:
+		if n.op == "-" {
+			return -v, nil
+		}
+	}
+	return nil, fmt.Errorf("error: invalid operand %T for %s", v, n.op)
+}
+
+type exprBinary struct {
+	op   string
+	l, r exprNode
+	re   *regexp.Regexp // 右边是字符串常量时预先编译好的matches
+}
+
+func (n exprBinary) eval(e Event) (interface{}, error) {
+	l, err := n.l.eval(e)
+	if err != nil {
+		return nil, err
+	}
+	// && 和 || 短路求值
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := l.(bool)
+		if !ok {
+			return nil, fmt.Errorf("error: invalid operand %T for %s", l, n.op)
+		}
+		if lb == (n.op == "||") {
+			return lb, nil
+		}
+		r, err := n.r.eval(e)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := r.(bool)
+		if !ok {
+			return nil, fmt.Errorf("error: invalid operand %T for %s", r, n.op)
+		}
+		return rb, nil
+	}
+	r, err := n.r.eval(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==", "!=":
+		equal, err := exprEqual(l, r, n.op)
+		if err != nil {
+			return nil, err
+		}
+		return equal == (n.op == "=="), nil
+	case "in":
+		list, ok := r.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error: right side of in must be a list, not %T", r)
+		}
+		for _, item := range list {
+			equal, err := exprEqual(l, item, n.op)
+			if err != nil {
+				return nil, err
+			}
+			if equal {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	switch l := l.(type) {
+	case int64:
+		r, ok := r.(int64)
+		if !ok {
+			break
+		}
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		case "+":
+			return l + r, nil
+		case "-":
+			return l - r, nil
+		case "*":
+			return l * r, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, fmt.Errorf("error: division by zero")
+			}
+			if n.op == "/" {
+				return l / r, nil
+			}
+			return l % r, nil
+		case "<<", ">>":
+			if r < 0 || r > 63 {
+				return nil, fmt.Errorf("error: invalid shift count %d", r)
+			}
+			if n.op == "<<" {
+				return l << uint(r), nil
+			}
+			return l >> uint(r), nil
+		case "&":
+			return l & r, nil
+		case "|":
+			return l | r, nil
+		}
+	case string:
+		r, ok := r.(string)
+		if !ok {
+			break
+		}
+		switch n.op {
+		case "<":
+			return l < r, nil
+		case "<=":
+			return l <= r, nil
+		case ">":
+			return l > r, nil
+		case ">=":
+			return l >= r, nil
+		case "+":
+			return l + r, nil
+		case "contains":
+			return strings.Contains(l, r), nil
+		case "matches":
+			re := n.re
+			if re == nil {
+				var err error
+				if re, err = regexp.Compile(r); err != nil {
+					return nil, err
+				}
+			}
+			return re.MatchString(l), nil
+		}
+	}
+	return nil, fmt.Errorf("error: invalid operands %T and %T for %s", l, r, n.op)
+}
+
+// 二元运算符的优先级
+var exprPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "matches": 3, "contains": 3, "in": 3,
+	"+": 4, "-": 4, "|": 4,
+	"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5,
+}
+
+type exprTokenKind int
+
+const (
+	tokEOF exprTokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	pos  int
+	v    interface{} // 数字和字符串的值
+}
+
+type exprParser struct {
+	src    string
+	tokens []exprToken
+	next   int
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, args ...interface{}) error {
+	return fmt.Errorf("error: expression %q at %d: %s", p.src, tok.pos, fmt.Sprintf(format, args...))
+}
+
+// 按长度从长到短排列，保证先匹配"<="再匹配"<"
+var exprOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<<", ">>", "<", ">", "!", "+", "-", "*", "/", "%", "&", "|", "(", ")", "[", "]", ","}
+
+func (p *exprParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			n, err := strconv.ParseInt(s[i:j], 0, 64)
+			if err != nil {
+				return fmt.Errorf("error: expression %q at %d: invalid number %q", p.src, i, s[i:j])
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokNumber, text: s[i:j], pos: i, v: n})
+			i = j
+		case c == '"' || c == '`':
+			j := i + 1
+			for j < len(s) && rune(s[j]) != c {
+				if c == '"' && s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("error: expression %q at %d: unterminated string", p.src, i)
+			}
+			str, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return fmt.Errorf("error: expression %q at %d: invalid string", p.src, i)
+			}
+			p.tokens = append(p.tokens, exprToken{kind: tokString, text: s[i : j+1], pos: i, v: str})
+			i = j + 1
+		default:
+			found := false
+			for _, op := range exprOps {
+				if strings.HasPrefix(s[i:], op) {
+					p.tokens = append(p.tokens, exprToken{kind: tokOp, text: op, pos: i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("error: expression %q at %d: unexpected %q", p.src, i, c)
+			}
+		}
+	}
+	p.tokens = append(p.tokens, exprToken{kind: tokEOF, pos: len(s)})
+	return nil
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.next]
+}
+
+func (p *exprParser) take() exprToken {
+	tok := p.tokens[p.next]
+	if tok.kind != tokEOF {
+		p.next++
+	}
+	return tok
+}
+
+func (p *exprParser) expect(text string) error {
+	if tok := p.take(); tok.text != text || tok.kind == tokString {
+		return p.errorf(tok, "expected %q", text)
+	}
+	return nil
+}
+
+// 二元运算符，matches、contains和in虽然是标识符也按运算符处理
+func (p *exprParser) binaryOp() (string, int) {
+	tok := p.peek()
+	if tok.kind != tokOp && tok.kind != tokIdent {
+		return "", 0
+	}
+	prec, found := exprPrecedence[tok.text]
+	if !found {
+		return "", 0
+	}
+	return tok.text, prec
+}
+
+// 优先级爬升
+func (p *exprParser) parseBinary(minPrec int) (exprNode, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, prec := p.binaryOp()
+		if prec < minPrec || prec == 0 {
+			return l, nil
+		}
+		p.take()
+		r, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		if op == "==" || op == "!=" {
+			_, lList := l.(exprList)
+			_, rList := r.(exprList)
+			if lList || rList {
+				return nil, fmt.Errorf("error: expression %q: lists cannot be compared with %s", p.src, op)
+			}
+		}
+		n := exprBinary{op: op, l: l, r: r}
+		if lit, ok := r.(exprLiteral); ok && op == "matches" {
+			pattern, ok := lit.v.(string)
+			if !ok {
+				return nil, fmt.Errorf("error: expression %q: matches needs a string pattern", p.src)
+			}
+			if n.re, err = regexp.Compile(pattern); err != nil {
+				return nil, err
+			}
+		}
+		l = n
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	tok := p.peek()
+	if tok.kind == tokOp && (tok.text == "!" || tok.text == "-") {
+		p.take()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{op: tok.text, x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.take()
+	switch tok.kind {
+	case tokNumber, tokString:
+		return exprLiteral{tok.v}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return exprLiteral{true}, nil
+		case "false":
+			return exprLiteral{false}, nil
+		}
+		get, found := exprFields[tok.text]
+		if !found {
+			return nil, p.errorf(tok, "unknown field %q", tok.text)
+		}
+		return exprField{get}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			x, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			var list exprList
+			for p.peek().text != "]" || p.peek().kind == tokString {
+				item, err := p.parseBinary(1)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+				if p.peek().text != "," || p.peek().kind == tokString {
+					break
+				}
+				p.take()
+			}
+			return list, p.expect("]")
+		}
+	}
+	if tok.kind == tokEOF {
+		return nil, p.errorf(tok, "unexpected end of expression")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
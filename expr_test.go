@@ -0,0 +1,64 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExprEval(t *testing.T) {
+	e := Event{Op: Write, Path: "/var/log/app.log", FileInfo: &fileInfo{name: "app.log", size: 2 << 20, mode: 0644, modTime: time.Unix(100, 0)}}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`op == "WRITE" && size > 1<<20 && path matches "\\.log$"`, true},
+		{`op in ["CREATE", "REMOVE"]`, false},
+		{`ext == ".log" && !isdir`, true},
+		{`mode & 0o111 != 0`, false},
+		{`name + "x" == "app.logx"`, true},
+	}
+	for _, tt := range tests {
+		x, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Fatalf("CompileExpr(%q): %v", tt.src, err)
+		}
+		got, err := x.Eval(e)
+		if err != nil {
+			t.Fatalf("Eval(%q): %v", tt.src, err)
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprListEquality(t *testing.T) {
+	for _, src := range []string{`[1] == [1]`, `[1] != [1]`, `op == ["WRITE"]`} {
+		if _, err := CompileExpr(src); err == nil {
+			t.Errorf("CompileExpr(%q) succeeded, want error", src)
+		}
+	}
+	// 列表嵌套在in里面时只能在求值的时候发现，不能panic
+	x, err := CompileExpr(`[1] in [[1]]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := x.Eval(Event{Op: Write, Path: "a"}); err == nil {
+		t.Error("Eval succeeded, want error")
+	}
+	if x.Match(Event{Op: Write, Path: "a"}) {
+		t.Error("Match = true, want false")
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, src := range []string{`op ==`, `nosuchfield == 1`, `path matches "("`} {
+		if _, err := CompileExpr(src); err == nil {
+			t.Errorf("CompileExpr(%q) succeeded, want error", src)
+		}
+	}
+	x, _ := CompileExpr(`size / 0 > 1`)
+	if _, err := x.Eval(Event{Op: Write, Path: "a", FileInfo: &fileInfo{size: 1}}); err == nil {
+		t.Error("division by zero succeeded")
+	}
+}
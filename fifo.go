@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+)
+
+// 当前平台不支持检测命名管道里的数据时，WatchFIFOs返回这个错误
+var ErrFIFOUnsupported = errors.New("error: watching named pipes for data is not supported on this platform")
+
+// 一个为了检测数据打开着的命名管道
+type fifoState struct {
+	fd    int
+	info  os.FileInfo
+	ready bool // 上一次检查时有数据，已经发送过DataAvailable
+}
+
+// 设置是否检测被监控的命名管道(FIFO)里有没有数据，stat看不出管道里有没有数据，
+// 开启后每一轮扫描用select检查每个命名管道是否可读，从没有数据变成有数据时发送一个DataAvailable事件，
+// 数据被读走之前不会重复发送；为了检查，watcher会以非阻塞的方式一直打开着管道的读端，
+// 所以写端打开管道时不会再等待读端。只支持Linux
+func (w *Watcher) WatchFIFOs(enable bool) error {
+	if enable && !fifoSupported {
+		return ErrFIFOUnsupported
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.watchFIFOs = enable
+	if !enable {
+		w.closeFIFOs()
+	}
+	return nil
+}
+
+// 检查这一轮扫描到的命名管道，为新出现数据的管道返回DataAvailable事件，调用的时候需要持有w.mu
+func (w *Watcher) fifoEvents(files map[string]os.FileInfo) []Event {
+	if !w.watchFIFOs {
+		return nil
+	}
+	if w.fifos == nil {
+		w.fifos = make(map[string]*fifoState)
+	}
+	for path, st := range w.fifos {
+		if info, found := files[path]; !found || !sameFile(st.info, info) {
+			closeFIFO(st.fd)
+			delete(w.fifos, path)
+		}
+	}
+
+	var events []Event
+	for path, info := range files {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			continue
+		}
+		st := w.fifos[path]
+		if st == nil {
+			fd, err := openFIFO(path)
+			if err != nil {
+				w.trace(path, DataAvailable, "not checked: %v", err)
+				continue
+			}
+			st = &fifoState{fd: fd, info: info}
+			w.fifos[path] = st
+		}
+		readable, err := fifoReadable(st.fd)
+		if err != nil {
+			w.trace(path, DataAvailable, "not checked: %v", err)
+			continue
+		}
+		if readable && !st.ready {
+			w.trace(path, DataAvailable, "detected: pipe is readable")
+			events = append(events, Event{Op: DataAvailable, Path: path, FileInfo: info})
+		}
+		st.ready = readable
+	}
+	return events
+}
+
+// 关闭所有打开着的命名管道，调用的时候需要持有w.mu
+func (w *Watcher) closeFIFOs() {
+	for path, st := range w.fifos {
+		closeFIFO(st.fd)
+		delete(w.fifos, path)
+	}
+}
@@ -0,0 +1,37 @@
+package watcher
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const fifoSupported = true
+
+func openFIFO(path string) (int, error) {
+	return syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+}
+
+func closeFIFO(fd int) {
+	syscall.Close(fd)
+}
+
+// 用select检查管道是否可读；写端全部关闭之后管道也是可读的(读到EOF)，
+// 所以可读的时候再用TIOCINQ确认里面确实有数据
+func fifoReadable(fd int) (bool, error) {
+	if fd >= syscall.FD_SETSIZE {
+		return false, syscall.EINVAL
+	}
+	var set syscall.FdSet
+	n := int(8 * unsafe.Sizeof(set.Bits[0]))
+	set.Bits[fd/n] |= 1 << (uint(fd) % uint(n))
+	ready, err := syscall.Select(fd+1, &set, nil, nil, &syscall.Timeval{})
+	if err != nil || ready == 0 {
+		return false, err
+	}
+	var avail int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.TIOCINQ, uintptr(unsafe.Pointer(&avail)))
+	if errno != 0 {
+		return false, errno
+	}
+	return avail > 0, nil
+}
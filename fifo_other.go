@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+const fifoSupported = false
+
+func openFIFO(path string) (int, error) {
+	return -1, ErrFIFOUnsupported
+}
+
+func closeFIFO(fd int) {}
+
+func fifoReadable(fd int) (bool, error) {
+	return false, ErrFIFOUnsupported
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+)
+
+// 过滤钩子返回这个错误时跳过这个路径
+var ErrSkip = errors.New("error: skipping file")
+
+// 过滤钩子，列出每个文件和目录(root本身除外)时调用，返回ErrSkip跳过这个路径，跳过的目录不会进入；
+// 返回其他错误时这次列出失败，错误由Add返回或者在扫描时发送到Error
+type FilterFileHookFunc func(info os.FileInfo, fullPath string) error
+
+// 添加一个过滤钩子，可以按大小、扩展名、修改时间等FileInfo里的信息跳过文件，被跳过的文件不会进入监控的文件列表，
+// 多个钩子按添加的顺序调用，任何一个跳过就跳过；已经跟踪的路径被新钩子跳过的会被直接移除，不会产生Remove事件
+// 设置了ScanAsUser时钩子在当前进程里对子进程返回的结果调用；每个root在自己的goroutine里列出，钩子可能被并发调用
+func (w *Watcher) AddFilterHook(f FilterFileHookFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.ffh = append(w.ffh, f)
+	before := make([]string, 0, len(w.files))
+	for path := range w.files {
+		before = append(before, path)
+	}
+	w.pruneHooked(w.files)
+	for _, path := range before {
+		if _, found := w.files[path]; !found {
+			w.untrackFile(path)
+		}
+	}
+}
+
+// 用过滤钩子检查path，返回是否跳过，调用的时候需要持有w.mu
+func (w *Watcher) hookFiltered(path string, info os.FileInfo) (bool, error) {
+	for _, f := range w.ffh {
+		err := f(info, path)
+		if err == ErrSkip {
+			return true, nil
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// 从files里去掉被过滤钩子跳过的路径，以及被跳过的目录下面的路径，调用的时候需要持有w.mu
+func (w *Watcher) pruneHooked(files map[string]os.FileInfo) error {
+	if len(w.ffh) == 0 {
+		return nil
+	}
+	var first error
+	var skipped []string
+	for path, info := range files {
+		if _, root := w.names[path]; root {
+			continue
+		}
+		skip, err := w.hookFiltered(path, info)
+		if err != nil && first == nil {
+			first = err
+		}
+		if skip {
+			delete(files, path)
+			if info.IsDir() {
+				skipped = append(skipped, path)
+			}
+		}
+	}
+	// 被跳过的目录下面的路径也要去掉
+	for _, dir := range skipped {
+		for path := range files {
+			if underPath(path, dir) {
+				delete(files, path)
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,144 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// SampleRule 大文件抽样指纹的规则
+type SampleRule struct {
+	MinSize int64 // 文件大小不小于MinSize的时候使用这条规则
+	Bytes   int64 // 文件头部和尾部各读取的字节数
+}
+
+type fingerprint [sha256.Size]byte
+
+// 设置大文件的抽样指纹规则，每条规则对应一个大小区间，文件使用MinSize最大的那条匹配规则
+// 命中规则的文件除了比较修改时间，还比较 头部+尾部+大小 的哈希，
+// 这样修改时间被保留的头尾改动也能发现，又不用完整读取几个GB的文件；不传规则时关闭抽样，设置了ScanAsUser时不能开启
+func (w *Watcher) SampleLargeFiles(rules ...SampleRule) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var enabled []SampleRule
+	for _, rule := range rules {
+		if rule.Bytes > 0 {
+			enabled = append(enabled, rule)
+		}
+	}
+	if len(enabled) > 0 {
+		if err := w.refuseContent("SampleLargeFiles"); err != nil {
+			return err
+		}
+	}
+	w.sampleRules = enabled
+	w.fingerprints = nil
+	if len(w.sampleRules) == 0 {
+		return nil
+	}
+	sort.Slice(w.sampleRules, func(i, j int) bool {
+		return w.sampleRules[i].MinSize > w.sampleRules[j].MinSize
+	})
+	w.fingerprints = make(map[string]fingerprint)
+	for path, info := range w.files {
+		w.loadFingerprint(path, info)
+	}
+	return nil
+}
+
+// 找到文件对应的抽样规则
+func (w *Watcher) sampleRule(info os.FileInfo) (SampleRule, bool) {
+	if info.IsDir() {
+		return SampleRule{}, false
+	}
+	for _, rule := range w.sampleRules {
+		if info.Size() >= rule.MinSize {
+			return rule, true
+		}
+	}
+	return SampleRule{}, false
+}
+
+// 计算文件头尾各n个字节再加上文件大小的哈希
+func sampleFile(path string, size, n int64) (fingerprint, error) {
+	var fp fingerprint
+	f, err := os.Open(path)
+	if err != nil {
+		return fp, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if size <= 2*n {
+		if _, err := io.Copy(h, f); err != nil {
+			return fp, err
+		}
+	} else {
+		if _, err := io.Copy(h, io.NewSectionReader(f, 0, n)); err != nil {
+			return fp, err
+		}
+		if _, err := io.Copy(h, io.NewSectionReader(f, size-n, n)); err != nil {
+			return fp, err
+		}
+	}
+	binary.Write(h, binary.LittleEndian, size)
+	copy(fp[:], h.Sum(nil))
+	return fp, nil
+}
+
+// 记录文件当前的指纹，调用的时候需要持有w.mu
+func (w *Watcher) loadFingerprint(path string, info os.FileInfo) {
+	if w.fingerprints == nil {
+		return
+	}
+	rule, found := w.sampleRule(info)
+	if !found {
+		delete(w.fingerprints, path)
+		return
+	}
+	if fp, err := sampleFile(path, info.Size(), rule.Bytes); err == nil {
+		w.fingerprints[path] = fp
+	}
+}
+
+// 判断文件内容是否发生了变化，同时返回做出判断的比较，调用的时候需要持有w.mu
+// Hash模式下不超过大小上限的文件比较哈希，命中抽样规则的文件比较指纹，其他文件比较修改时间
+func (w *Watcher) contentChanged(path string, oldInfo, info os.FileInfo) (bool, string) {
+	if changed, reason, found := w.hashChanged(path, oldInfo, info); found {
+		return changed, reason
+	}
+	modified := oldInfo.ModTime() != info.ModTime()
+	rule, found := w.sampleRule(info)
+	if !found || w.fingerprints == nil {
+		return modified, modtimeReason(modified, "")
+	}
+	fp, err := sampleFile(path, info.Size(), rule.Bytes)
+	if err != nil {
+		return modified, modtimeReason(modified, fmt.Sprintf(" (fingerprint failed: %v)", err))
+	}
+	old, found := w.fingerprints[path]
+	w.fingerprints[path] = fp
+	switch {
+	case !found:
+		return modified, modtimeReason(modified, " (no previous fingerprint)")
+	case old != fp:
+		return true, "sampled fingerprint changed"
+	}
+	// 抽样只覆盖头尾，中间被改写时指纹不变，修改时间变了仍然算作变化
+	return modified, modtimeReason(modified, "")
+}
+
+// 退回到比较修改时间时的原因，修改时间没有变化并且没有其他说明时返回空
+func modtimeReason(modified bool, detail string) string {
+	switch {
+	case modified:
+		return "modtime changed" + detail
+	case detail != "":
+		return "modtime unchanged" + detail
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentChangedReason(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldInfo, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := New()
+	if changed, reason := w.contentChanged(path, oldInfo, oldInfo); changed || reason != "" {
+		t.Errorf("unchanged file: got %v %q, want false \"\"", changed, reason)
+	}
+
+	later := oldInfo.ModTime().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed, reason := w.contentChanged(path, oldInfo, info); !changed || reason != "modtime changed" {
+		t.Errorf("touched file: got %v %q, want true \"modtime changed\"", changed, reason)
+	}
+
+	// 哈希失败时退回到修改时间，原因要和结果一致
+	w.SetChangeDetection(Hash)
+	os.Remove(path)
+	if changed, reason := w.contentChanged(path, oldInfo, oldInfo); changed || !strings.HasPrefix(reason, "modtime unchanged (hash failed") {
+		t.Errorf("hash failed on unchanged modtime: got %v %q", changed, reason)
+	}
+}
+
+func TestSampledFingerprintOnlyAddsDetection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big")
+	data := make([]byte, 4096)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := New()
+	w.SampleLargeFiles(SampleRule{MinSize: 1024, Bytes: 16})
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.loadFingerprint(path, info)
+
+	// 改写中间的字节，抽样不变，修改时间变了仍然要报告
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("x"), 2048)
+	f.Close()
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(path, later, later)
+	middle, _ := os.Lstat(path)
+	if changed, reason := w.contentChanged(path, info, middle); !changed {
+		t.Errorf("middle write with new modtime not detected (%q)", reason)
+	}
+
+	// 改写头部并保留修改时间，只有指纹能发现
+	f, _ = os.OpenFile(path, os.O_WRONLY, 0)
+	f.WriteAt([]byte("y"), 0)
+	f.Close()
+	os.Chtimes(path, later, later)
+	head, _ := os.Lstat(path)
+	if changed, reason := w.contentChanged(path, middle, head); !changed || reason != "sampled fingerprint changed" {
+		t.Errorf("mtime-preserving head write: got %v %q", changed, reason)
+	}
+	if changed, reason := w.contentChanged(path, head, head); changed || reason != "" {
+		t.Errorf("unchanged file: got %v %q", changed, reason)
+	}
+}
@@ -0,0 +1,82 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 一个Follow的路径上一次看到的文件，文件不存在时为nil
+type followState struct {
+	info os.FileInfo
+}
+
+// Follow 按路径跟踪一个文件，和tail -F一样：文件被改名、删除或者被原子替换之后，路径上出现的新文件会继续被跟踪，
+// 并发送一个Reattached事件，Detail里是新文件的标识(设备号:inode)；同一个文件的修改发送Write，
+// 文件消失时发送一次Remove。路径暂时不存在也可以Follow，出现之后发送Reattached
+func (w *Watcher) Follow(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.followed == nil {
+		w.followed = make(map[string]*followState)
+	}
+	w.followed[path] = &followState{info: info}
+	return nil
+}
+
+// 停止跟踪通过Follow添加的路径
+func (w *Watcher) Unfollow(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	delete(w.followed, path)
+	w.mu.Unlock()
+	return nil
+}
+
+// 检查Follow的路径，调用的时候需要持有w.mu
+func (w *Watcher) followEvents() []Event {
+	paths := make([]string, 0, len(w.followed))
+	for path := range w.followed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var events []Event
+	for _, path := range paths {
+		st := w.followed[path]
+		info, err := os.Stat(path)
+		if err != nil {
+			if st.info != nil && os.IsNotExist(err) {
+				w.trace(path, Remove, "detected: followed file disappeared")
+				events = append(events, Event{Op: Remove, Path: path, FileInfo: st.info})
+				st.info = nil
+			}
+			continue
+		}
+		switch {
+		case st.info == nil || !sameFile(st.info, info):
+			detail := "new file at followed path"
+			if id := identity(info); id != "" {
+				detail += ", identity " + id
+			}
+			w.trace(path, Reattached, "detected: %s", detail)
+			events = append(events, Event{Op: Reattached, Path: path, FileInfo: info, Detail: detail})
+		case st.info.ModTime() != info.ModTime() || st.info.Size() != info.Size():
+			w.trace(path, Write, "detected: followed file changed")
+			events = append(events, Event{Op: Write, Path: path, FileInfo: info})
+		}
+		st.info = info
+	}
+	return events
+}
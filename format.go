@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	formatterMu sync.RWMutex
+	formatter   func(Event) string
+)
+
+// 设置Event.String()使用的格式化函数，比如FormatCompact、FormatVerbose或者FormatRelative(base)，
+// f为nil时恢复默认的FormatDefault
+func SetEventFormatter(f func(Event) string) {
+	formatterMu.Lock()
+	formatter = f
+	formatterMu.Unlock()
+}
+
+func (e Event) String() string {
+	formatterMu.RLock()
+	f := formatter
+	formatterMu.RUnlock()
+	if f == nil {
+		f = FormatDefault
+	}
+	return f(e)
+}
+
+// FormatDefault 是默认的格式，例如 FILE "a.txt" WRITE [/tmp/a.txt]
+func FormatDefault(e Event) string {
+	if e.FileInfo == nil {
+		return fmt.Sprintf("%s [%s]", e.Op, e.Path)
+	}
+	pathType := "FILE"
+	if e.IsDir() {
+		pathType = "DIRECTORY"
+	}
+	return fmt.Sprintf("%s %q %s [%s]", pathType, e.Name(), e.Op, e.Path)
+}
+
+// FormatCompact 只输出事件类型和路径，例如 WRITE /tmp/a.txt
+func FormatCompact(e Event) string {
+	return fmt.Sprintf("%s %s", e.Op, e.Path)
+}
+
+// FormatVerbose 输出事件类型、路径以及文件的大小、权限、修改时间和变化的key
+func FormatVerbose(e Event) string {
+	if e.FileInfo == nil {
+		return FormatCompact(e)
+	}
+	pathType := "file"
+	if e.IsDir() {
+		pathType = "dir"
+	}
+	s := fmt.Sprintf("%s %s (%s, %d bytes, %s, modified %s",
+		e.Op, e.Path, pathType, e.Size(), e.Mode(), e.ModTime().Format("2006-01-02T15:04:05.000Z07:00"))
+	if len(e.ChangedKeys) > 0 {
+		s += ", keys " + strings.Join(e.ChangedKeys, ",")
+	}
+	return s + ")"
+}
+
+// FormatRelative 返回一个格式化函数，和FormatCompact一样但是路径相对于base，
+// 不在base下面的路径保持不变
+func FormatRelative(base string) func(Event) string {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(base, path); err == nil && !strings.HasPrefix(r, "..") {
+			return r
+		}
+		return path
+	}
+	return func(e Event) string {
+		// Rename和Move的路径是 "旧路径 -> 新路径"
+		parts := eventPaths(e)
+		for i, part := range parts {
+			parts[i] = rel(part)
+		}
+		return fmt.Sprintf("%s %s", e.Op, strings.Join(parts, " -> "))
+	}
+}
@@ -0,0 +1,178 @@
+package watcher
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 路径里是否有通配符
+func hasMeta(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// 判断name是否匹配pattern，语法和filepath.Match一样，另外 ** 可以匹配任意多层目录(包括0层)
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(filepath.ToSlash(pattern), "/"), strings.Split(filepath.ToSlash(name), "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// 返回模式里不含通配符的目录前缀，以及匹配的路径是否可能在更深的子目录里
+func splitGlob(pattern string) (base string, recursive bool) {
+	segments := strings.Split(pattern, string(filepath.Separator))
+	i := 0
+	for i < len(segments) && !hasMeta(segments[i]) {
+		i++
+	}
+	base = strings.Join(segments[:i], string(filepath.Separator))
+	if base == "" {
+		base = string(filepath.Separator)
+	}
+	rest := segments[i:]
+	recursive = len(rest) > 1
+	for _, s := range rest {
+		if s == "**" {
+			recursive = true
+		}
+	}
+	return base, recursive
+}
+
+// 添加一个glob模式，模式里不含通配符的目录作为root，root下只跟踪匹配模式的文件，
+// 每一轮扫描重新匹配，之后新出现的匹配文件会以Create事件发送
+func (w *Watcher) addGlob(pattern string) error {
+	pattern, err := filepath.Abs(pattern)
+	if err != nil {
+		return err
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return err
+	}
+	base, recursive := splitGlob(pattern)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.ignoredPath(base) || (w.ignoreHidden && hiddenPath(base)) {
+		return nil
+	}
+	if rootRecursive, found := w.names[base]; found && len(w.includes[base]) == 0 && (rootRecursive || !recursive) {
+		// 已经在监控整个目录了
+		return nil
+	}
+	register, warning := w.checkOverlap(base, recursive)
+	if !register {
+		return warning
+	}
+	if w.includes == nil {
+		w.includes = make(map[string][]string)
+	}
+	w.includes[base] = append(w.includes[base], pattern)
+	recursive = recursive || w.names[base]
+
+	list, err := w.listAdded(base, recursive)
+	if err != nil {
+		w.includes[base] = w.includes[base][:len(w.includes[base])-1]
+		return err
+	}
+	for k, v := range list {
+		if _, found := w.files[k]; !found {
+			w.files[k] = v
+			w.trackFile(k, v)
+		}
+	}
+	w.names[base] = recursive
+	w.setRootStatus(base, recursive, nil)
+	return warning
+}
+
+// 通过glob模式添加的root下，path是否需要跟踪，调用的时候需要持有w.mu
+func (w *Watcher) included(root, path string) bool {
+	patterns := w.includes[root]
+	if len(patterns) == 0 || path == root {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// 添加一个忽略的glob模式，不含路径分隔符的模式(比如*.log)匹配任意目录下的文件名，
+// 其他的按绝对路径匹配；已经跟踪的匹配路径(以及它下面的路径)会被移除
+func (w *Watcher) ignoreGlob(pattern string) error {
+	if !strings.ContainsRune(pattern, filepath.Separator) && !strings.ContainsRune(pattern, '/') {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if pattern, err = filepath.Abs(pattern); err != nil {
+			return err
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ignoreGlobs = append(w.ignoreGlobs, pattern)
+	for path := range w.files {
+		if w.ignoredGlobTree(path) {
+			delete(w.files, path)
+			w.untrackFile(path)
+			delete(w.names, path)
+			delete(w.roots, path)
+		}
+	}
+	return nil
+}
+
+// path是否匹配忽略的glob模式，调用的时候需要持有w.mu
+func (w *Watcher) ignoredGlob(path string) bool {
+	for _, pattern := range w.ignoreGlobs {
+		if filepath.IsAbs(pattern) {
+			if matchGlob(pattern, path) {
+				return true
+			}
+		} else if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// path或者它的上级目录是否匹配忽略的glob模式，调用的时候需要持有w.mu
+func (w *Watcher) ignoredGlobTree(path string) bool {
+	for p := path; ; p = filepath.Dir(p) {
+		if w.ignoredGlob(p) {
+			return true
+		}
+		if filepath.Dir(p) == p {
+			return false
+		}
+	}
+}
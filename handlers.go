@@ -0,0 +1,143 @@
+package watcher
+
+import "hash/fnv"
+
+// 每个处理事件的worker缓冲的事件数
+const handlerQueueSize = 64
+
+// 设置运行事件和错误处理函数的worker数，小于1时按1处理，默认1个，这时处理函数按事件发送的顺序调用；
+// 多个worker时同一个路径的事件总是交给同一个worker，同一个文件的事件仍然按顺序处理
+// 需要在开始监控之前调用
+func (w *Watcher) SetHandlerWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	w.handlerMu.Lock()
+	w.handlerWorkers = n
+	w.handlerMu.Unlock()
+}
+
+// 注册处理所有事件的函数；注册了任何事件处理函数之后，事件交给处理函数，不再发送到w.Event，
+// 不需要自己写读取channel的循环；处理函数不能再注册处理函数
+func (w *Watcher) OnEvent(fn HandlerFunc) {
+	w.handlers.HandleAll(fn)
+	w.handlerMu.Lock()
+	w.handling = true
+	w.handlerMu.Unlock()
+}
+
+// 为某一种事件注册处理函数，按类型注册的函数在OnEvent注册的函数之前调用
+func (w *Watcher) On(op Op, fn HandlerFunc) {
+	w.handlers.Handle(op, fn)
+	w.handlerMu.Lock()
+	w.handling = true
+	w.handlerMu.Unlock()
+}
+
+// 注册处理Create事件的函数
+func (w *Watcher) OnCreate(fn HandlerFunc) { w.On(Create, fn) }
+
+// 注册处理Write事件的函数
+func (w *Watcher) OnWrite(fn HandlerFunc) { w.On(Write, fn) }
+
+// 注册处理Remove事件的函数
+func (w *Watcher) OnRemove(fn HandlerFunc) { w.On(Remove, fn) }
+
+// 注册处理Rename事件的函数
+func (w *Watcher) OnRename(fn HandlerFunc) { w.On(Rename, fn) }
+
+// 注册处理Chmod事件的函数
+func (w *Watcher) OnChmod(fn HandlerFunc) { w.On(Chmod, fn) }
+
+// 注册处理Chown事件的函数
+func (w *Watcher) OnChown(fn HandlerFunc) { w.On(Chown, fn) }
+
+// 注册处理Move事件的函数
+func (w *Watcher) OnMove(fn HandlerFunc) { w.On(Move, fn) }
+
+// 注册处理错误的函数，注册之后错误交给fn，不再发送到w.Error
+func (w *Watcher) OnError(fn func(error)) {
+	w.handlers.HandleError(fn)
+	w.handlerMu.Lock()
+	w.handlingErrors = fn != nil
+	w.handlerMu.Unlock()
+}
+
+// 把事件交给处理函数，没有注册处理函数时返回false
+func (w *Watcher) handleEvent(e Event) bool {
+	h := fnv.New32a()
+	h.Write([]byte(e.Path))
+	return w.runHandler(false, h.Sum32(), func() { w.handlers.Dispatch(e) })
+}
+
+// 把错误交给处理函数，没有注册处理函数时返回false
+func (w *Watcher) handleError(err error) bool {
+	return w.runHandler(true, 0, func() {
+		w.handlers.mu.Lock()
+		onError := w.handlers.onError
+		w.handlers.mu.Unlock()
+		if onError != nil {
+			onError(err)
+		}
+	})
+}
+
+// 把job交给第shard%workers个worker，isError表示job处理的是错误
+func (w *Watcher) runHandler(isError bool, shard uint32, job func()) bool {
+	w.handlerMu.Lock()
+	enabled := w.handling
+	if isError {
+		enabled = w.handlingErrors
+	}
+	if !enabled {
+		w.handlerMu.Unlock()
+		return false
+	}
+	if w.handlerQueues == nil {
+		w.startHandlers()
+	}
+	queue := w.handlerQueues[shard%uint32(len(w.handlerQueues))]
+	done := w.handlersDone
+	w.handlerMu.Unlock()
+
+	select {
+	case queue <- job:
+	case <-done:
+	}
+	return true
+}
+
+// 启动worker，调用的时候需要持有w.handlerMu
+func (w *Watcher) startHandlers() {
+	n := w.handlerWorkers
+	if n < 1 {
+		n = 1
+	}
+	w.handlersDone = make(chan struct{})
+	w.handlerQueues = make([]chan func(), n)
+	for i := range w.handlerQueues {
+		queue := make(chan func(), handlerQueueSize)
+		w.handlerQueues[i] = queue
+		go func(done chan struct{}) {
+			for {
+				select {
+				case job := <-queue:
+					job()
+				case <-done:
+					return
+				}
+			}
+		}(w.handlersDone)
+	}
+}
+
+// 停止worker，还没有处理的事件会被丢掉
+func (w *Watcher) stopHandlers() {
+	w.handlerMu.Lock()
+	defer w.handlerMu.Unlock()
+	if w.handlerQueues == nil {
+		return
+	}
+	close(w.handlersDone)
+	w.handlerQueues = nil
+}
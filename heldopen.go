@@ -0,0 +1,45 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 当前平台不支持检测被删除但仍然打开的文件时，DetectHeldOpen返回这个错误
+var ErrHeldOpenUnsupported = errors.New("error: detecting files held open is not supported on this platform")
+
+// 设置是否检测被删除但仍然被进程打开的文件("磁盘满了却找不到大文件"的常见原因)，
+// 开启后被删除的普通文件如果还有进程打开着，在Remove事件之后发送一个HeldOpen事件，Detail里列出进程号
+// 只支持Linux，通过/proc检查，看不到其他用户进程的时候只能发现自己有权限看到的
+func (w *Watcher) DetectHeldOpen(enable bool) error {
+	if enable && !heldOpenSupported {
+		return ErrHeldOpenUnsupported
+	}
+	w.mu.Lock()
+	w.detectHeldOpen = enable
+	w.mu.Unlock()
+	return nil
+}
+
+// 为仍然被打开的已删除文件返回HeldOpen事件，调用的时候需要持有w.mu
+func (w *Watcher) heldOpen(removes map[string]os.FileInfo) []Event {
+	if !w.detectHeldOpen || len(removes) == 0 {
+		return nil
+	}
+	holders := openHolders(removes)
+	var events []Event
+	for path, pids := range holders {
+		sort.Ints(pids)
+		s := make([]string, len(pids))
+		for i, pid := range pids {
+			s[i] = fmt.Sprint(pid)
+		}
+		detail := "deleted but held open by pid " + strings.Join(s, ", ")
+		w.trace(path, HeldOpen, "detected: %s", detail)
+		events = append(events, Event{Op: HeldOpen, Path: path, FileInfo: removes[path], Detail: detail})
+	}
+	return events
+}
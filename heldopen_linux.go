@@ -0,0 +1,75 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const heldOpenSupported = true
+
+// 遍历/proc/<pid>/fd，找出还打开着removed里的文件的进程，按文件的设备和inode匹配
+func openHolders(removed map[string]os.FileInfo) map[string][]int {
+	ids := make(map[[2]uint64]string)
+	for path, info := range removed {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if dev, ino, ok := fileID(info); ok {
+			ids[[2]uint64{dev, ino}] = path
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	procs, err := readNames("/proc")
+	if err != nil {
+		return nil
+	}
+	holders := make(map[string][]int)
+	for _, name := range procs {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		dir := filepath.Join("/proc", name, "fd")
+		// 没有权限或者进程已经退出的跳过
+		fds, err := readNames(dir)
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, fd := range fds {
+			link := filepath.Join(dir, fd)
+			target, err := os.Readlink(link)
+			if err != nil || !strings.HasSuffix(target, " (deleted)") {
+				continue
+			}
+			// Stat会跟随到已经删除的inode上
+			info, err := os.Stat(link)
+			if err != nil {
+				continue
+			}
+			dev, ino, ok := fileID(info)
+			if !ok {
+				continue
+			}
+			if path, found := ids[[2]uint64{dev, ino}]; found && !seen[path] {
+				seen[path] = true
+				holders[path] = append(holders[path], pid)
+			}
+		}
+	}
+	return holders
+}
+
+func readNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+import "os"
+
+const heldOpenSupported = false
+
+func openHolders(removed map[string]os.FileInfo) map[string][]int {
+	return nil
+}
@@ -0,0 +1,28 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 名字是否以.开头，.和..本身不算
+func dotName(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// path是否是隐藏文件：名字以.开头，或者带有平台的隐藏属性(Windows的FILE_ATTRIBUTE_HIDDEN，macOS和FreeBSD的UF_HIDDEN)
+func isHidden(path string, info os.FileInfo) bool {
+	return dotName(filepath.Base(path)) || (info != nil && hiddenAttr(info))
+}
+
+// path的任意一级是否是隐藏的，用来判断Add的root；上级目录只看名字，path本身还检查隐藏属性
+func hiddenPath(path string) bool {
+	for p := path; filepath.Dir(p) != p; p = filepath.Dir(p) {
+		if dotName(filepath.Base(p)) {
+			return true
+		}
+	}
+	info, err := os.Lstat(path)
+	return err == nil && hiddenAttr(info)
+}
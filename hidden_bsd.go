@@ -0,0 +1,17 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+// chflags hidden设置的标志
+const ufHidden = 0x8000
+
+func hiddenAttr(info os.FileInfo) bool {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	return ok && st.Flags&ufHidden != 0
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !darwin && !freebsd
+// +build !windows,!darwin,!freebsd
+
+package watcher
+
+import "os"
+
+func hiddenAttr(info os.FileInfo) bool {
+	return false
+}
@@ -0,0 +1,11 @@
+package watcher
+
+import (
+	"os"
+	"syscall"
+)
+
+func hiddenAttr(info os.FileInfo) bool {
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
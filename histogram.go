@@ -0,0 +1,70 @@
+package watcher
+
+import "time"
+
+// 保留最近多少次扫描的耗时
+const scanHistorySize = 1024
+
+// 扫描耗时直方图的桶上界
+var scanBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram 是最近若干次扫描耗时的分布
+type Histogram struct {
+	Buckets []time.Duration // 每个桶的上界
+	Counts  []uint64        // 每个桶里的扫描次数，比Buckets多一个，最后一个是超过所有上界的
+	Count   uint64          // 统计的扫描次数
+	Sum     time.Duration   // 统计的扫描总耗时
+	Max     time.Duration   // 最长的一次扫描耗时
+}
+
+// 返回扫描的平均耗时
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// 返回最近1024次扫描耗时的直方图，可以用来根据实际数据调整轮询间隔
+func (w *Watcher) ScanHistogram() Histogram {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	h := Histogram{
+		Buckets: scanBuckets,
+		Counts:  make([]uint64, len(scanBuckets)+1),
+	}
+	for _, d := range w.scanHistory {
+		i := 0
+		for i < len(scanBuckets) && d > scanBuckets[i] {
+			i++
+		}
+		h.Counts[i]++
+		h.Count++
+		h.Sum += d
+		if d > h.Max {
+			h.Max = d
+		}
+	}
+	return h
+}
+
+// 记录一次扫描的耗时，调用的时候需要持有w.statsMu
+func (w *Watcher) recordScanDuration(d time.Duration) {
+	if len(w.scanHistory) < scanHistorySize {
+		w.scanHistory = append(w.scanHistory, d)
+		return
+	}
+	w.scanHistory[w.scanHistoryNext] = d
+	w.scanHistoryNext = (w.scanHistoryNext + 1) % scanHistorySize
+}
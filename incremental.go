@@ -0,0 +1,74 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 一个目录上一次读取的条目
+type cachedDir struct {
+	modTime time.Time
+	infos   []os.FileInfo
+}
+
+// 一个root的增量扫描缓存
+type rootCache struct {
+	dirs  map[string]cachedDir
+	walks int // 已经遍历的次数
+}
+
+// 设置增量扫描：递归监控时修改时间没有变化的目录不再重新读取，直接沿用上一次读到的条目，
+// 子目录仍然会重新lstat，所以任何一层新建、删除、改名的文件都能发现；但是目录没有变化时，
+// 里面的文件就地修改(内容或权限)要等到每fullEvery轮一次的完整扫描才能发现，编辑器通常写临时文件再改名，不受影响
+// fullEvery小于等于0时关闭增量扫描，默认关闭；对几乎不变的大目录树可以省掉大部分读目录的开销
+func (w *Watcher) SetIncremental(fullEvery int) {
+	w.mu.Lock()
+	w.fullEvery = fullEvery
+	w.dirCache = nil
+	w.mu.Unlock()
+}
+
+// 增量遍历name，调用的时候需要持有w.mu
+func (w *Watcher) walkIncremental(name string, walk filepath.WalkFunc) error {
+	if w.dirCache == nil {
+		w.dirCache = make(map[string]*rootCache)
+	}
+	cache := w.dirCache[name]
+	if cache == nil {
+		cache = &rootCache{}
+		w.dirCache[name] = cache
+	}
+	old := cache.dirs
+	if cache.walks%w.fullEvery == 0 {
+		old = nil
+	}
+	cache.walks++
+
+	dirs := make(map[string]cachedDir)
+	read := func(path string, info os.FileInfo) ([]os.FileInfo, error) {
+		cached, found := old[path]
+		if !found || !cached.modTime.Equal(info.ModTime()) {
+			return readDir(path, info)
+		}
+		infos := make([]os.FileInfo, 0, len(cached.infos))
+		for _, child := range cached.infos {
+			// 子目录要用最新的修改时间判断它自己有没有变化
+			if child.IsDir() {
+				fresh, err := os.Lstat(filepath.Join(path, child.Name()))
+				if err != nil {
+					continue
+				}
+				child = fresh
+			}
+			infos = append(infos, child)
+		}
+		return infos, nil
+	}
+	listed := func(r dirListing) {
+		dirs[r.path] = cachedDir{modTime: r.info.ModTime(), infos: r.infos}
+	}
+	err := walkParallel(name, w.concurrency, read, listed, walk)
+	cache.dirs = dirs
+	return err
+}
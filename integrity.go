@@ -0,0 +1,229 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 受保护文件的基线
+type baseline struct {
+	sum      [sha256.Size]byte
+	mode     os.FileMode
+	uid, gid int
+	hasOwner bool
+	info     os.FileInfo // 记录基线时的文件信息，文件被删除之后用于Alert事件
+}
+
+func readBaseline(path string, info os.FileInfo) (baseline, error) {
+	b := baseline{mode: info.Mode(), info: info}
+	b.uid, b.gid, b.hasOwner = fileOwner(info)
+	if info.IsDir() {
+		return b, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return b, err
+	}
+	copy(b.sum[:], h.Sum(nil))
+	return b, nil
+}
+
+// 和基线对比，返回不一致的地方，一致的时候返回空字符串
+func (b baseline) diff(cur baseline) string {
+	var diffs []string
+	if b.sum != cur.sum {
+		diffs = append(diffs, "content changed")
+	}
+	if b.mode != cur.mode {
+		diffs = append(diffs, fmt.Sprintf("mode changed %s -> %s", b.mode, cur.mode))
+	}
+	if b.hasOwner && cur.hasOwner && (b.uid != cur.uid || b.gid != cur.gid) {
+		diffs = append(diffs, fmt.Sprintf("owner changed %d:%d -> %d:%d", b.uid, b.gid, cur.uid, cur.gid))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// Protect 把路径作为关键路径递归监控，并记录其中每个文件的校验和、权限和属主作为基线
+// 之后每一轮扫描都会重新计算这些文件的校验和，和基线不一致的时候除了普通事件还会发送一个Alert事件，
+// Detail里说明哪里不一致，同样的不一致只报告一次；保留修改时间的改动也能发现，
+// 但是每一轮都要完整读取受保护的文件，适合用来做轻量的主机文件完整性监控(比如/etc和二进制文件)；
+// 设置了ScanAsUser时不能使用
+func (w *Watcher) Protect(paths ...string) error {
+	w.mu.Lock()
+	err := w.refuseContent("Protect")
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		// 已经被其他root覆盖的路径不影响保护
+		if err := w.AddRecursive(path); err != nil && !errors.Is(err, ErrRootOverlap) {
+			return err
+		}
+	}
+	return w.AcceptBaseline(paths...)
+}
+
+// AcceptBaseline 把受保护路径下文件的当前状态作为新的基线，用于确认过的合法修改
+func (w *Watcher) AcceptBaseline(paths ...string) error {
+	roots := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, path)
+	}
+
+	w.mu.Lock()
+	if err := w.refuseContent("Protect"); err != nil {
+		w.mu.Unlock()
+		return err
+	}
+	files := make(map[string]os.FileInfo)
+	for _, root := range roots {
+		for name, info := range w.files {
+			if underPath(name, root) {
+				files[name] = info
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	// 读取文件内容的时候不持有w.mu
+	baselines := make(map[string]baseline, len(files))
+	for name, info := range files {
+		b, err := readBaseline(name, info)
+		if err != nil {
+			return err
+		}
+		baselines[name] = b
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.protected == nil {
+		w.protected = make(map[string]bool)
+		w.baselines = make(map[string]baseline)
+		w.alerted = make(map[string]string)
+	}
+	for _, root := range roots {
+		w.protected[root] = true
+		for name := range w.baselines {
+			if underPath(name, root) {
+				delete(w.baselines, name)
+			}
+		}
+		for name := range w.alerted {
+			if underPath(name, root) {
+				delete(w.alerted, name)
+			}
+		}
+	}
+	for name, b := range baselines {
+		w.baselines[name] = b
+	}
+	return nil
+}
+
+// 判断name是不是root或者在root下面
+func underPath(name, root string) bool {
+	return name == root || strings.HasPrefix(name, root+string(filepath.Separator))
+}
+
+func (w *Watcher) isProtected(path string) bool {
+	for root := range w.protected {
+		if underPath(path, root) {
+			return true
+		}
+	}
+	return false
+}
+
+// 事件涉及的路径，Rename和Move的路径是 "旧路径 -> 新路径"
+func eventPaths(e Event) []string {
+	if e.OldPath != "" {
+		return []string{e.OldPath, e.NewPath}
+	}
+	return strings.Split(e.Path, " -> ")
+}
+
+// 检查这一轮扫描到的受保护文件是否和基线一致，返回新出现的不一致对应的Alert事件，
+// 读取文件内容的时候不持有w.mu，调用的时候不能持有w.mu
+func (w *Watcher) checkIntegrity(files map[string]os.FileInfo) []Event {
+	type target struct {
+		path  string
+		b     baseline
+		found bool
+	}
+	w.mu.Lock()
+	if len(w.protected) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	var targets []target
+	for path := range files {
+		if w.isProtected(path) {
+			b, found := w.baselines[path]
+			targets = append(targets, target{path: path, b: b, found: found})
+		}
+	}
+	for path, b := range w.baselines {
+		// 基线里有，这一轮没有列出的文件
+		if _, listed := files[path]; !listed && w.isProtected(path) {
+			targets = append(targets, target{path: path, b: b, found: true})
+		}
+	}
+	w.mu.Unlock()
+	sort.Slice(targets, func(i, j int) bool { return targets[i].path < targets[j].path })
+
+	details := make([]string, len(targets))
+	infos := make([]os.FileInfo, len(targets))
+	for i, t := range targets {
+		info, err := os.Lstat(t.path)
+		switch {
+		case err != nil && t.found:
+			details[i], infos[i] = "removed", t.b.info
+		case err != nil:
+			continue
+		case !t.found:
+			details[i], infos[i] = "not in baseline", info
+		default:
+			infos[i] = info
+			if cur, err := readBaseline(t.path, info); err != nil {
+				details[i] = fmt.Sprintf("unreadable: %v", err)
+			} else {
+				details[i] = t.b.diff(cur)
+			}
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var events []Event
+	for i, t := range targets {
+		detail := details[i]
+		if !w.isProtected(t.path) || w.alerted[t.path] == detail {
+			continue
+		}
+		if detail == "" {
+			delete(w.alerted, t.path)
+			continue
+		}
+		w.alerted[t.path] = detail
+		w.trace(t.path, Alert, "detected: %s", detail)
+		events = append(events, Event{Op: Alert, Path: t.path, FileInfo: infos[i], Detail: detail})
+	}
+	return events
+}
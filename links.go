@@ -0,0 +1,30 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+)
+
+// 设置是否跟踪文件的硬链接数，开启后链接数变化时发送Link事件，
+// 链接数增加说明在别的地方给这个文件创建了硬链接，对去重工具和安全监控都有用
+// 目录的链接数会随着子目录的增减变化，所以只跟踪非目录的文件，在不能获得链接数的平台上(Windows)没有效果
+func (w *Watcher) TrackLinks(enable bool) {
+	w.mu.Lock()
+	w.trackLinks = enable
+	w.mu.Unlock()
+}
+
+// 硬链接数变化时返回Link事件，调用的时候需要持有w.mu
+func (w *Watcher) linkCount(path string, oldInfo, info os.FileInfo) (Event, bool) {
+	if !w.trackLinks || info.IsDir() {
+		return Event{}, false
+	}
+	oldLinks, ok1 := fileLinks(oldInfo)
+	links, ok2 := fileLinks(info)
+	if !ok1 || !ok2 || oldLinks == links {
+		return Event{}, false
+	}
+	detail := fmt.Sprintf("link count %d -> %d", oldLinks, links)
+	w.trace(path, Link, "detected: %s", detail)
+	return Event{Op: Link, Path: path, FileInfo: info, Detail: detail}, true
+}
@@ -0,0 +1,210 @@
+// livereload 在watcher的事件流上实现了LiveReload协议(official-7)，
+// 现有的LiveReload浏览器插件和编辑器连上之后，被监控的文件变化时会自动刷新页面
+package livereload
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pythonsite/watcher"
+)
+
+// DefaultAddr 是LiveReload插件默认连接的地址
+const DefaultAddr = ":35729"
+
+const protocol = "http://livereload.com/protocols/official-7"
+
+// Server 是LiveReload服务，实现了http.Handler，通常挂在 /livereload 上
+type Server struct {
+	mu      sync.Mutex
+	clients map[*wsConn]bool // 已经完成hello握手的连接
+	liveCSS bool
+	root    string          // 通知里的路径相对于root
+	origins map[string]bool // 除了同源之外允许连接的Origin
+}
+
+// 创建一个LiveReload服务，默认开启CSS热替换(只有CSS变化时不刷新整个页面)，只接受同源的页面连接
+func New() *Server {
+	return &Server{clients: make(map[*wsConn]bool), liveCSS: true, origins: make(map[string]bool)}
+}
+
+// 设置被监控的根目录，通知里的路径相对于root，不在root下面的变化不通知；
+// 没有设置时只通知文件名，服务器上的绝对路径不会发给浏览器
+func (s *Server) SetRoot(root string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.root = root
+	s.mu.Unlock()
+	return nil
+}
+
+// 允许这些Origin的页面连接，比如开发服务器的"http://localhost:8080"或者浏览器插件的Origin；
+// 默认只接受和LiveReload服务同源的页面，不带Origin的客户端(编辑器等)总是可以连接
+func (s *Server) AllowOrigins(origins ...string) {
+	s.mu.Lock()
+	for _, origin := range origins {
+		s.origins[normalizeOrigin(origin)] = true
+	}
+	s.mu.Unlock()
+}
+
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(origin), "/")
+}
+
+// 检查请求的Origin，同源或者在AllowOrigins里的才能连接
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.origins[normalizeOrigin(origin)]
+}
+
+// 把绝对路径转换成通知里的路径，不在root下面时返回false，调用的时候需要持有s.mu
+func (s *Server) relative(path string) (string, bool) {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(path), true
+	}
+	if s.root == "" {
+		return filepath.Base(path), true
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// 设置是否让浏览器热替换CSS而不是刷新整个页面
+func (s *Server) SetLiveCSS(enable bool) {
+	s.mu.Lock()
+	s.liveCSS = enable
+	s.mu.Unlock()
+}
+
+type message struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS,omitempty"`
+}
+
+// ServeHTTP 处理LiveReload客户端的websocket连接，Origin不被允许时返回403
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		http.Error(rw, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	conn, err := upgrade(rw, r)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, conn)
+		s.mu.Unlock()
+		conn.close()
+	}()
+
+	for {
+		data, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if msg.Command != "hello" {
+			// info、url等命令不需要回复
+			continue
+		}
+		reply, _ := json.Marshal(message{
+			Command:    "hello",
+			Protocols:  []string{protocol},
+			ServerName: "watcher",
+		})
+		if err := conn.writeText(reply); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.clients[conn] = true
+		s.mu.Unlock()
+	}
+}
+
+// Reload 通知所有客户端path发生了变化，绝对路径按SetRoot转换成相对路径
+func (s *Server) Reload(path string) {
+	s.mu.Lock()
+	path, ok := s.relative(path)
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	data, _ := json.Marshal(message{Command: "reload", Path: path, LiveCSS: s.liveCSS})
+	clients := make([]*wsConn, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range clients {
+		if err := c.writeText(data); err != nil {
+			c.close()
+		}
+	}
+}
+
+// Serve 从n读取事件，把每个事件转换成reload通知，直到done被关闭，错误会被忽略
+// 对于watcher.Watcher可以把w.Closed作为done
+func (s *Server) Serve(n watcher.Notifier, done <-chan struct{}) {
+	events, errors := n.Events(), n.Errors()
+	for {
+		select {
+		case e := <-events:
+			if e.Op == watcher.Remove {
+				continue
+			}
+			// Rename和Move通知新路径
+			path := e.Path
+			if e.NewPath != "" {
+				path = e.NewPath
+			}
+			s.Reload(path)
+		case <-errors:
+		case <-done:
+			return
+		}
+	}
+}
+
+// ListenAndServe 在addr上启动LiveReload服务，并把n的事件转发给客户端，通知里的路径相对于root，
+// addr为空时使用DefaultAddr；需要接受其他Origin的页面时自己创建Server并调用AllowOrigins
+func ListenAndServe(addr, root string, n watcher.Notifier, done <-chan struct{}) error {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	s := New()
+	if err := s.SetRoot(root); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/livereload", s)
+	go s.Serve(n, done)
+	return http.ListenAndServe(addr, mux)
+}
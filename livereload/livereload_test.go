@@ -0,0 +1,68 @@
+package livereload
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func handshake(t *testing.T, url, origin string) int {
+	t.Helper()
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestOriginCheck(t *testing.T) {
+	s := New()
+	s.AllowOrigins("http://localhost:8080/")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	for _, c := range []struct {
+		origin string
+		want   int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{ts.URL, http.StatusSwitchingProtocols},
+		{"http://LOCALHOST:8080", http.StatusSwitchingProtocols},
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	} {
+		if got := handshake(t, ts.URL, c.origin); got != c.want {
+			t.Errorf("origin %q: got %d, want %d", c.origin, got, c.want)
+		}
+	}
+}
+
+func TestRelativePaths(t *testing.T) {
+	root := t.TempDir()
+	s := New()
+	if path, ok := s.relative(filepath.Join(root, "css", "a.css")); !ok || path != "a.css" {
+		t.Errorf("without root: got %q %v, want a.css", path, ok)
+	}
+	if err := s.SetRoot(root); err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := s.relative(filepath.Join(root, "css", "a.css")); !ok || path != "css/a.css" {
+		t.Errorf("got %q %v, want css/a.css", path, ok)
+	}
+	if path, ok := s.relative(filepath.Join(filepath.Dir(root), "other", "a.css")); ok {
+		t.Errorf("outside root: got %q, want not sent", path)
+	}
+}
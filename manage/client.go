@@ -0,0 +1,61 @@
+package manage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client 是管理接口的客户端
+type Client struct {
+	addr string
+	http *http.Client
+}
+
+// 创建一个连接addr上的管理接口的客户端，addr为空时使用DefaultAddr
+func NewClient(addr string) *Client {
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	return &Client{addr: addr, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// 查询监控状态
+func (c *Client) Status() (Status, error) {
+	var st Status
+	err := c.get("/status", nil, &st)
+	return st, err
+}
+
+// 列出root下被跟踪的文件，root为空时列出所有文件
+func (c *Client) List(root string) ([]Entry, error) {
+	var entries []Entry
+	err := c.get("/ls", url.Values{"root": {root}}, &entries)
+	return entries, err
+}
+
+// 查询since之后发送的事件，since为零值时返回保留的所有事件
+func (c *Client) Recent(since time.Time) ([]Event, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339Nano))
+	}
+	var events []Event
+	err := c.get("/recent", query, &events)
+	return events, err
+}
+
+func (c *Client) get(path string, query url.Values, v interface{}) error {
+	u := url.URL{Scheme: "http", Host: c.addr, Path: path, RawQuery: query.Encode()}
+	resp, err := c.http.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error: %s: %s", u.String(), resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
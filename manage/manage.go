@@ -0,0 +1,163 @@
+// manage 提供watcher常驻进程的管理接口：通过HTTP查询监控的root、文件数、上一次扫描时间和最近的事件，
+// 命令行的 watcher status 和 watcher ls 就是这个接口的客户端
+package manage
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pythonsite/watcher"
+)
+
+// DefaultAddr 是管理接口默认监听的地址，只监听本机
+const DefaultAddr = "127.0.0.1:7394"
+
+// 默认保留的最近事件数
+const defaultRecent = 50
+
+// Status 是 /status 返回的内容
+type Status struct {
+	Roots        []Root            `json:"roots"`
+	Files        int               `json:"files"`
+	Dirs         int               `json:"dirs"`
+	LastScan     time.Time         `json:"lastScan"`     // 最近一次成功扫描的时间
+	ScanDuration time.Duration     `json:"scanDuration"` // 上一次扫描文件列表花费的时间
+	Events       map[string]uint64 `json:"events"`       // 按事件类型统计的已发送事件数
+	Errors       uint64            `json:"errors"`
+	Recent       []Event           `json:"recent"` // 最近的事件，最早的在前面
+}
+
+// Root 是一个被监控的root的状态
+type Root struct {
+	Path      string    `json:"path"`
+	Recursive bool      `json:"recursive"`
+	State     string    `json:"state"`
+	LastScan  time.Time `json:"lastScan"`
+	Err       string    `json:"err,omitempty"`
+}
+
+// Event 是一个已经发送的事件
+type Event struct {
+	Time   time.Time `json:"time"`
+	Op     string    `json:"op"`
+	Path   string    `json:"path"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Entry 是 /ls 返回的一个被跟踪的文件或目录
+type Entry struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	IsDir   bool        `json:"isDir,omitempty"`
+}
+
+// Server 是一个watcher的管理接口，实现了http.Handler：
+//
+//	GET /status             监控状态
+//	GET /ls?root=PATH       被跟踪的文件，root为空时列出所有文件
+//	GET /recent?since=TIME  since(RFC3339格式)之后发送的事件，since为空时返回保留的所有事件
+type Server struct {
+	w *watcher.Watcher
+}
+
+// 创建w的管理接口，会调用w.KeepRecent保留最近的50个事件，需要更多时可以之后再调用w.KeepRecent
+func New(w *watcher.Watcher) *Server {
+	w.KeepRecent(defaultRecent)
+	return &Server{w: w}
+}
+
+// 返回since之后发送的事件
+func (s *Server) Recent(since time.Time) []Event {
+	var events []Event
+	for _, e := range s.w.Recent(since) {
+		events = append(events, Event{Time: e.Time, Op: e.Op.String(), Path: e.Path, Detail: e.Detail})
+	}
+	return events
+}
+
+// 返回当前的监控状态
+func (s *Server) Status() Status {
+	stats := s.w.Stats()
+	st := Status{
+		Files:        stats.Files,
+		Dirs:         stats.Dirs,
+		ScanDuration: stats.LastScan,
+		Events:       make(map[string]uint64, len(stats.Events)),
+		Errors:       stats.Errors,
+	}
+	for op, n := range stats.Events {
+		st.Events[op.String()] = n
+	}
+	for _, root := range s.w.RootStatus() {
+		r := Root{Path: root.Path, Recursive: root.Recursive, State: root.State.String(), LastScan: root.LastScan}
+		if root.Err != nil {
+			r.Err = root.Err.Error()
+		}
+		if root.LastScan.After(st.LastScan) {
+			st.LastScan = root.LastScan
+		}
+		st.Roots = append(st.Roots, r)
+	}
+	st.Recent = s.Recent(time.Time{})
+	return st
+}
+
+// 返回root下被跟踪的文件，按路径排序，root为空时返回所有文件
+func (s *Server) List(root string) []Entry {
+	if root != "" {
+		root = filepath.Clean(root)
+	}
+	var entries []Entry
+	for path, info := range s.w.WatchedFiles() {
+		if root != "" && path != root && !strings.HasPrefix(path, root+string(filepath.Separator)) {
+			continue
+		}
+		entries = append(entries, Entry{Path: path, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime(), IsDir: info.IsDir()})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	return entries
+}
+
+// ServeHTTP 处理管理接口的请求，返回JSON
+func (s *Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var v interface{}
+	switch r.URL.Path {
+	case "/status":
+		v = s.Status()
+	case "/ls":
+		v = s.List(r.URL.Query().Get("root"))
+	case "/recent":
+		var since time.Time
+		if q := r.URL.Query().Get("since"); q != "" {
+			var err error
+			if since, err = time.Parse(time.RFC3339Nano, q); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		v = s.Recent(since)
+	default:
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
+
+// ListenAndServe 在addr上提供w的管理接口，直到出错
+func ListenAndServe(addr string, w *watcher.Watcher) error {
+	return http.ListenAndServe(addr, New(w))
+}
@@ -0,0 +1,179 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ManifestEntry 是清单里的一个文件
+type ManifestEntry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash,omitempty"` // 内容的SHA-256，目录和已删除的文件为空
+}
+
+// Manifest 是一轮扫描期间的变化清单，适合增量备份之类只关心"哪些文件变了"的工具
+type Manifest struct {
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Added    []ManifestEntry `json:"added"`
+	Modified []ManifestEntry `json:"modified"`
+	Removed  []ManifestEntry `json:"removed"`
+}
+
+// 正在收集的清单，一个路径在一轮里只出现一次
+type manifestBuilder struct {
+	start   time.Time
+	changes map[string]Op // 只会是Create、Write或Remove
+	infos   map[string]os.FileInfo
+}
+
+// 开启清单模式，开启后事件不再发送到w.Event，而是按每一轮扫描汇总成Manifest，
+// 没有变化的一轮不产生清单；dir为空时清单保存在内存里，通过Manifests取出，
+// dir不为空时每个清单以JSON格式写到dir下的manifest-<结束时间>.json里，不再保存在内存里，写入失败的错误发送到w.Error
+// 清单里有文件内容的哈希，设置了ScanAsUser时不能开启
+func (w *Watcher) ManifestMode(dir string) error {
+	if dir != "" {
+		var err error
+		if dir, err = filepath.Abs(dir); err != nil {
+			return err
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.refuseContent("ManifestMode"); err != nil {
+		return err
+	}
+	w.manifestMu.Lock()
+	w.manifestMode = true
+	w.manifestDir = dir
+	w.manifestMu.Unlock()
+	return nil
+}
+
+// Manifests 返回还没有被取走的清单，按时间顺序排列，返回之后清空；ManifestMode设置了目录时总是返回nil
+func (w *Watcher) Manifests() []Manifest {
+	w.manifestMu.Lock()
+	defer w.manifestMu.Unlock()
+	manifests := w.manifests
+	w.manifests = nil
+	return manifests
+}
+
+// 如果开启了清单模式返回一个新的builder，否则返回nil
+func (w *Watcher) newManifest(start time.Time) *manifestBuilder {
+	w.manifestMu.Lock()
+	defer w.manifestMu.Unlock()
+	if !w.manifestMode {
+		return nil
+	}
+	return &manifestBuilder{start: start, changes: make(map[string]Op), infos: make(map[string]os.FileInfo)}
+}
+
+// 把事件记到清单里，Rename和Move记成旧路径删除、新路径添加
+func (m *manifestBuilder) add(e Event) {
+	paths := eventPaths(e)
+	switch e.Op {
+	case Rename, Move, ChildMoved:
+		if len(paths) == 2 {
+			m.set(paths[0], Remove, e.FileInfo)
+			m.set(paths[1], Create, e.FileInfo)
+		}
+	case Create, Remove:
+		m.set(e.Path, e.Op, e.FileInfo)
+	case Write, Chmod, Chown, Rotated, Truncate, Append:
+		m.set(e.Path, Write, e.FileInfo)
+	}
+}
+
+func (m *manifestBuilder) set(path string, op Op, info os.FileInfo) {
+	switch prev, found := m.changes[path]; {
+	case !found:
+	case prev == Create && op == Write:
+		// 新建之后又修改的还是算新建
+		op = Create
+	case prev == Create && op == Remove:
+		// 一轮之内新建又删除的不出现在清单里
+		delete(m.changes, path)
+		delete(m.infos, path)
+		return
+	case prev == Remove && op == Create:
+		op = Write
+	}
+	m.changes[path] = op
+	m.infos[path] = info
+}
+
+// 计算文件内容的SHA-256
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 生成清单并保存，没有变化时什么都不做
+func (w *Watcher) finishManifest(m *manifestBuilder) {
+	if m == nil || len(m.changes) == 0 {
+		return
+	}
+	manifest := Manifest{Start: m.start, End: w.clock.Now()}
+	paths := make([]string, 0, len(m.changes))
+	for path := range m.changes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		entry := ManifestEntry{Path: path}
+		if info := m.infos[path]; info != nil {
+			entry.Size, entry.ModTime = info.Size(), info.ModTime()
+		}
+		op := m.changes[path]
+		if op != Remove && m.infos[path] != nil && !m.infos[path].IsDir() {
+			// 文件在这一轮之后可能又被删掉了，这时候没有哈希
+			entry.Hash, _ = hashFile(path)
+		}
+		switch op {
+		case Create:
+			manifest.Added = append(manifest.Added, entry)
+		case Write:
+			manifest.Modified = append(manifest.Modified, entry)
+		case Remove:
+			manifest.Removed = append(manifest.Removed, entry)
+		}
+	}
+
+	w.manifestMu.Lock()
+	dir := w.manifestDir
+	if dir == "" {
+		w.manifests = append(w.manifests, manifest)
+	}
+	w.manifestMu.Unlock()
+	if dir == "" {
+		return
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	name := filepath.Join(dir, "manifest-"+manifest.End.UTC().Format("20060102T150405.000000000Z")+".json")
+	if err := ioutil.WriteFile(name, data, 0644); err != nil {
+		// 磁盘满之类的错误可以通过WatchError的类别区分
+		w.sendError(&WatchError{Op: "write manifest", Path: name, Root: dir, Err: err, Class: classifyError(err)})
+	}
+}
@@ -0,0 +1,64 @@
+package watcher
+
+import "unsafe"
+
+// 估算内存时使用的常量，都是64位平台上的近似值
+const (
+	mapEntryOverhead = 48  // map里每个条目的额外开销(桶、tophash等)
+	fileInfoSize     = 200 // 一个os.FileInfo(包括Sys())的大小
+	stringHeaderSize = int64(unsafe.Sizeof(""))
+)
+
+// IndexUsage 是watcher内部索引占用内存的估计值
+type IndexUsage struct {
+	Entries      int   // 索引里的文件和目录数
+	CacheEntries int   // 附加状态(结构化内容、压缩包成员、抽样指纹、哈希等)的条目数
+	Bytes        int64 // 估计占用的字节数
+}
+
+// 返回内部索引占用内存的估计值，用于在一个进程里运行很多watcher的时候做预算和限制
+func (w *Watcher) MemoryUsage() IndexUsage {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var u IndexUsage
+	for path, info := range w.files {
+		u.Entries++
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(path)) + fileInfoSize + int64(len(info.Name()))
+	}
+	for path, flat := range w.structured {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(path))
+		for key := range flat {
+			// 值按一个interface加上一个小对象估算
+			u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(key)) + 32
+		}
+	}
+	for path, entries := range w.archives {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(path))
+		for name := range entries {
+			u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(name)) + fileInfoSize
+		}
+	}
+	for path := range w.fingerprints {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(path)) + int64(len(fingerprint{}))
+	}
+	for path := range w.completion {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(path)) + int64(unsafe.Sizeof(completionState{}))
+	}
+	for path, sum := range w.hashes {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + 2*stringHeaderSize + int64(len(path)) + int64(len(sum))
+	}
+	for path, sum := range w.sums {
+		u.CacheEntries++
+		u.Bytes += mapEntryOverhead + 2*stringHeaderSize + int64(len(path)) + int64(len(sum))
+	}
+	for name := range w.names {
+		u.Bytes += mapEntryOverhead + stringHeaderSize + int64(len(name))
+	}
+	return u
+}
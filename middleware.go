@@ -0,0 +1,26 @@
+package watcher
+
+// Use 添加事件中间件，所有事件在通过过滤之后、发送到w.Event之前依次经过这些中间件，先添加的先执行
+// 中间件和Dispatcher.Use的是同一种，调用next把事件交给下一个中间件，可以修改事件(比如加上哈希或者标签写到Detail里)、
+// 不调用next丢弃事件，或者多次调用next拆分事件；中间件在扫描的goroutine里执行，不要长时间阻塞
+func (w *Watcher) Use(mw ...Middleware) {
+	w.mu.Lock()
+	w.middleware = append(w.middleware, mw...)
+	w.mu.Unlock()
+}
+
+// 把中间件和最终的发送函数串起来
+func (w *Watcher) chain(deliver func(Event)) func(Event) {
+	w.mu.Lock()
+	middleware := w.middleware
+	w.mu.Unlock()
+	return wrapMiddleware(deliver, middleware)
+}
+
+// 用middleware包装h，第一个中间件在最外层
+func wrapMiddleware(h HandlerFunc, middleware []Middleware) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
@@ -0,0 +1,28 @@
+package watcher
+
+import "time"
+
+// Notifier 是Watcher对外的最小接口，应用可以依赖这个接口，在单元测试里换成假的实现，
+// 不用真的启动轮询(watchertest.FakeNotifier就是一个现成的实现)
+type Notifier interface {
+	Add(name string) error
+	AddRecursive(name string) error
+	Remove(name string) error
+	RemoveRecursive(name string) error
+	Start(d time.Duration) error
+	Close()
+	Events() <-chan Event
+	Errors() <-chan error
+}
+
+var _ Notifier = (*Watcher)(nil)
+
+// 返回事件channel，等同于w.Event
+func (w *Watcher) Events() <-chan Event {
+	return w.Event
+}
+
+// 返回错误channel，等同于w.Error
+func (w *Watcher) Errors() <-chan error {
+	return w.Error
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import "os"
+
+// 设置发送Write和Create事件之前是否确认文件已经没有被其他进程打开着写入：
+// 文件不能被独占打开的时候先不发送事件，之后每一轮扫描重新检查，能够独占打开之后再发送，
+// 避免处理到Excel之类的程序还没有写完的文件；只在Windows上有效，其它平台上没有强制的独占打开，设置了也不会推迟事件
+func (w *Watcher) CheckOpenHandles(enable bool) {
+	w.mu.Lock()
+	w.checkOpen = enable
+	if !enable {
+		w.openDeferred = nil
+	}
+	w.mu.Unlock()
+}
+
+// 推迟还被其他进程打开着的文件的Write和Create事件，发送之前推迟的已经可以独占打开的文件的事件，调用的时候需要持有w.mu
+func (w *Watcher) deferOpen(events []Event, files map[string]os.FileInfo) []Event {
+	if !w.checkOpen {
+		return events
+	}
+	if w.openDeferred == nil {
+		w.openDeferred = make(map[string]Op)
+	}
+	deferred := w.openDeferred
+
+	fresh := make(map[string]bool) // 这一轮刚刚推迟的
+	kept := events[:0]
+	for _, e := range events {
+		switch e.Op {
+		case Create, Write:
+			if e.IsDir() || !e.Mode().IsRegular() {
+				break
+			}
+			if op, found := deferred[e.Path]; found {
+				// 推迟的Create之后又有了Write，仍然作为Create发送
+				if op == Create {
+					e.Op = Create
+				}
+				delete(deferred, e.Path)
+			}
+			if !exclusiveOpen(e.Path) {
+				w.trace(e.Path, e.Op, "deferred: file is still open by another process")
+				deferred[e.Path] = e.Op
+				fresh[e.Path] = true
+				continue
+			}
+		case Remove:
+			// 推迟的Create还没有发送，对应的Remove也不用发送了
+			if op, found := deferred[e.Path]; found {
+				delete(deferred, e.Path)
+				if op == Create {
+					continue
+				}
+			}
+		case Rename, Move:
+			paths := eventPaths(e)
+			if op, found := deferred[paths[0]]; found && len(paths) == 2 {
+				delete(deferred, paths[0])
+				deferred[paths[1]] = op
+			}
+		}
+		kept = append(kept, e)
+	}
+
+	for path, op := range deferred {
+		info, found := files[path]
+		if !found {
+			delete(deferred, path)
+			continue
+		}
+		if fresh[path] || !exclusiveOpen(path) {
+			continue
+		}
+		delete(deferred, path)
+		w.trace(path, op, "detected: file is no longer open by another process")
+		kept = append(kept, Event{Op: op, Path: path, FileInfo: info})
+	}
+	return kept
+}
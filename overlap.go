@@ -0,0 +1,94 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 新添加的root和已有的root重叠时返回的错误，需要用errors.Is(err, ErrRootOverlap)判断
+var ErrRootOverlap = errors.New("error: watch root overlaps an existing root")
+
+// OverlapPolicy 决定Add和AddRecursive遇到重叠的root时怎么处理，
+// 重叠是指一个root位于另一个递归root之下，这时同一批文件会被扫描两次、事件也会重复
+type OverlapPolicy uint32
+
+const (
+	OverlapAllow  OverlapPolicy = iota // 不做处理，和以前的行为一样
+	OverlapMerge                       // 合并：被覆盖的root不再单独注册
+	OverlapWarn                        // 照常添加，但是返回OverlapError提醒调用者
+	OverlapReject                      // 不添加，返回OverlapError
+)
+
+var overlapPolicies = map[OverlapPolicy]string{
+	OverlapAllow:  "ALLOW",
+	OverlapMerge:  "MERGE",
+	OverlapWarn:   "WARN",
+	OverlapReject: "REJECT",
+}
+
+func (p OverlapPolicy) String() string {
+	if policy, found := overlapPolicies[p]; found {
+		return policy
+	}
+	return "???"
+}
+
+// OverlapError 说明新添加的root和哪个已有的root重叠
+type OverlapError struct {
+	Root     string // 新添加的root
+	Existing string // 已有的root
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("%s: %s and %s", ErrRootOverlap, e.Root, e.Existing)
+}
+
+func (e *OverlapError) Is(target error) bool {
+	return target == ErrRootOverlap
+}
+
+// 设置遇到重叠的root时的处理方式，默认是OverlapAllow
+func (w *Watcher) SetOverlapPolicy(p OverlapPolicy) {
+	w.mu.Lock()
+	w.overlapPolicy = p
+	w.mu.Unlock()
+}
+
+// 按照重叠策略检查name，返回是否需要注册name，
+// 返回的错误在OverlapWarn下只是提醒，name仍然需要注册，调用的时候需要持有w.mu
+func (w *Watcher) checkOverlap(name string, recursive bool) (bool, error) {
+	if w.overlapPolicy == OverlapAllow {
+		return true, nil
+	}
+	for root, rootRecursive := range w.names {
+		if root == name {
+			continue
+		}
+		// name已经被root覆盖
+		if rootRecursive && underPath(name, root) {
+			switch w.overlapPolicy {
+			case OverlapMerge:
+				w.trace(name, Create, "not added: already covered by %s", root)
+				return false, nil
+			case OverlapWarn:
+				return true, &OverlapError{Root: name, Existing: root}
+			default:
+				return false, &OverlapError{Root: name, Existing: root}
+			}
+		}
+		// name会覆盖root
+		if recursive && underPath(root, name) {
+			switch w.overlapPolicy {
+			case OverlapMerge:
+				w.trace(root, Create, "unregistered: covered by new root %s", name)
+				delete(w.names, root)
+				delete(w.roots, root)
+			case OverlapWarn:
+				return true, &OverlapError{Root: name, Existing: root}
+			default:
+				return false, &OverlapError{Root: name, Existing: root}
+			}
+		}
+	}
+	return true, nil
+}
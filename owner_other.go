@@ -0,0 +1,34 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package watcher
+
+import (
+	"os"
+	"os/exec"
+)
+
+// 这些平台上FileInfo不包含uid和gid，也不能以其他用户启动子进程
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
+
+func fileBlocks(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
+
+func fileLinks(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+func decodeSys(data []byte) interface{} {
+	return nil
+}
+
+func setCredential(cmd *exec.Cmd, uid, gid uint32) error {
+	return ErrPrivsepUnsupported
+}
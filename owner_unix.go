@@ -0,0 +1,67 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package watcher
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// 返回文件的属主uid和gid
+func fileOwner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// 返回文件所在的设备和inode
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
+
+// 返回文件实际分配的块数，以512字节为单位
+func fileBlocks(info os.FileInfo) (int64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int64(st.Blocks), true
+}
+
+// 返回文件的硬链接数
+func fileLinks(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Nlink), true
+}
+
+// 把扫描子进程发来的Sys()解码成*syscall.Stat_t
+func decodeSys(data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	st := new(syscall.Stat_t)
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil
+	}
+	return st
+}
+
+// 让子进程以uid和gid运行
+func setCredential(cmd *exec.Cmd, uid, gid uint32) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uid, Gid: gid},
+	}
+	return nil
+}
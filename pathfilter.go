@@ -0,0 +1,54 @@
+package watcher
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// 设置按正则表达式过滤路径，用来排除和源文件混在一起的生成文件这类前缀和glob不好描述的情况
+// include不为nil时只跟踪完整路径匹配include的文件，目录不受影响，仍然会被监控和进入；
+// exclude不为nil时完整路径匹配exclude的文件和目录都不跟踪，也不会进入这样的目录；
+// 路径统一按/分隔来匹配，Add和每一轮扫描都会检查，已经跟踪的不满足条件的路径会被移除；两个都为nil时取消过滤
+func (w *Watcher) FilterPaths(include, exclude *regexp.Regexp) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.includeRe = include
+	w.excludeRe = exclude
+	for path, info := range w.files {
+		if _, root := w.names[path]; root {
+			continue
+		}
+		if w.pathFiltered(path, info.IsDir()) != "" || w.excludedTree(filepath.Dir(path)) {
+			delete(w.files, path)
+			w.untrackFile(path)
+		}
+	}
+}
+
+// 返回path没有通过正则过滤的原因，通过时返回空字符串，调用的时候需要持有w.mu
+func (w *Watcher) pathFiltered(path string, isDir bool) string {
+	slashed := filepath.ToSlash(path)
+	if w.excludeRe != nil && w.excludeRe.MatchString(slashed) {
+		return "matches FilterPaths exclude " + w.excludeRe.String()
+	}
+	if w.includeRe != nil && !isDir && !w.includeRe.MatchString(slashed) {
+		return "does not match FilterPaths include " + w.includeRe.String()
+	}
+	return ""
+}
+
+// path或者它在root下的上级目录是否匹配exclude，调用的时候需要持有w.mu
+func (w *Watcher) excludedTree(path string) bool {
+	if w.excludeRe == nil {
+		return false
+	}
+	for p := path; ; p = filepath.Dir(p) {
+		if _, root := w.names[p]; root || filepath.Dir(p) == p {
+			return false
+		}
+		if w.excludeRe.MatchString(filepath.ToSlash(p)) {
+			return true
+		}
+	}
+}
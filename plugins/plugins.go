@@ -0,0 +1,13 @@
+// plugins 加载注册Sink和Filter的Go插件，单独成包是因为导入plugin会让程序动态链接、
+// 保留所有导出的方法，只有需要在运行时加载插件的程序才导入这个包
+package plugins
+
+import "plugin"
+
+// Load 加载一个Go插件(go build -buildmode=plugin)，插件在init里调用watcher.RegisterSink、watcher.RegisterFilter
+// 或者watcher.SetWASMRuntime注册自己
+// 插件需要和主程序用同一个版本的Go和watcher包编译，只支持Linux、macOS和FreeBSD
+func Load(path string) error {
+	_, err := plugin.Open(path)
+	return err
+}
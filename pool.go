@@ -0,0 +1,170 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// Pool 用一个调度循环扫描很多个互相隔离的Watcher，每个Watcher有自己的channel、过滤条件和限制，
+// 适合为每个客户监控一个目录的服务，不用跑几百个独立的轮询循环
+// 加入Pool的Watcher不需要(也不能)调用Start，它们的事件仍然从各自的w.Event读取；通过AddWithOptions设置的
+// root间隔比Pool的间隔长时按root的间隔跳过，比Pool的间隔短时按Pool的间隔扫描；
+// 某个Watcher的事件没有人读的时候，它的扫描停在发送事件上，之后的轮次跳过它直到事件被读取，其他Watcher不受影响
+type Pool struct {
+	mu      sync.Mutex
+	clock   Clock
+	workers int
+	members []*Watcher
+	busy    map[*Watcher]bool // 上一次扫描还没有结束(通常是事件没有人读)的Watcher
+	running bool
+	closed  bool
+	close   chan struct{}
+	Closed  chan struct{}
+}
+
+// 创建一个Pool，workers是同时扫描的Watcher数，用来限制IO，小于1时按1处理
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Pool{
+		clock:   realClock{},
+		workers: workers,
+		busy:    make(map[*Watcher]bool),
+		close:   make(chan struct{}),
+		Closed:  make(chan struct{}),
+	}
+}
+
+// 设置Pool使用的时钟，需要在Start之前调用，c为nil时恢复成系统时钟
+func (p *Pool) SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	p.mu.Lock()
+	p.clock = c
+	p.mu.Unlock()
+}
+
+// 创建一个新的Watcher并加入Pool
+func (p *Pool) NewWatcher() *Watcher {
+	w := New()
+	p.Add(w)
+	return w
+}
+
+// 把w加入Pool，从下一轮开始扫描，w.Wait()不再等待Start
+func (p *Pool) Add(w *Watcher) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, m := range p.members {
+		if m == w {
+			return
+		}
+	}
+	p.members = append(p.members, w)
+	w.ready.Do(w.wg.Done)
+}
+
+// 把w移出Pool，正在进行的扫描会正常结束
+func (p *Pool) Remove(w *Watcher) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, m := range p.members {
+		if m == w {
+			p.members = append(p.members[:i:i], p.members[i+1:]...)
+			return
+		}
+	}
+}
+
+// 返回Pool里的Watcher数
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.members)
+}
+
+// Start 每隔d扫描一轮所有的Watcher，一轮里最多同时列出workers个，直到调用Close
+// d是一轮所有Watcher列出文件结束到下一轮开始之间的间隔，发送事件不计算在内
+func (p *Pool) Start(d time.Duration) error {
+	if d < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	p.mu.Lock()
+	if p.running || p.closed {
+		p.mu.Unlock()
+		return ErrWatcherRunning
+	}
+	p.running = true
+	p.mu.Unlock()
+
+	for {
+		p.step(d)
+		select {
+		case <-p.close:
+			close(p.Closed)
+			return nil
+		case <-p.clock.After(d):
+		}
+	}
+}
+
+// 扫描一轮所有的Watcher，d是轮询间隔；只等待列出文件，不等待事件被读取
+func (p *Pool) step(d time.Duration) {
+	p.mu.Lock()
+	members := append([]*Watcher(nil), p.members...)
+	workers := p.workers
+	p.mu.Unlock()
+
+	slots := make(chan struct{}, workers)
+	var listed sync.WaitGroup
+	for _, w := range members {
+		p.mu.Lock()
+		if p.busy[w] {
+			p.mu.Unlock()
+			continue
+		}
+		p.busy[w] = true
+		p.mu.Unlock()
+
+		select {
+		case slots <- struct{}{}:
+		case <-p.close:
+			// Close之后不再开始新的扫描
+			p.mu.Lock()
+			delete(p.busy, w)
+			p.mu.Unlock()
+			listed.Wait()
+			return
+		}
+		listed.Add(1)
+		go func(w *Watcher) {
+			var once sync.Once
+			release := func() {
+				once.Do(func() {
+					<-slots
+					listed.Done()
+				})
+			}
+			// 自己调用了Start的Watcher直接跳过
+			w.poolStep(d, release)
+			release()
+			p.mu.Lock()
+			delete(p.busy, w)
+			p.mu.Unlock()
+		}(w)
+	}
+	listed.Wait()
+}
+
+// 停止调度，正在列出文件的Watcher会先完成，不等待还在发送事件的Watcher
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.running || p.closed {
+		return
+	}
+	p.closed = true
+	close(p.close)
+}
@@ -0,0 +1,133 @@
+package watcher_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pythonsite/watcher"
+	"github.com/pythonsite/watcher/watchertest"
+)
+
+func TestPoolMemberWait(t *testing.T) {
+	p := watcher.NewPool(1)
+	w := p.NewWatcher()
+	done := make(chan struct{})
+	go func() {
+		w.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait blocked for a pool member")
+	}
+}
+
+func TestPoolRootInterval(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"a": "a"})
+	clk := watchertest.NewFakeClock(time.Unix(0, 0))
+	p := watcher.NewPool(1)
+	p.SetClock(clk)
+	w := watcher.New()
+	w.SetClock(clk)
+	if err := w.AddWithOptions(root, watcher.Interval(3*time.Second), watcher.Ops(watcher.Create)); err != nil {
+		t.Fatal(err)
+	}
+	p.Add(w)
+
+	events := make(chan watcher.Event, 10)
+	go func() {
+		for e := range w.Event {
+			events <- e
+		}
+	}()
+	go p.Start(time.Second)
+	defer p.Close()
+
+	clk.BlockUntil(1)
+	watchertest.Apply(t, root, watchertest.WriteFile("b", "b"))
+	for i := 1; i <= 3; i++ {
+		clk.Advance(time.Second)
+		clk.BlockUntil(1)
+		select {
+		case e := <-events:
+			if i < 3 {
+				t.Fatalf("after %ds: got %v before the root's interval", i, e)
+			}
+			if e.Op != watcher.Create || e.Path != filepath.Join(root, "b") {
+				t.Fatalf("got %v, want CREATE b", e)
+			}
+		case <-time.After(100 * time.Millisecond):
+			if i == 3 {
+				t.Fatal("no event after the root's interval")
+			}
+		}
+	}
+}
+
+func TestPoolSkipsStalledMember(t *testing.T) {
+	stalledRoot := watchertest.TempTree(t, nil)
+	liveRoot := watchertest.TempTree(t, nil)
+	clk := watchertest.NewFakeClock(time.Unix(0, 0))
+	p := watcher.NewPool(1)
+	p.SetClock(clk)
+	stalled := p.NewWatcher()
+	live := p.NewWatcher()
+	for w, root := range map[*watcher.Watcher]string{stalled: stalledRoot, live: liveRoot} {
+		w.SetClock(clk)
+		if err := w.Add(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 没有人读stalled.Event
+	events := make(chan watcher.Event, 10)
+	go func() {
+		for e := range live.Event {
+			events <- e
+		}
+	}()
+	go p.Start(time.Second)
+
+	clk.BlockUntil(1)
+	watchertest.Apply(t, stalledRoot, watchertest.WriteFile("a", "a"))
+	for i := 0; i < 3; i++ {
+		watchertest.Apply(t, liveRoot, watchertest.WriteFile(fmt.Sprintf("f%d", i), "x"))
+		want := filepath.Join(liveRoot, fmt.Sprintf("f%d", i))
+		// 上一次扫描还在收尾的时候这一轮会跳过live，所以多推进几轮
+		found := false
+		for round := 0; round < 10 && !found; round++ {
+			clk.Advance(time.Second)
+			clk.BlockUntil(1)
+			timeout := time.After(50 * time.Millisecond)
+		wait:
+			for {
+				select {
+				case e := <-events:
+					if e.Path == want {
+						found = true
+						break wait
+					}
+				case <-timeout:
+					break wait
+				}
+			}
+		}
+		if !found {
+			t.Fatalf("step %d: no event for the live member while another member is stalled", i)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		<-p.Closed
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on a stalled member")
+	}
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"os"
+	"sort"
+)
+
+// WatchPreview 是Preview返回的监控范围
+type WatchPreview struct {
+	Roots    map[string]bool   // 监控的root以及是否递归
+	Tracked  []string          // 会被跟踪的文件和目录，按路径排序
+	Excluded map[string]string // 没有被跟踪的路径和原因(忽略、隐藏、特殊文件、限额、淘汰、root出错等)
+	Filtered map[string]string // 会被跟踪，但是Create事件会被FilterOps、FilterContent或者FilterExpr拦下的路径和原因
+}
+
+// Preview 按照当前的root、递归、忽略和过滤设置列出所有路径，返回哪些会被跟踪，哪些被什么规则排除了，
+// 不修改watcher的状态也不发送事件，用来调试复杂的忽略设置；设置了ScanAsUser时也在当前进程里列出文件，
+// 设置了SetIncremental时做一次完整遍历，不使用也不更新增量扫描的缓存
+func (w *Watcher) Preview() WatchPreview {
+	p := WatchPreview{
+		Roots:    make(map[string]bool),
+		Excluded: make(map[string]string),
+		Filtered: make(map[string]string),
+	}
+
+	w.mu.Lock()
+	w.traceMu.Lock()
+	w.excluded = p.Excluded
+	w.traceMu.Unlock()
+
+	files := make(map[string]os.FileInfo)
+	for name, recursive := range w.names {
+		p.Roots[name] = recursive
+		var list map[string]os.FileInfo
+		var err error
+		if recursive {
+			list, err = w.walkTree(name, nil, false)
+		} else {
+			list, err = w.list(name)
+		}
+		if err != nil {
+			p.Excluded[name] = listError(name, recursive, err).Error()
+		}
+		if max, found := w.quotas[name]; found && len(list) > max {
+			list = w.keepQuota(name, max, list)
+		}
+		for path, info := range list {
+			files[path] = info
+		}
+	}
+	for path := range w.evicted {
+		if _, found := files[path]; found {
+			delete(files, path)
+			p.Excluded[path] = "not listed: evicted by entry limit"
+		}
+	}
+	_, create := w.ops[Create]
+	opFiltered := len(w.ops) > 0 && !create
+	// 过滤设置可能被并发修改，取一份快照
+	re, limit, x := w.contentRe, w.contentLimit, w.expr
+	w.traceMu.Lock()
+	w.excluded = nil
+	w.traceMu.Unlock()
+	w.mu.Unlock()
+
+	for path, info := range files {
+		p.Tracked = append(p.Tracked, path)
+		e := Event{Op: Create, Path: path, FileInfo: info}
+		switch {
+		case opFiltered:
+			p.Filtered[path] = "suppressed: op not in FilterOps"
+		case !contentMatches(re, limit, e):
+			p.Filtered[path] = "suppressed: content does not match FilterContent"
+		case x != nil && !x.Match(e):
+			p.Filtered[path] = "suppressed: FilterExpr is false"
+		}
+	}
+	sort.Strings(p.Tracked)
+	return p
+}
@@ -0,0 +1,55 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+func TestPreviewLeavesIncrementalCache(t *testing.T) {
+	root := benchTree(t, 2, 2)
+	w := New()
+	w.SetIncremental(3)
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	walks := w.dirCache[root].walks
+	dirs := len(w.dirCache[root].dirs)
+
+	if err := os.WriteFile(filepath.Join(root, "d0", "new"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := w.Preview()
+	if len(p.Tracked) != len(w.files)+1 {
+		t.Errorf("Preview tracked %d paths, want %d", len(p.Tracked), len(w.files)+1)
+	}
+	if got := w.dirCache[root].walks; got != walks {
+		t.Errorf("Preview changed the walk count from %d to %d", walks, got)
+	}
+	if got := len(w.dirCache[root].dirs); got != dirs {
+		t.Errorf("Preview changed the cached directories from %d to %d", dirs, got)
+	}
+}
+
+func TestPreviewConcurrentFilters(t *testing.T) {
+	root := benchTree(t, 2, 2)
+	w := New()
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			w.FilterContent(regexp.MustCompile("x"), 0)
+			w.FilterExpr(`size > 0`)
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		w.Preview()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,370 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 标记当前进程是扫描子进程的环境变量
+const scanHelperEnv = "WATCHER_SCAN_HELPER"
+
+// 当前平台不支持在子进程里扫描时ScanAsUser返回这个错误
+var ErrPrivsepUnsupported = errors.New("error: scanning in a helper process is not supported on this platform")
+
+// 子进程只负责列出目录，需要在当前进程里读取不受信任的文件内容的功能不能和ScanAsUser一起使用
+var ErrScanAsUserContent = errors.New("error: feature reads file contents in process and cannot be used with ScanAsUser")
+
+// 发给扫描子进程的请求
+type scanRequest struct {
+	Root         string        `json:"root"`
+	Recursive    bool          `json:"recursive"`
+	Ignored      []string      `json:"ignored,omitempty"`
+	IgnoreHidden bool          `json:"ignoreHidden,omitempty"`
+	SameDevice   bool          `json:"sameDevice,omitempty"`
+	Special      SpecialPolicy `json:"special,omitempty"`
+	Includes     []string      `json:"includes,omitempty"`
+	IgnoreGlobs  []string      `json:"ignoreGlobs,omitempty"`
+	IncludeRe    string        `json:"includeRe,omitempty"`
+	ExcludeRe    string        `json:"excludeRe,omitempty"`
+	MaxDepth     int           `json:"maxDepth,omitempty"`
+	Follow       bool          `json:"follow,omitempty"`
+	Concurrency  int           `json:"concurrency,omitempty"`
+}
+
+// 扫描子进程返回的一个文件
+type scanFile struct {
+	Path    string          `json:"path"`
+	Name    string          `json:"name"`
+	Size    int64           `json:"size"`
+	Mode    os.FileMode     `json:"mode"`
+	ModTime time.Time       `json:"modTime"`
+	Sys     json.RawMessage `json:"sys,omitempty"`
+}
+
+type scanResponse struct {
+	Files      []scanFile `json:"files"`
+	Err        string     `json:"err,omitempty"`
+	NotExist   bool       `json:"notExist,omitempty"`
+	Permission bool       `json:"permission,omitempty"`
+}
+
+// ServeScanHelper 如果当前进程是ScanAsUser启动的扫描子进程，就处理父进程的扫描请求，
+// 父进程关闭管道之后退出进程；不是子进程的时候立即返回。使用ScanAsUser的程序需要在main的最开始调用它
+func ServeScanHelper() {
+	if os.Getenv(scanHelperEnv) != "1" {
+		return
+	}
+	dec := json.NewDecoder(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	for {
+		var req scanRequest
+		if err := dec.Decode(&req); err != nil {
+			if err == io.EOF {
+				os.Exit(0)
+			}
+			os.Exit(1)
+		}
+		if err := enc.Encode(serveScan(req)); err != nil {
+			os.Exit(1)
+		}
+	}
+}
+
+// 在子进程里按照请求列出文件
+func serveScan(req scanRequest) scanResponse {
+	w := New()
+	w.ignoreHidden = req.IgnoreHidden
+	w.sameDevice = req.SameDevice
+	w.specialPolicy = req.Special
+	for _, path := range req.Ignored {
+		w.ignored[path] = struct{}{}
+	}
+	w.ignoreGlobs = req.IgnoreGlobs
+	w.maxDepth = req.MaxDepth
+	w.followSymlinks = req.Follow
+	w.concurrency = req.Concurrency
+	if req.IncludeRe != "" {
+		w.includeRe = regexp.MustCompile(req.IncludeRe)
+	}
+	if req.ExcludeRe != "" {
+		w.excludeRe = regexp.MustCompile(req.ExcludeRe)
+	}
+	if len(req.Includes) > 0 {
+		w.includes = map[string][]string{req.Root: req.Includes}
+	}
+	var list map[string]os.FileInfo
+	var err error
+	if req.Recursive {
+		list, err = w.listRecursive(req.Root)
+	} else {
+		list, err = w.list(req.Root)
+	}
+
+	var resp scanResponse
+	for path, info := range list {
+		f := scanFile{
+			Path:    path,
+			Name:    info.Name(),
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		if sys := info.Sys(); sys != nil {
+			f.Sys, _ = json.Marshal(sys)
+		}
+		resp.Files = append(resp.Files, f)
+	}
+	if err != nil {
+		resp.Err = err.Error()
+		resp.NotExist = os.IsNotExist(err)
+		resp.Permission = os.IsPermission(err)
+	}
+	return resp
+}
+
+// 父进程这边的扫描子进程
+type scanHelper struct {
+	mu       sync.Mutex
+	uid, gid uint32
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	enc      *json.Encoder
+	dec      *json.Decoder
+	closed   bool // Close之后不再重新启动
+}
+
+// ScanAsUser 让之后的扫描在一个以uid和gid运行的子进程里进行，子进程是重新执行的当前程序，
+// 这样以root运行的守护进程就不需要在自己的进程里解析不受信任的目录内容
+// 应该在Add之前调用，之后Add时的列出也在子进程里进行；Close时子进程会被停止
+// 程序需要在main的最开始调用ServeScanHelper；只支持Unix
+// 子进程只负责列出目录，读取文件内容的功能(内容过滤、结构化对比、压缩包对比、哈希、抽样指纹、属性、Protect和清单)
+// 仍然会在当前进程里进行，所以已经开启了这些功能时返回ErrScanAsUserContent，设置之后也不能再开启
+func (w *Watcher) ScanAsUser(uid, gid uint32) error {
+	w.mu.Lock()
+	refused := w.contentInProcess()
+	w.mu.Unlock()
+	if refused != nil {
+		return refused
+	}
+
+	h := &scanHelper{uid: uid, gid: gid}
+	h.mu.Lock()
+	err := h.start()
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	if err := w.contentInProcess(); err != nil {
+		// 启动子进程期间开启了读取内容的功能
+		w.mu.Unlock()
+		h.stop()
+		return err
+	}
+	old := w.helper
+	w.helper = h
+	w.mu.Unlock()
+	if old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+// 设置了ScanAsUser时返回ErrScanAsUserContent，调用的时候需要持有w.mu
+func (w *Watcher) refuseContent(feature string) error {
+	if w.helper == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrScanAsUserContent, feature)
+}
+
+// 已经开启了需要在当前进程里读取文件内容的功能时返回ErrScanAsUserContent，调用的时候需要持有w.mu
+func (w *Watcher) contentInProcess() error {
+	var features []string
+	if w.contentRe != nil {
+		features = append(features, "FilterContent")
+	}
+	if w.structured != nil {
+		features = append(features, "DiffStructured")
+	}
+	if w.archives != nil {
+		features = append(features, "DiffArchives")
+	}
+	if w.sums != nil {
+		features = append(features, "Hash change detection")
+	}
+	if w.hashes != nil {
+		features = append(features, "ClassifyChanges hash")
+	}
+	if w.fingerprints != nil {
+		features = append(features, "SampleLargeFiles")
+	}
+	if len(w.trackedAttrs) > 0 {
+		features = append(features, "TrackAttrs")
+	}
+	if len(w.protected) > 0 {
+		features = append(features, "Protect")
+	}
+	w.manifestMu.Lock()
+	if w.manifestMode {
+		features = append(features, "ManifestMode")
+	}
+	w.manifestMu.Unlock()
+	if len(features) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrScanAsUserContent, strings.Join(features, ", "))
+}
+
+// 启动子进程，调用的时候需要持有h.mu
+func (h *scanHelper) start() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(), scanHelperEnv+"=1")
+	cmd.Stderr = os.Stderr
+	if err := setCredential(cmd, h.uid, h.gid); err != nil {
+		return err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	h.cmd = cmd
+	h.stdin = stdin
+	h.enc = json.NewEncoder(stdin)
+	h.dec = json.NewDecoder(stdout)
+	return nil
+}
+
+// 停止子进程并等待它退出
+func (h *scanHelper) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.cmd == nil {
+		return
+	}
+	h.stdin.Close()
+	h.cmd.Wait()
+	h.cmd = nil
+}
+
+// 让子进程列出文件，子进程意外退出的话在下一次请求时重新启动
+func (h *scanHelper) list(req scanRequest) (map[string]os.FileInfo, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		// 不能退回到在当前进程里扫描
+		return nil, errors.New("error: scan helper is stopped")
+	}
+	if h.cmd == nil {
+		if err := h.start(); err != nil {
+			return nil, err
+		}
+	}
+	var resp scanResponse
+	err := h.enc.Encode(req)
+	if err == nil {
+		err = h.dec.Decode(&resp)
+	}
+	if err != nil {
+		h.stdin.Close()
+		h.cmd.Process.Kill()
+		h.cmd.Wait()
+		h.cmd = nil
+		return nil, fmt.Errorf("error: scan helper: %v", err)
+	}
+
+	fileList := make(map[string]os.FileInfo, len(resp.Files))
+	for _, f := range resp.Files {
+		fileList[f.Path] = &fileInfo{
+			name:    f.Name,
+			size:    f.Size,
+			mode:    f.Mode,
+			modTime: f.ModTime,
+			sys:     decodeSys(f.Sys),
+			dir:     f.Mode.IsDir(),
+		}
+	}
+	if resp.Err == "" {
+		return fileList, nil
+	}
+	cause := errors.New(resp.Err)
+	switch {
+	case resp.NotExist:
+		cause = os.ErrNotExist
+	case resp.Permission:
+		cause = os.ErrPermission
+	}
+	return fileList, &os.PathError{Op: "scan", Path: req.Root, Err: cause}
+}
+
+// 列出一个root下的文件，设置了ScanAsUser的话在子进程里进行，在listingCopy返回的副本上调用
+func (w *Watcher) listRoot(name string, recursive bool) (map[string]os.FileInfo, error) {
+	if w.helper == nil {
+		if recursive {
+			return w.listRecursive(name)
+		}
+		return w.list(name)
+	}
+	return w.helperList(name, recursive)
+}
+
+// Add的时候列出root，设置了ScanAsUser的话同样在子进程里进行，
+// 这样第一次列出的结果和之后的扫描一致，不会因为权限不同产生多余的Remove事件，调用的时候需要持有w.mu
+func (w *Watcher) listAdded(name string, recursive bool) (map[string]os.FileInfo, error) {
+	if w.helper != nil {
+		return w.helperList(name, recursive)
+	}
+	if recursive {
+		return w.listRecursive(name)
+	}
+	return w.list(name)
+}
+
+// 在扫描子进程里列出一个root，调用的时候需要持有w.mu
+func (w *Watcher) helperList(name string, recursive bool) (map[string]os.FileInfo, error) {
+	req := scanRequest{Root: name, Recursive: recursive, IgnoreHidden: w.ignoreHidden, SameDevice: w.sameDevice, Special: w.specialPolicy,
+		Includes: w.includes[name], IgnoreGlobs: w.ignoreGlobs, MaxDepth: w.maxDepth,
+		Follow: w.followSymlinks, Concurrency: w.concurrency}
+	if w.includeRe != nil {
+		req.IncludeRe = w.includeRe.String()
+	}
+	if w.excludeRe != nil {
+		req.ExcludeRe = w.excludeRe.String()
+	}
+	for path := range w.ignored {
+		req.Ignored = append(req.Ignored, path)
+	}
+	list, err := w.helper.list(req)
+	// 过滤钩子不能传给子进程，在这里对结果调用
+	if hookErr := w.pruneHooked(list); err == nil {
+		err = hookErr
+	}
+	if !recursive && err != nil {
+		// 和w.list一样，出错的时候不返回部分结果
+		return nil, err
+	}
+	return list, err
+}
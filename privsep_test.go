@@ -0,0 +1,83 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// ScanAsUser重新执行测试程序作为扫描子进程
+	ServeScanHelper()
+	os.Exit(m.Run())
+}
+
+func TestScanAsUserAddAndClose(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := New()
+	if err := w.ScanAsUser(uint32(os.Getuid()), uint32(os.Getgid())); err != nil {
+		t.Fatal(err)
+	}
+	h := w.helper
+	if err := w.AddRecursive(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Add时的列出也在子进程里进行，子进程返回的FileInfo是fileInfo
+	info, found := w.WatchedFiles()[filepath.Join(dir, "a")]
+	if !found {
+		t.Fatal("file not listed")
+	}
+	if _, ok := info.(*fileInfo); !ok {
+		t.Errorf("listed in process: %T", info)
+	}
+
+	w.Close()
+	h.mu.Lock()
+	cmd, closed := h.cmd, h.closed
+	h.mu.Unlock()
+	if cmd != nil || !closed {
+		t.Error("helper still running after Close")
+	}
+	if _, err := h.list(scanRequest{Root: dir}); err == nil {
+		t.Error("stopped helper listed files")
+	}
+}
+
+func TestScanAsUserRefusesContentReaders(t *testing.T) {
+	w := New()
+	if err := w.FilterContent(regexp.MustCompile("x"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.ScanAsUser(uint32(os.Getuid()), uint32(os.Getgid())); !errors.Is(err, ErrScanAsUserContent) {
+		t.Fatalf("ScanAsUser with FilterContent: got %v, want ErrScanAsUserContent", err)
+	}
+	w.Close()
+
+	w = New()
+	defer w.Close()
+	if err := w.ScanAsUser(uint32(os.Getuid()), uint32(os.Getgid())); err != nil {
+		t.Fatal(err)
+	}
+	for name, enable := range map[string]func() error{
+		"DiffStructured": func() error { return w.DiffStructured(true) },
+		"DiffArchives":   func() error { return w.DiffArchives(true) },
+		"Hash":           func() error { return w.SetChangeDetection(Hash) },
+		"Protect":        func() error { return w.Protect(t.TempDir()) },
+		"ManifestMode":   func() error { return w.ManifestMode("") },
+	} {
+		if err := enable(); !errors.Is(err, ErrScanAsUserContent) {
+			t.Errorf("%s with ScanAsUser: got %v, want ErrScanAsUserContent", name, err)
+		}
+	}
+	if err := w.DiffStructured(false); err != nil {
+		t.Errorf("disabling DiffStructured: %v", err)
+	}
+}
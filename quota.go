@@ -0,0 +1,74 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 设置root下最多跟踪的文件数，超过之后不再添加新的文件，已经跟踪的照常监控，
+// 第一次超过时发送一个QuotaExceeded事件，Detail里是实际的文件数，回到限额以内之后再超过会再次发送
+// 防止有人把一个巨大的压缩包解压到被监控的目录里；max小于等于0时取消限额
+func (w *Watcher) SetQuota(root string, max int) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if max <= 0 {
+		delete(w.quotas, root)
+		delete(w.overQuota, root)
+		return nil
+	}
+	if w.quotas == nil {
+		w.quotas = make(map[string]int)
+		w.overQuota = make(map[string]bool)
+	}
+	w.quotas[root] = max
+	return nil
+}
+
+// 按限额过滤root列出的文件，已经跟踪的文件总是保留，新文件按路径顺序补到限额为止，调用的时候需要持有w.mu
+func (w *Watcher) applyQuota(root string, list map[string]os.FileInfo) map[string]os.FileInfo {
+	max, found := w.quotas[root]
+	if !found {
+		return list
+	}
+	if len(list) <= max {
+		delete(w.overQuota, root)
+		return list
+	}
+	kept := w.keepQuota(root, max, list)
+
+	if !w.overQuota[root] {
+		w.overQuota[root] = true
+		detail := fmt.Sprintf("%d entries, quota %d", len(list), max)
+		w.trace(root, QuotaExceeded, "detected: %s", detail)
+		w.rootEvents = append(w.rootEvents, Event{Op: QuotaExceeded, Path: root, FileInfo: list[root], Detail: detail})
+	}
+	return kept
+}
+
+// 返回限额以内保留的文件，调用的时候需要持有w.mu
+func (w *Watcher) keepQuota(root string, max int, list map[string]os.FileInfo) map[string]os.FileInfo {
+	kept := make(map[string]os.FileInfo, max)
+	var added []string
+	for path, info := range list {
+		if _, tracked := w.files[path]; tracked {
+			kept[path] = info
+		} else {
+			added = append(added, path)
+		}
+	}
+	sort.Strings(added)
+	for _, path := range added {
+		if len(kept) >= max {
+			w.trace(path, Create, "not listed: quota of %s exceeded", root)
+			continue
+		}
+		kept[path] = list[path]
+	}
+	return kept
+}
@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 一个路径上的事件频率阈值
+type rateThreshold struct {
+	max     int
+	window  time.Duration
+	entries []rateEntry // 窗口内的事件
+	last    time.Time   // 上一次报告的时间
+}
+
+// 窗口里的一个事件
+type rateEntry struct {
+	t  time.Time
+	op Op
+}
+
+// 设置事件频率阈值：path以及它下面的路径在window时间内的事件超过max个时，发送一个RateAlert事件，
+// Detail里汇总这个窗口内的事件数量和各类操作的次数；统计发生在FilterOps、FilterExpr等过滤之前，
+// RateAlert本身也不经过这些过滤，所以即使单个事件被过滤掉了也能发现异常的活动；同一个阈值在window时间内只报告一次，max小于等于0时取消
+func (w *Watcher) SetRateThreshold(path string, max int, window time.Duration) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if max > 0 && window < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if max <= 0 {
+		delete(w.rates, path)
+		return nil
+	}
+	if w.rates == nil {
+		w.rates = make(map[string]*rateThreshold)
+	}
+	w.rates[path] = &rateThreshold{max: max, window: window}
+	return nil
+}
+
+// 统计这一轮的事件，超过阈值的时候返回RateAlert事件
+func (w *Watcher) detectRate(events []Event) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.rates) == 0 {
+		return nil
+	}
+	paths := make([]string, 0, len(w.rates))
+	for path := range w.rates {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	now := w.clock.Now()
+	var alerts []Event
+	for _, path := range paths {
+		r := w.rates[path]
+		for _, e := range events {
+			for _, p := range eventPaths(e) {
+				if underPath(p, path) {
+					r.entries = append(r.entries, rateEntry{t: now, op: e.Op})
+					break
+				}
+			}
+		}
+		i := 0
+		for i < len(r.entries) && now.Sub(r.entries[i].t) > r.window {
+			i++
+		}
+		r.entries = r.entries[i:]
+
+		if len(r.entries) <= r.max || (!r.last.IsZero() && now.Sub(r.last) < r.window) {
+			continue
+		}
+		r.last = now
+
+		counts := make(map[Op]int)
+		for _, entry := range r.entries {
+			counts[entry.op]++
+		}
+		var byOp []string
+		for op, n := range counts {
+			byOp = append(byOp, fmt.Sprintf("%s x%d", op, n))
+		}
+		sort.Strings(byOp)
+		detail := fmt.Sprintf("%d events within %s under %s exceed %d (%s), window %s - %s",
+			len(r.entries), r.window, path, r.max, strings.Join(byOp, ", "),
+			r.entries[0].t.Format(time.RFC3339), now.Format(time.RFC3339))
+
+		fi := w.files[path]
+		if fi == nil {
+			fi = &fileInfo{name: filepath.Base(path), modTime: now, dir: true}
+		}
+		w.trace(path, RateAlert, "detected: %s", detail)
+		alerts = append(alerts, Event{Op: RateAlert, Path: path, FileInfo: fi, Detail: detail})
+	}
+	return alerts
+}
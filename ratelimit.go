@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// 设置发送事件的速率上限：每per时间内最多发送n个事件，超过的事件被丢掉，计入Stats.DroppedBy[DropRateLimit]，
+// 有事件被丢掉的那一轮扫描结束时发送一个Overflow事件，Path是被丢掉的事件共同的上级目录，Detail说明丢了多少，
+// git checkout这样的大量操作不会淹没使用者，使用者收到Overflow之后可以自己做一次完整的同步；n小于等于0时取消限制
+func (w *Watcher) SetEventRateLimit(n int, per time.Duration) error {
+	if n > 0 && per < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	w.mu.Lock()
+	w.rateLimit = n
+	w.ratePer = per
+	w.rateStart = time.Time{}
+	w.rateSent = 0
+	w.mu.Unlock()
+	return nil
+}
+
+// 判断一个事件是否还在速率限制之内，在的话计入这个时间窗口
+func (w *Watcher) allowEvent() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.rateLimit <= 0 {
+		return true
+	}
+	now := w.clock.Now()
+	if w.rateStart.IsZero() || now.Sub(w.rateStart) >= w.ratePer {
+		w.rateStart = now
+		w.rateSent = 0
+	}
+	if w.rateSent >= w.rateLimit {
+		return false
+	}
+	w.rateSent++
+	return true
+}
+
+// 为这一轮被速率限制丢掉的事件生成一个Overflow事件
+func (w *Watcher) overflowEvent(dropped []string) Event {
+	common := filepath.Dir(dropped[0])
+	for _, path := range dropped[1:] {
+		for !underPath(path, common) && filepath.Dir(common) != common {
+			common = filepath.Dir(common)
+		}
+	}
+	w.mu.Lock()
+	detail := fmt.Sprintf("%d events dropped under %s, limit is %d per %s", len(dropped), common, w.rateLimit, w.ratePer)
+	w.mu.Unlock()
+	w.trace(common, Overflow, "detected: %s", detail)
+	return Event{Op: Overflow, Path: common, FileInfo: &fileInfo{name: filepath.Base(common), modTime: w.clock.Now(), dir: true}, Detail: detail}
+}
@@ -0,0 +1,69 @@
+package watcher
+
+import "time"
+
+// RecentEvent 是最近发送过的一个事件和发送的时间
+type RecentEvent struct {
+	Time time.Time
+	Event
+}
+
+// 设置在内存里保留最近发送的n个事件，可以通过Recent查询，方便界面和后来的订阅者补上刚刚发生的变化；
+// n小于等于0时不保留，默认不保留；改变大小时保留已有的最新的事件
+func (w *Watcher) KeepRecent(n int) {
+	w.recentMu.Lock()
+	defer w.recentMu.Unlock()
+
+	if n <= 0 {
+		w.recent, w.recentHead, w.recentLen = nil, 0, 0
+		return
+	}
+	old := w.recentEvents()
+	if len(old) > n {
+		old = old[len(old)-n:]
+	}
+	w.recent = make([]RecentEvent, n)
+	copy(w.recent, old)
+	w.recentHead, w.recentLen = len(old)%n, len(old)
+}
+
+// Recent 返回since之后发送的事件，最早的在前面；since为零值时返回保留的所有事件
+func (w *Watcher) Recent(since time.Time) []RecentEvent {
+	w.recentMu.Lock()
+	defer w.recentMu.Unlock()
+
+	events := w.recentEvents()
+	i := 0
+	for i < len(events) && !events[i].Time.After(since) {
+		i++
+	}
+	return events[i:]
+}
+
+// 按时间顺序返回环形缓冲里的事件，调用的时候需要持有w.recentMu
+func (w *Watcher) recentEvents() []RecentEvent {
+	events := make([]RecentEvent, 0, w.recentLen)
+	start := w.recentHead - w.recentLen
+	if start < 0 {
+		start += len(w.recent)
+	}
+	for i := 0; i < w.recentLen; i++ {
+		events = append(events, w.recent[(start+i)%len(w.recent)])
+	}
+	return events
+}
+
+// 把一个已经发送的事件放进环形缓冲
+func (w *Watcher) keepRecent(e Event) {
+	w.recentMu.Lock()
+	defer w.recentMu.Unlock()
+
+	if len(w.recent) == 0 {
+		return
+	}
+	w.recent[w.recentHead] = RecentEvent{Time: w.clock.Now(), Event: e}
+	w.recentHead = (w.recentHead + 1) % len(w.recent)
+	if w.recentLen < len(w.recent) {
+		w.recentLen++
+	}
+}
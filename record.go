@@ -0,0 +1,349 @@
+package watcher
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 录制文件里的一行，一个事件
+type record struct {
+	Time        time.Time   `json:"time"`
+	Op          string      `json:"op"`
+	Path        string      `json:"path"`
+	Name        string      `json:"name,omitempty"`
+	Size        int64       `json:"size"`
+	Mode        os.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"modTime"`
+	IsDir       bool        `json:"isDir,omitempty"`
+	ChangedKeys []string    `json:"changedKeys,omitempty"`
+	Detail      string      `json:"detail,omitempty"`
+	Change      string      `json:"change,omitempty"`
+	Transaction string      `json:"transaction,omitempty"`
+	OldPath     string      `json:"oldPath,omitempty"`
+	NewPath     string      `json:"newPath,omitempty"`
+	HMAC        string      `json:"hmac,omitempty"` // 其他字段的HMAC-SHA256，没有设置签名密钥时为空
+}
+
+// 设置了签名密钥但是记录没有签名或者签名不对的时候返回这个错误
+var ErrInvalidSignature = errors.New("error: invalid event signature")
+
+// 计算去掉HMAC字段之后的JSON的HMAC
+func (r record) mac(key []byte) string {
+	r.HMAC = ""
+	data, _ := json.Marshal(r)
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func (r record) sign(key []byte) record {
+	if len(key) > 0 {
+		r.HMAC = r.mac(key)
+	}
+	return r
+}
+
+func (r record) verify(key []byte) error {
+	if len(key) == 0 {
+		return nil
+	}
+	if !hmac.Equal([]byte(r.HMAC), []byte(r.mac(key))) {
+		return fmt.Errorf("%w: %s %s", ErrInvalidSignature, r.Op, r.Path)
+	}
+	return nil
+}
+
+// MarshalEvent 把事件序列化成和Record一样的JSON格式，key不为空时附带HMAC签名，
+// 可以用在webhook、日志等自己实现的输出上，下游用UnmarshalEvent校验
+func MarshalEvent(e Event, key []byte) ([]byte, error) {
+	return json.Marshal(newRecord(time.Now(), e).sign(key))
+}
+
+// UnmarshalEvent 解析MarshalEvent或者Record的输出，key不为空时校验HMAC，
+// 签名缺失或者不正确时返回ErrInvalidSignature
+func UnmarshalEvent(data []byte, key []byte) (Event, error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return Event{}, err
+	}
+	if err := r.verify(key); err != nil {
+		return Event{}, err
+	}
+	return r.event()
+}
+
+func newRecord(t time.Time, e Event) record {
+	r := record{Time: t, Op: e.Op.String(), Path: e.Path, ChangedKeys: e.ChangedKeys, Detail: e.Detail, Transaction: e.Transaction,
+		OldPath: e.OldPath, NewPath: e.NewPath}
+	if e.Change != ChangeUnknown {
+		r.Change = e.Change.String()
+	}
+	if e.FileInfo != nil {
+		r.Name = e.Name()
+		r.Size = e.Size()
+		r.Mode = e.Mode()
+		r.ModTime = e.ModTime()
+		r.IsDir = e.IsDir()
+	}
+	return r
+}
+
+func (r record) event() (Event, error) {
+	for op, name := range ops {
+		if name == r.Op {
+			return Event{
+				Op:   op,
+				Path: r.Path,
+				FileInfo: &fileInfo{
+					name:    r.Name,
+					size:    r.Size,
+					mode:    r.Mode,
+					modTime: r.ModTime,
+					dir:     r.IsDir,
+				},
+				ChangedKeys: r.ChangedKeys,
+				Detail:      r.Detail,
+				Change:      r.change(),
+				Transaction: r.Transaction,
+				OldPath:     r.OldPath,
+				NewPath:     r.NewPath,
+			}, nil
+		}
+	}
+	return Event{}, fmt.Errorf("error: unknown op %q in recording", r.Op)
+}
+
+func (r record) change() ChangeKind {
+	for kind, name := range changeKinds {
+		if name == r.Change {
+			return kind
+		}
+	}
+	return ChangeUnknown
+}
+
+// 把之后发送的每个事件以JSON行的格式录制到out，out为nil时停止录制
+// 写入失败时会把错误发送到Error并停止录制；设置了SetSigningKey的话每一行都带有HMAC
+func (w *Watcher) Record(out io.Writer) {
+	w.recMu.Lock()
+	defer w.recMu.Unlock()
+
+	if out == nil {
+		w.recorder = nil
+		return
+	}
+	w.recorder = json.NewEncoder(out)
+}
+
+// 设置签名密钥，之后录制的每个事件都带有HMAC-SHA256签名，下游可以用同一个密钥校验事件没有被伪造或篡改
+// key为空时不签名
+func (w *Watcher) SetSigningKey(key []byte) {
+	w.recMu.Lock()
+	w.signKey = append([]byte(nil), key...)
+	w.recMu.Unlock()
+}
+
+// 录制一个已经发送的事件
+func (w *Watcher) recordTo(e Event) {
+	w.recMu.Lock()
+	if w.recorder == nil {
+		w.recMu.Unlock()
+		return
+	}
+	err := w.recorder.Encode(newRecord(w.clock.Now(), e).sign(w.signKey))
+	if err != nil {
+		w.recorder = nil
+	}
+	w.recMu.Unlock()
+
+	if err != nil {
+		w.sendError(err)
+	}
+}
+
+// Replayer 把Watcher.Record录制的事件重新发送出来，实现了Notifier，
+// 可以代替Watcher接到下游逻辑上，用真实录制的文件活动做回归测试
+type Replayer struct {
+	Event  chan Event
+	Error  chan error
+	Closed chan struct{}
+
+	mu       sync.Mutex
+	in       io.Reader
+	names    map[string]bool
+	realtime bool
+	signKey  []byte
+	running  bool
+	close    chan struct{}
+}
+
+var _ Notifier = (*Replayer)(nil)
+
+// 创建一个从in读取录制内容的Replayer
+func NewReplayer(in io.Reader) *Replayer {
+	return &Replayer{
+		Event:  make(chan Event),
+		Error:  make(chan error),
+		Closed: make(chan struct{}),
+		in:     in,
+		names:  make(map[string]bool),
+		close:  make(chan struct{}),
+	}
+}
+
+// 设置是否按照录制时事件之间的间隔发送，默认不等待，尽快发送所有事件
+func (r *Replayer) SetRealtime(realtime bool) {
+	r.mu.Lock()
+	r.realtime = realtime
+	r.mu.Unlock()
+}
+
+// 设置校验签名的密钥，签名缺失或者不正确的事件不会被重放，而是把ErrInvalidSignature发送到Error
+func (r *Replayer) SetSigningKey(key []byte) {
+	r.mu.Lock()
+	r.signKey = append([]byte(nil), key...)
+	r.mu.Unlock()
+}
+
+// 只重放name以及它下面的路径的事件，没有Add过任何路径时重放所有事件
+func (r *Replayer) Add(name string) error {
+	r.mu.Lock()
+	r.names[name] = true
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Replayer) AddRecursive(name string) error {
+	return r.Add(name)
+}
+
+func (r *Replayer) Remove(name string) error {
+	r.mu.Lock()
+	delete(r.names, name)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Replayer) RemoveRecursive(name string) error {
+	return r.Remove(name)
+}
+
+func (r *Replayer) Events() <-chan Event {
+	return r.Event
+}
+
+func (r *Replayer) Errors() <-chan error {
+	return r.Error
+}
+
+// 判断事件是否在Add过的路径下
+func (r *Replayer) match(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.names) == 0 {
+		return true
+	}
+	for name := range r.names {
+		if path == name || strings.HasPrefix(path, name+string(os.PathSeparator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start 开始重放，所有事件发送完或者调用Close之后返回，返回前会关闭Closed
+// d没有实际作用，只是为了和Watcher保持一致
+func (r *Replayer) Start(d time.Duration) error {
+	if d < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	r.mu.Lock()
+	if r.running {
+		r.mu.Unlock()
+		return ErrWatcherRunning
+	}
+	r.running = true
+	realtime := r.realtime
+	key := r.signKey
+	r.mu.Unlock()
+	defer close(r.Closed)
+
+	scanner := bufio.NewScanner(r.in)
+	scanner.Buffer(nil, 1<<20)
+	var last time.Time
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			if r.sendError(err) {
+				return nil
+			}
+			continue
+		}
+		if err := rec.verify(key); err != nil {
+			if r.sendError(err) {
+				return nil
+			}
+			continue
+		}
+		event, err := rec.event()
+		if err != nil {
+			if r.sendError(err) {
+				return nil
+			}
+			continue
+		}
+		if !r.match(event.Path) {
+			continue
+		}
+		if realtime && !last.IsZero() && rec.Time.After(last) {
+			select {
+			case <-r.close:
+				return nil
+			case <-time.After(rec.Time.Sub(last)):
+			}
+		}
+		last = rec.Time
+		select {
+		case <-r.close:
+			return nil
+		case r.Event <- event:
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		r.sendError(err)
+	}
+	return nil
+}
+
+// 发送一个错误，重放被关闭的话返回true
+func (r *Replayer) sendError(err error) bool {
+	select {
+	case <-r.close:
+		return true
+	case r.Error <- err:
+		return false
+	}
+}
+
+// 停止重放
+func (r *Replayer) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		return
+	}
+	r.running = false
+	close(r.close)
+}
@@ -0,0 +1,231 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Sink 是事件的输出，比如写到文件、发到消息队列
+type Sink interface {
+	Send(Event) error
+	Close() error
+}
+
+// Filter 返回false的事件会被丢弃
+type Filter func(Event) bool
+
+// 根据配置创建Sink和Filter的函数，配置的内容由各个实现自己解释
+type (
+	SinkFactory   func(config map[string]string) (Sink, error)
+	FilterFactory func(config map[string]string) (Filter, error)
+	// 创建持有资源的Filter，比如加载了WebAssembly模块，返回的io.Closer在不再使用Filter时释放这些资源
+	FilterCloserFactory func(config map[string]string) (Filter, io.Closer, error)
+)
+
+// 按名字查找没有注册过的Sink或Filter时返回这个错误
+var ErrNotRegistered = errors.New("error: not registered")
+
+var (
+	registryMu sync.Mutex
+	sinks      = make(map[string]SinkFactory)
+	filters    = make(map[string]FilterFactory)
+	closers    = make(map[string]FilterCloserFactory)
+)
+
+// 注册一种Sink，通常在实现所在包的init里调用，使用者通过空导入(import _)或者plugins.Load加载，
+// 不用修改和重新编译使用它的程序；同一个名字注册两次会panic
+func RegisterSink(name string, factory SinkFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := sinks[name]; found {
+		panic("watcher: RegisterSink called twice for " + name)
+	}
+	sinks[name] = factory
+}
+
+// 注册一种Filter，和RegisterSink一样
+func RegisterFilter(name string, factory FilterFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := filters[name]; found {
+		panic("watcher: RegisterFilter called twice for " + name)
+	}
+	if _, found := closers[name]; found {
+		panic("watcher: RegisterFilter called twice for " + name)
+	}
+	filters[name] = factory
+}
+
+// 注册一种需要释放资源的Filter，只能通过OpenFilter创建；名字和RegisterFilter注册的共用，重复注册会panic
+func RegisterFilterCloser(name string, factory FilterCloserFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, found := filters[name]; found {
+		panic("watcher: RegisterFilterCloser called twice for " + name)
+	}
+	if _, found := closers[name]; found {
+		panic("watcher: RegisterFilterCloser called twice for " + name)
+	}
+	closers[name] = factory
+}
+
+// 按名字创建Sink
+func NewSink(name string, config map[string]string) (Sink, error) {
+	registryMu.Lock()
+	factory, found := sinks[name]
+	registryMu.Unlock()
+	if !found {
+		return nil, fmt.Errorf("%w: sink %s", ErrNotRegistered, name)
+	}
+	return factory(config)
+}
+
+// 按名字创建Filter，通过RegisterFilterCloser注册的Filter需要释放资源，要用OpenFilter创建
+func NewFilter(name string, config map[string]string) (Filter, error) {
+	registryMu.Lock()
+	factory, found := filters[name]
+	_, closer := closers[name]
+	registryMu.Unlock()
+	if closer {
+		return nil, fmt.Errorf("error: filter %s holds resources, use OpenFilter", name)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: filter %s", ErrNotRegistered, name)
+	}
+	return factory(config)
+}
+
+// 按名字创建任何一种Filter，不再使用时调用返回的io.Closer，不需要释放资源的Filter返回的Close什么也不做
+func OpenFilter(name string, config map[string]string) (Filter, io.Closer, error) {
+	registryMu.Lock()
+	factory, found := filters[name]
+	closerFactory, closer := closers[name]
+	registryMu.Unlock()
+	if closer {
+		return closerFactory(config)
+	}
+	if !found {
+		return nil, nil, fmt.Errorf("%w: filter %s", ErrNotRegistered, name)
+	}
+	f, err := factory(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, nopCloser{}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// 返回所有注册过的Sink的名字，按名字排序
+func Sinks() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 返回所有注册过的Filter的名字，按名字排序
+func Filters() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(filters)+len(closers))
+	for name := range filters {
+		names = append(names, name)
+	}
+	for name := range closers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Middleware 把Filter转换成Dispatcher的中间件
+func (f Filter) Middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(e Event) {
+			if f(e) {
+				next(e)
+			}
+		}
+	}
+}
+
+// SinkHandler 把Sink转换成Dispatcher的处理函数，发送失败的错误交给onError，onError可以为nil
+func SinkHandler(s Sink, onError func(error)) HandlerFunc {
+	return func(e Event) {
+		if err := s.Send(e); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+}
+
+func init() {
+	RegisterSink("jsonl", newJSONLSink)
+	RegisterFilter("ops", newOpsFilter)
+}
+
+// 把事件按Record的格式一行一个写到文件里，配置path为空时写到标准输出，key不为空时签名
+type jsonlSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	key []byte
+}
+
+func newJSONLSink(config map[string]string) (Sink, error) {
+	s := &jsonlSink{f: os.Stdout, key: []byte(config["key"])}
+	if path := config["path"]; path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		s.f = f
+	}
+	return s, nil
+}
+
+func (s *jsonlSink) Send(e Event) error {
+	data, err := MarshalEvent(e, s.key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *jsonlSink) Close() error {
+	if s.f == os.Stdout {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// 只保留配置ops里列出的事件类型，比如 "CREATE,WRITE"
+func newOpsFilter(config map[string]string) (Filter, error) {
+	allowed := make(map[Op]bool)
+	for _, name := range strings.Split(config["ops"], ",") {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		op, err := ParseOp(name)
+		if err != nil {
+			return nil, err
+		}
+		allowed[op] = true
+	}
+	return func(e Event) bool {
+		return allowed[e.Op]
+	}, nil
+}
@@ -0,0 +1,149 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Action 是对命中规则的文件执行的响应动作，返回执行结果的说明
+type Action func(path string, info os.FileInfo) (string, error)
+
+type response struct {
+	name   string
+	rule   Rule
+	action Action
+}
+
+// 检测到需要执行的响应
+type pendingResponse struct {
+	name   string
+	path   string
+	info   os.FileInfo
+	reason string
+	action Action
+}
+
+// 添加一个响应：新建或者发生变化的文件命中rule时自动执行action，
+// 执行结果以Response事件发送，Detail的格式是 "响应名: 规则说明 -> 执行结果"
+// action在扫描的goroutine里同步执行，这一轮的事件会等所有action执行完之后再发送
+func (w *Watcher) AddResponse(name string, rule Rule, action Action) {
+	w.mu.Lock()
+	w.responses = append(w.responses, response{name: name, rule: rule, action: action})
+	w.mu.Unlock()
+}
+
+// 找出需要对文件执行的响应，调用的时候需要持有w.mu
+func (w *Watcher) matchResponses(path string, oldInfo, info os.FileInfo) []pendingResponse {
+	var pending []pendingResponse
+	for _, r := range w.responses {
+		if reason := r.rule(path, oldInfo, info); reason != "" {
+			pending = append(pending, pendingResponse{
+				name:   r.name,
+				path:   path,
+				info:   info,
+				reason: reason,
+				action: r.action,
+			})
+		}
+	}
+	return pending
+}
+
+// 执行响应并返回结果事件，调用的时候不能持有w.mu
+func (w *Watcher) runResponses(pending []pendingResponse) []Event {
+	var events []Event
+	for _, p := range pending {
+		result, err := p.action(p.path, p.info)
+		if err != nil {
+			result = "failed: " + err.Error()
+		}
+		detail := fmt.Sprintf("%s: %s -> %s", p.name, p.reason, result)
+		w.trace(p.path, Response, "action: %s", detail)
+		events = append(events, Event{Op: Response, Path: p.path, FileInfo: p.info, Detail: detail})
+	}
+	return events
+}
+
+// NewExecutableRule 是内置的规则：sensitive下面出现了新的可执行文件
+// (有执行权限，或者是.exe/.bat/.cmd/.ps1/.sh等扩展名)，不传路径时对所有被监控的路径生效
+func NewExecutableRule(sensitive ...string) Rule {
+	roots := make([]string, len(sensitive))
+	for i, root := range sensitive {
+		roots[i] = root
+		if abs, err := filepath.Abs(root); err == nil {
+			roots[i] = abs
+		}
+	}
+	exts := map[string]bool{".exe": true, ".bat": true, ".cmd": true, ".ps1": true, ".sh": true, ".com": true}
+	return func(path string, oldInfo, info os.FileInfo) string {
+		if oldInfo != nil || info.IsDir() {
+			return ""
+		}
+		if len(roots) > 0 && !underAny(path, roots) {
+			return ""
+		}
+		if info.Mode().Perm()&0111 != 0 {
+			return fmt.Sprintf("new executable (%s)", info.Mode().Perm())
+		}
+		if exts[strings.ToLower(filepath.Ext(path))] {
+			return "new executable (" + filepath.Ext(path) + ")"
+		}
+		return ""
+	}
+}
+
+// ChmodAction 把文件的权限改成mode，比如0000
+func ChmodAction(mode os.FileMode) Action {
+	return func(path string, info os.FileInfo) (string, error) {
+		if err := os.Chmod(path, mode); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("chmod %s", mode), nil
+	}
+}
+
+// QuarantineAction 把文件移动到隔离目录dir，重名时在文件名后面加上序号
+func QuarantineAction(dir string) Action {
+	return func(path string, info os.FileInfo) (string, error) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+		dest := filepath.Join(dir, filepath.Base(path))
+		for i := 1; ; i++ {
+			if _, err := os.Lstat(dest); os.IsNotExist(err) {
+				break
+			}
+			dest = filepath.Join(dir, fmt.Sprintf("%s.%d", filepath.Base(path), i))
+		}
+		if err := os.Rename(path, dest); err != nil {
+			return "", err
+		}
+		return "moved to " + dest, nil
+	}
+}
+
+// CommandAction 执行外部命令(比如病毒扫描程序)，文件路径作为最后一个参数，
+// 结果是命令输出的第一行
+func CommandAction(name string, args ...string) Action {
+	return func(path string, info os.FileInfo) (string, error) {
+		cmdArgs := append(append([]string(nil), args...), path)
+		out, err := exec.Command(name, cmdArgs...).CombinedOutput()
+		result := strings.TrimSpace(string(out))
+		if i := strings.IndexByte(result, '\n'); i >= 0 {
+			result = result[:i]
+		}
+		if err != nil {
+			if result != "" {
+				return "", fmt.Errorf("%v: %s", err, result)
+			}
+			return "", err
+		}
+		if result == "" {
+			result = "ok"
+		}
+		return name + ": " + result, nil
+	}
+}
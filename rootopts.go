@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// 单个root的设置，见AddWithOptions
+type rootOptions struct {
+	recursive bool
+	interval  time.Duration
+	ops       map[Op]struct{}
+	listed    time.Time // 上一次列出这个root的时间
+}
+
+// AddWithOptions 的选项
+type WatchOption func(*rootOptions)
+
+// 递归监控这个root，相当于用AddRecursive添加
+func Recursive() WatchOption {
+	return func(o *rootOptions) {
+		o.recursive = true
+	}
+}
+
+// 这个root自己的轮询间隔，比全局的间隔长时这个root隔这么久才重新列出一次，中间沿用上一次的文件列表；
+// 比全局的间隔短时扫描的间隔会缩短到这个值，其他root仍然按全局的间隔列出
+func Interval(d time.Duration) WatchOption {
+	return func(o *rootOptions) {
+		o.interval = d
+	}
+}
+
+// 这个root下只报告这些类型的事件，和FilterOps同时生效
+func Ops(ops ...Op) WatchOption {
+	return func(o *rootOptions) {
+		o.ops = make(map[Op]struct{})
+		for _, op := range ops {
+			o.ops[op] = struct{}{}
+		}
+	}
+}
+
+// 添加一个root，同时给它单独设置轮询间隔、是否递归和事件类型，比如
+// w.AddWithOptions("/logs", watcher.Recursive(), watcher.Interval(5*time.Second), watcher.Ops(watcher.Write))
+// 经常变化的源码目录和很少变化的资源目录可以用不同的间隔；root被移除之后它的设置也被丢掉，重新添加时需要重新设置
+func (w *Watcher) AddWithOptions(name string, opts ...WatchOption) error {
+	o := &rootOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.interval != 0 && o.interval < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	var err error
+	if o.recursive {
+		err = w.AddRecursive(name)
+	} else {
+		err = w.Add(name)
+	}
+	if err != nil {
+		return err
+	}
+
+	key, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	if hasMeta(key) {
+		key, _ = splitGlob(key)
+	}
+	w.mu.Lock()
+	if _, found := w.names[key]; found {
+		if w.rootOpts == nil {
+			w.rootOpts = make(map[string]*rootOptions)
+		}
+		w.rootOpts[key] = o
+	}
+	w.mu.Unlock()
+	select {
+	case w.intervalChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// root按自己的间隔这一轮是否不需要重新列出，需要列出时记录列出的时间，调用的时候需要持有w.mu
+func (w *Watcher) rootNotDue(name string, now time.Time) bool {
+	o, found := w.rootOpts[name]
+	if !found || o.interval <= 0 {
+		return false
+	}
+	// 扫描不会正好在间隔到期的时刻进行，差不到半个扫描间隔就算到期
+	if !o.listed.IsZero() && now.Sub(o.listed)+w.shortestInterval()/2 < o.interval {
+		return true
+	}
+	o.listed = now
+	return false
+}
+
+// 扫描间隔，取全局间隔和各个root自己的间隔中最短的，调用的时候需要持有w.mu
+func (w *Watcher) shortestInterval() time.Duration {
+	d := w.interval
+	for _, o := range w.rootOpts {
+		if o.interval > 0 && o.interval < d {
+			d = o.interval
+		}
+	}
+	return d
+}
+
+// 事件是否满足所属root的Ops
+func (w *Watcher) rootAllows(e Event) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.rootOpts) == 0 {
+		return true
+	}
+	root, found := w.rootOf(eventPaths(e)[0])
+	if !found {
+		return true
+	}
+	o, found := w.rootOpts[root]
+	if !found || o.ops == nil {
+		return true
+	}
+	_, allowed := o.ops[e.Op]
+	return allowed
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// RootState 是一个被监控的root的状态
+type RootState uint32
+
+const (
+	RootHealthy          RootState = iota // 最近一次扫描正常
+	RootMissing                           // root已经被删除，不再扫描
+	RootPermissionDenied                  // 没有权限列出root
+	RootError                             // 列出root的时候出现了其他错误
+	RootDegraded                          // root太大，正在抽样扫描，见SetSamplingPolicy
+)
+
+var rootStates = map[RootState]string{
+	RootHealthy:          "HEALTHY",
+	RootMissing:          "MISSING",
+	RootPermissionDenied: "PERMISSION_DENIED",
+	RootError:            "ERROR",
+	RootDegraded:         "DEGRADED",
+}
+
+func (s RootState) String() string {
+	if state, found := rootStates[s]; found {
+		return state
+	}
+	return "???"
+}
+
+// RootStatus 是一个通过Add或者AddRecursive注册的root的健康状况
+type RootStatus struct {
+	Path      string
+	Recursive bool
+	State     RootState
+	LastScan  time.Time // 最近一次成功列出文件的时间
+	Err       error     // 最近一次的错误
+	ErrTime   time.Time // 最近一次出错的时间
+	Failures  int       // 连续失败的次数，扫描成功之后清零
+	Restarts  int       // 从失败中恢复的次数
+	RetryAt   time.Time // 退避期间下一次重新扫描的时间，见SetRestartBackoff
+}
+
+// 返回每个root的状态，按路径排序
+// 被删除的root虽然不再扫描，但是会以RootMissing的状态保留在这里，直到调用Remove或者RemoveRecursive
+func (w *Watcher) RootStatus() []RootStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	statuses := make([]RootStatus, 0, len(w.roots))
+	for _, status := range w.roots {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Path < statuses[j].Path
+	})
+	return statuses
+}
+
+// 根据列出root的结果更新root的状态，调用的时候需要持有w.mu
+func (w *Watcher) setRootStatus(name string, recursive bool, err error) {
+	status, found := w.roots[name]
+	if !found {
+		status = RootStatus{Path: name, Recursive: recursive}
+	}
+	now := w.clock.Now()
+	switch {
+	case err == nil:
+		status.State = RootHealthy
+		status.LastScan = now
+		if st := w.sampling[name]; st != nil && st.degraded {
+			status.State = RootDegraded
+		}
+	case os.IsNotExist(err):
+		status.State = RootMissing
+	case os.IsPermission(err):
+		status.State = RootPermissionDenied
+	default:
+		status.State = RootError
+	}
+	if err != nil {
+		status.Err = err
+		status.ErrTime = now
+	}
+	w.roots[name] = status
+}
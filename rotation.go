@@ -0,0 +1,56 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+)
+
+// 设置是否检测日志轮转，开启后同一路径下的文件被换成了另一个文件(改名后重建)，
+// 或者文件被截短(copytruncate)时，发送Rotated事件代替Write事件，
+// Detail里说明轮转的方式和新旧文件的标识，日志采集程序收到之后重新打开文件即可
+// 改名后重建的方式下，旧文件的新路径会写在Detail里，不再单独发送Create事件
+// 在不能获得inode的平台上(Windows)只能检测copytruncate
+func (w *Watcher) DetectRotation(enable bool) {
+	w.mu.Lock()
+	w.detectRotation = enable
+	w.mu.Unlock()
+}
+
+// 返回文件的标识"设备:inode"，不支持的平台返回空字符串
+func identity(info os.FileInfo) string {
+	dev, ino, ok := fileID(info)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", dev, ino)
+}
+
+// 判断path上的文件是否被轮转了，creates是这一轮新出现的路径，
+// 旧文件被改名到了其中某个路径时返回这个路径，调用的时候需要持有w.mu
+func (w *Watcher) rotation(path string, oldInfo, info os.FileInfo, creates map[string]os.FileInfo) (e Event, movedTo string, found bool) {
+	if !w.detectRotation || info.IsDir() {
+		return Event{}, "", false
+	}
+	oldID, newID := identity(oldInfo), identity(info)
+	switch {
+	case oldID != "" && newID != "" && oldID != newID:
+		for p, created := range creates {
+			if sameFile(oldInfo, created) {
+				movedTo = p
+				break
+			}
+		}
+		if movedTo != "" {
+			e.Detail = fmt.Sprintf("renamed to %s and recreated, identity %s -> %s", movedTo, oldID, newID)
+		} else {
+			e.Detail = fmt.Sprintf("replaced by a new file, identity %s -> %s", oldID, newID)
+		}
+	case info.Size() < oldInfo.Size():
+		e.Detail = fmt.Sprintf("truncated from %d to %d bytes, identity %s", oldInfo.Size(), info.Size(), newID)
+	default:
+		return Event{}, "", false
+	}
+	e.Op, e.Path, e.FileInfo = Rotated, path, info
+	w.trace(path, Rotated, "detected: %s", e.Detail)
+	return e, movedTo, true
+}
@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rule 检查一个新建或者发生变化的文件，违反策略的时候返回说明，没有违反时返回空字符串
+// 新建的文件oldInfo为nil
+type Rule func(path string, oldInfo, info os.FileInfo) string
+
+type namedRule struct {
+	name string
+	rule Rule
+}
+
+// 添加一条策略规则，新建、修改或者修改权限的文件违反规则时发送Violation事件，
+// Detail的格式是 "规则名: 说明"
+func (w *Watcher) AddRule(name string, rule Rule) {
+	w.mu.Lock()
+	w.rules = append(w.rules, namedRule{name: name, rule: rule})
+	w.mu.Unlock()
+}
+
+// 对文件执行所有规则，返回违反规则的Violation事件，调用的时候需要持有w.mu
+func (w *Watcher) applyRules(path string, oldInfo, info os.FileInfo) []Event {
+	var events []Event
+	for _, r := range w.rules {
+		if detail := r.rule(path, oldInfo, info); detail != "" {
+			detail = r.name + ": " + detail
+			w.trace(path, Violation, "detected: %s", detail)
+			events = append(events, Event{Op: Violation, Path: path, FileInfo: info, Detail: detail})
+		}
+	}
+	return events
+}
+
+// WritableRule 是内置的规则：sensitive下面的文件或目录变成组可写或者所有人可写时违反规则
+// 不传路径时对所有被监控的路径生效
+func WritableRule(sensitive ...string) Rule {
+	roots := make([]string, len(sensitive))
+	for i, root := range sensitive {
+		roots[i] = root
+		if abs, err := filepath.Abs(root); err == nil {
+			roots[i] = abs
+		}
+	}
+	return func(path string, oldInfo, info os.FileInfo) string {
+		if len(roots) > 0 && !underAny(path, roots) {
+			return ""
+		}
+		var oldPerm os.FileMode
+		if oldInfo != nil {
+			oldPerm = oldInfo.Mode().Perm()
+		}
+		gained := info.Mode().Perm() &^ oldPerm
+		var who []string
+		if gained&0020 != 0 {
+			who = append(who, "group")
+		}
+		if gained&0002 != 0 {
+			who = append(who, "world")
+		}
+		if len(who) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("became %s-writable (%s)", strings.Join(who, " and "), info.Mode().Perm())
+	}
+}
+
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if underPath(path, root) {
+			return true
+		}
+	}
+	return false
+}
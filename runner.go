@@ -0,0 +1,177 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Runner 的默认设置
+const (
+	defaultRunnerGrace = 5 * time.Second
+	defaultRunnerQuiet = 100 * time.Millisecond
+)
+
+// Runner 把一个命令和Watcher绑在一起：收到匹配的事件之后停掉上一次启动的子进程，再重新启动，
+// 也就是live reload工具的核心部分；子进程在Unix上单独成为一个进程组，停止的时候整组一起停，
+// shell启动的孙子进程也不会残留
+type Runner struct {
+	// 命令模板，每次启动时复制Path、Args、Env、Dir、Stdin、Stdout、Stderr和ExtraFiles
+	Template *exec.Cmd
+	// 停止子进程时先发送的信号，为nil时使用os.Interrupt；Windows上不支持信号，直接结束进程
+	Signal os.Signal
+	// 发送信号之后等待子进程退出的时间，超时之后强制结束，小于等于0时使用默认的5秒
+	Grace time.Duration
+	// 一次修改往往会产生一串事件，收到第一个匹配的事件之后，等待这么久没有新事件才重启，小于等于0时使用默认的100ms
+	Quiet time.Duration
+	// 判断事件是否需要重启，为nil时所有事件都重启
+	Match func(Event) bool
+	// 启动失败、子进程异常退出以及Notifier的错误交给这里，为nil时忽略
+	OnError func(error)
+
+	mu   sync.Mutex
+	cmd  *exec.Cmd
+	done chan struct{} // 子进程退出时关闭
+}
+
+// Template为nil的时候Start返回这个错误
+var ErrNoCommand = errors.New("error: runner has no command")
+
+// 创建一个运行template的Runner
+func NewRunner(template *exec.Cmd) *Runner {
+	return &Runner{Template: template}
+}
+
+// 启动子进程，已经在运行的时候先停掉
+func (r *Runner) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stop()
+	if r.Template == nil {
+		return ErrNoCommand
+	}
+	t := r.Template
+	cmd := exec.Command(t.Path)
+	cmd.Args = t.Args
+	cmd.Env = t.Env
+	cmd.Dir = t.Dir
+	cmd.Stdin = t.Stdin
+	cmd.Stdout = t.Stdout
+	cmd.Stderr = t.Stderr
+	cmd.ExtraFiles = t.ExtraFiles
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	r.cmd, r.done = cmd, done
+	go func() {
+		err := cmd.Wait()
+		close(done)
+		// 被Runner自己停掉的时候不算错误
+		r.mu.Lock()
+		stopped := r.cmd != cmd
+		r.mu.Unlock()
+		if err != nil && !stopped {
+			r.report(err)
+		}
+	}()
+	return nil
+}
+
+// 停止子进程，等它退出之后返回
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	r.stop()
+	r.mu.Unlock()
+}
+
+// 子进程是否还在运行
+func (r *Runner) Running() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done == nil {
+		return false
+	}
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// 先发送Signal，Grace之后还没有退出的话强制结束，调用的时候需要持有r.mu
+func (r *Runner) stop() {
+	cmd, done := r.cmd, r.done
+	r.cmd, r.done = nil, nil
+	if cmd == nil {
+		return
+	}
+	select {
+	case <-done:
+		return
+	default:
+	}
+
+	sig := r.Signal
+	if sig == nil {
+		sig = os.Interrupt
+	}
+	grace := r.Grace
+	if grace <= 0 {
+		grace = defaultRunnerGrace
+	}
+	if err := signalGroup(cmd, sig); err != nil {
+		killGroup(cmd)
+	}
+	select {
+	case <-done:
+	case <-time.After(grace):
+		killGroup(cmd)
+		<-done
+	}
+}
+
+func (r *Runner) report(err error) {
+	if r.OnError != nil {
+		r.OnError(err)
+	}
+}
+
+// Serve 启动子进程，之后从n读取事件，匹配的事件安静了Quiet之后重启子进程，直到done被关闭，返回前停止子进程
+// 对于Watcher可以把w.Closed作为done
+func (r *Runner) Serve(n Notifier, done <-chan struct{}) error {
+	if err := r.Start(); err != nil {
+		return err
+	}
+	defer r.Stop()
+
+	quiet := r.Quiet
+	if quiet <= 0 {
+		quiet = defaultRunnerQuiet
+	}
+	events, errors := n.Events(), n.Errors()
+	var restart <-chan time.Time
+	for {
+		select {
+		case e := <-events:
+			if r.Match == nil || r.Match(e) {
+				restart = time.After(quiet)
+			}
+		case err := <-errors:
+			r.report(err)
+		case <-restart:
+			restart = nil
+			if err := r.Start(); err != nil {
+				r.report(err)
+			}
+		case <-done:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package watcher
+
+import (
+	"os"
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// 没有进程组的平台只给子进程本身发送信号，Windows上发送os.Interrupt会返回错误，这时调用者直接结束进程
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
+
+func killGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
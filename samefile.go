@@ -1,7 +1,16 @@
+//go:build !windows
+// +build !windows
+
 package watcher
 
 import "os"
 
 func sameFile(fi1, fi2 os.FileInfo) bool {
+	// 扫描子进程返回的FileInfo不是os包的类型，用设备和inode比较
+	dev1, ino1, ok1 := fileID(fi1)
+	dev2, ino2, ok2 := fileID(fi2)
+	if ok1 && ok2 {
+		return dev1 == dev2 && ino1 == ino2
+	}
 	return os.SameFile(fi1, fi2)
 }
\ No newline at end of file
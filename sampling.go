@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SamplingPolicy 决定递归root什么时候降级为抽样扫描，以及降级之后怎么扫描
+// 降级之后root下的第一层子目录被分成Subsets组，每一轮只扫描其中一组，其他组沿用上一次的结果，
+// 每FullEvery轮做一次完整扫描，完整扫描时不再超过限制就恢复正常
+type SamplingPolicy struct {
+	MaxEntries  int           // 完整扫描的条目数超过这个值时降级，为0时不按条目数判断
+	MaxDuration time.Duration // 完整扫描的耗时超过这个值时降级，为0时不按耗时判断
+	Subsets     int           // 降级之后分成几组轮流扫描，小于2时按2处理
+	FullEvery   int           // 每隔多少轮做一次完整扫描，为0时等于Subsets
+}
+
+// 一个递归root的降级状态
+type samplingState struct {
+	degraded bool
+	cycle    int
+	sampled  bool // 这一轮是不是抽样扫描
+}
+
+// 设置超大root的降级策略，降级时发送一个Degraded事件，RootStatus里的状态是RootDegraded，
+// 与其一直跟不上轮询间隔，不如牺牲一部分及时性；抽样期间没有扫描到的子目录里的变化会推迟到轮到它们的时候才发现
+// 通过ScanAsUser扫描的root不会降级
+func (w *Watcher) SetSamplingPolicy(policy SamplingPolicy) {
+	if policy.Subsets < 2 {
+		policy.Subsets = 2
+	}
+	if policy.FullEvery <= 0 {
+		policy.FullEvery = policy.Subsets
+	}
+	w.mu.Lock()
+	w.samplingPolicy = policy
+	w.sampling = make(map[string]*samplingState)
+	w.mu.Unlock()
+}
+
+// 如果这一轮要抽样扫描name，返回判断子目录是否跳过的函数，否则返回nil，调用的时候需要持有w.mu
+func (w *Watcher) sampleSkip(name string) func(path string) bool {
+	st := w.sampling[name]
+	if st == nil {
+		return nil
+	}
+	st.sampled = false
+	if !st.degraded {
+		return nil
+	}
+	st.cycle++
+	if st.cycle%w.samplingPolicy.FullEvery == 0 {
+		return nil
+	}
+	st.sampled = true
+	subsets := uint32(w.samplingPolicy.Subsets)
+	current := uint32(st.cycle) % subsets
+	return func(path string) bool {
+		if filepath.Dir(path) != name {
+			return false
+		}
+		h := fnv.New32a()
+		h.Write([]byte(path))
+		return h.Sum32()%subsets != current
+	}
+}
+
+// 抽样扫描name，跳过的子目录下的文件沿用w.files里上一次的结果，调用的时候需要持有w.mu
+func (w *Watcher) listSampled(name string, skip func(path string) bool) (map[string]os.FileInfo, error) {
+	skipped := make(map[string]bool)
+	list, err := w.walkTree(name, func(path string) bool {
+		if skip(path) {
+			skipped[path] = true
+			return true
+		}
+		return false
+	}, true)
+	if len(skipped) == 0 {
+		return list, err
+	}
+	prefix := name + string(filepath.Separator)
+	for path, info := range w.files {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		// 找到path所在的第一层子目录
+		top := path
+		if i := strings.IndexRune(path[len(prefix):], filepath.Separator); i >= 0 {
+			top = path[:len(prefix)+i]
+		}
+		if top != path && skipped[top] {
+			list[path] = info
+		}
+	}
+	return list, err
+}
+
+// 根据完整扫描的结果判断root是否需要降级，调用的时候需要持有w.mu
+func (w *Watcher) checkDegraded(name string, list map[string]os.FileInfo, elapsed time.Duration) {
+	if w.sampling == nil || !w.names[name] {
+		return
+	}
+	st := w.sampling[name]
+	if st == nil {
+		st = &samplingState{}
+		w.sampling[name] = st
+	}
+	if st.sampled || w.helper != nil {
+		return
+	}
+	policy := w.samplingPolicy
+	entries := len(list)
+	var reason string
+	switch {
+	case policy.MaxEntries > 0 && entries > policy.MaxEntries:
+		reason = fmt.Sprintf("%d entries exceed %d", entries, policy.MaxEntries)
+	case policy.MaxDuration > 0 && elapsed > policy.MaxDuration:
+		reason = fmt.Sprintf("scan took %s, more than %s", elapsed, policy.MaxDuration)
+	}
+	if reason == "" {
+		if st.degraded {
+			st.degraded = false
+			w.trace(name, Degraded, "recovered: full scan within limits")
+		}
+		return
+	}
+	if st.degraded {
+		return
+	}
+	st.degraded, st.cycle = true, 0
+	detail := fmt.Sprintf("%s, scanning 1/%d of subdirectories per cycle", reason, policy.Subsets)
+	w.trace(name, Degraded, "detected: %s", detail)
+	w.rootEvents = append(w.rootEvents, Event{Op: Degraded, Path: name, FileInfo: list[name], Detail: detail})
+}
@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScanSummary 是一次扫描的汇总信息
+type ScanSummary struct {
+	Started  time.Time     // 扫描开始的时间
+	Duration time.Duration // 从开始扫描到这一轮事件全部发送完花费的时间
+	Files    int           // 扫描到的文件和目录数
+	Events   int           // 这一轮发送的事件数
+}
+
+// ScanOverrunError 在扫描文件列表花费的时间超过轮询间隔时发送到Error，
+// 说明设置的轮询间隔对于被监控的文件数量来说太短了
+type ScanOverrunError struct {
+	Duration time.Duration            // 这次扫描花费的时间
+	Interval time.Duration            // 轮询间隔
+	Roots    map[string]time.Duration // 每个root列出文件花费的时间
+}
+
+func (e *ScanOverrunError) Error() string {
+	roots := make([]string, 0, len(e.Roots))
+	for root := range e.Roots {
+		roots = append(roots, root)
+	}
+	// 耗时最多的root排在前面
+	sort.Slice(roots, func(i, j int) bool {
+		return e.Roots[roots[i]] > e.Roots[roots[j]]
+	})
+	for i, root := range roots {
+		roots[i] = fmt.Sprintf("%s (%s)", root, e.Roots[root])
+	}
+	return fmt.Sprintf("error: scan took %s, longer than interval %s: %s",
+		e.Duration, e.Interval, strings.Join(roots, ", "))
+}
+
+// 设置每次扫描开始时调用的函数，在轮询的goroutine里同步调用
+func (w *Watcher) OnScanStart(f func()) {
+	w.mu.Lock()
+	w.onScanStart = f
+	w.mu.Unlock()
+}
+
+// 设置每次扫描完成时调用的函数，在轮询的goroutine里同步调用
+func (w *Watcher) OnScanComplete(f func(ScanSummary)) {
+	w.mu.Lock()
+	w.onScanComplete = f
+	w.mu.Unlock()
+}
+
+func (w *Watcher) scanStarted() {
+	w.mu.Lock()
+	f := w.onScanStart
+	w.mu.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+func (w *Watcher) scanCompleted(summary ScanSummary) {
+	w.mu.Lock()
+	f := w.onScanComplete
+	w.mu.Unlock()
+	if f != nil {
+		f(summary)
+	}
+}
@@ -0,0 +1,29 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+)
+
+// 设置是否区分文件变小和变大，开启后文件内容变化时，除了Write之外，文件变小时再发送一个Truncate事件，
+// 变大时再发送一个Append事件，Detail里说明大小的变化；只比较修改前后的大小，不检查原来的内容是否保持不变，
+// 日志轮转工具可以据此区分被截断和被追加；同时开启DetectRotation时，截断按Rotated报告，不再发送Truncate
+func (w *Watcher) DetectSizeChanges(enable bool) {
+	w.mu.Lock()
+	w.detectSize = enable
+	w.mu.Unlock()
+}
+
+// 文件大小变化时返回Truncate或Append事件，调用的时候需要持有w.mu
+func (w *Watcher) sizeChange(path string, oldInfo, info os.FileInfo) (Event, bool) {
+	if !w.detectSize || info.IsDir() || oldInfo.Size() == info.Size() {
+		return Event{}, false
+	}
+	op := Append
+	if info.Size() < oldInfo.Size() {
+		op = Truncate
+	}
+	detail := fmt.Sprintf("size %d -> %d bytes", oldInfo.Size(), info.Size())
+	w.trace(path, op, "detected: %s", detail)
+	return Event{Op: op, Path: path, FileInfo: info, Detail: detail}, true
+}
@@ -0,0 +1,123 @@
+package watcher
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Snapshot 是一个目录在某一时刻的状态，可以保存到文件里，之后用Diff和另一个状态对比
+type Snapshot struct {
+	Root  string                 // 目录的绝对路径
+	Taken time.Time              // 拍快照的时间
+	Files map[string]os.FileInfo // 目录本身和它下面的所有文件
+}
+
+// 快照文件的格式，文件的编码和扫描子进程返回的一样
+type snapshotFile struct {
+	Root  string     `json:"root"`
+	Taken time.Time  `json:"taken"`
+	Files []scanFile `json:"files"`
+}
+
+// 递归列出root下的所有文件，返回它现在的状态
+func TakeSnapshot(root string) (Snapshot, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	files, err := New().listRecursive(root)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Root: root, Taken: time.Now(), Files: files}, nil
+}
+
+// 把快照以JSON格式写到out
+func (s Snapshot) WriteTo(out io.Writer) (int64, error) {
+	f := snapshotFile{Root: s.Root, Taken: s.Taken}
+	for path, info := range s.Files {
+		sf := scanFile{
+			Path:    path,
+			Name:    info.Name(),
+			Size:    info.Size(),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+		if sys := info.Sys(); sys != nil {
+			sf.Sys, _ = json.Marshal(sys)
+		}
+		f.Files = append(f.Files, sf)
+	}
+	sort.Slice(f.Files, func(i, j int) bool {
+		return f.Files[i].Path < f.Files[j].Path
+	})
+	data, err := json.Marshal(f)
+	if err != nil {
+		return 0, err
+	}
+	n, err := out.Write(data)
+	return int64(n), err
+}
+
+// 读取WriteTo保存的快照
+func ReadSnapshot(in io.Reader) (Snapshot, error) {
+	var f snapshotFile
+	if err := json.NewDecoder(in).Decode(&f); err != nil {
+		return Snapshot{}, err
+	}
+	s := Snapshot{Root: f.Root, Taken: f.Taken, Files: make(map[string]os.FileInfo, len(f.Files))}
+	for _, sf := range f.Files {
+		s.Files[sf.Path] = &fileInfo{
+			name:    sf.Name,
+			size:    sf.Size,
+			mode:    sf.Mode,
+			modTime: sf.ModTime,
+			sys:     decodeSys(sf.Sys),
+			dir:     sf.Mode.IsDir(),
+		}
+	}
+	return s, nil
+}
+
+// Diff 对比两个快照，返回从old变成new产生的事件，和Watcher扫描时检测事件的规则一样，
+// 包括用inode识别重命名和移动；事件按路径排序
+func Diff(old, new Snapshot) []Event {
+	w := New()
+	w.files = old.Files
+	events, _ := w.detectEvents(new.Files)
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Path != events[j].Path {
+			return events[i].Path < events[j].Path
+		}
+		return events[i].Op < events[j].Op
+	})
+	return events
+}
+
+// WatchedFile 是Watcher.Snapshot返回的一个被监控的文件
+type WatchedFile struct {
+	Path      string      // 文件的绝对路径
+	FileInfo  os.FileInfo // 最近一次扫描时的信息
+	Root      string      // 所属的root，有多个时是最长的那个
+	Recursive bool        // 所属的root是否递归监控
+}
+
+// 返回所有被监控的文件以及它们所属的root，按路径排序；返回的是拷贝，可以在扫描进行的同时使用
+func (w *Watcher) Snapshot() []WatchedFile {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files := make([]WatchedFile, 0, len(w.files))
+	for path, info := range w.files {
+		root, _ := w.rootOf(path)
+		files = append(files, WatchedFile{Path: path, FileInfo: info, Root: root, Recursive: w.names[root]})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files
+}
@@ -0,0 +1,49 @@
+package watcher
+
+import "os"
+
+// SpecialPolicy 决定socket、FIFO、设备文件这些特殊文件怎么处理
+type SpecialPolicy uint32
+
+const (
+	SpecialFull      SpecialPolicy = iota // 和普通文件一样发送所有事件，这是默认值
+	SpecialExistence                      // 只发送Create、Remove和重命名事件，不比较大小、修改时间和权限
+	SpecialIgnore                         // 扫描时跳过，不发送任何事件
+)
+
+var specialPolicies = map[SpecialPolicy]string{
+	SpecialFull:      "FULL",
+	SpecialExistence: "EXISTENCE",
+	SpecialIgnore:    "IGNORE",
+}
+
+func (p SpecialPolicy) String() string {
+	if policy, found := specialPolicies[p]; found {
+		return policy
+	}
+	return "???"
+}
+
+// 特殊文件的类型位，符号链接和目录不算
+const specialModes = os.ModeSocket | os.ModeNamedPipe | os.ModeDevice | os.ModeCharDevice | os.ModeIrregular
+
+func isSpecial(info os.FileInfo) bool {
+	return info.Mode()&specialModes != 0
+}
+
+// 设置特殊文件的处理方式，比如设备文件的修改时间会随着读写一直变化，产生没有意义的Write事件
+// 直接通过Add添加的特殊文件不受SpecialIgnore影响
+func (w *Watcher) SpecialFiles(policy SpecialPolicy) {
+	w.mu.Lock()
+	w.specialPolicy = policy
+	w.mu.Unlock()
+}
+
+// 扫描的时候是否跳过这个文件
+func (w *Watcher) skipSpecial(path string, info os.FileInfo) bool {
+	if w.specialPolicy != SpecialIgnore || !isSpecial(info) {
+		return false
+	}
+	w.trace(path, Create, "not listed: special file")
+	return true
+}
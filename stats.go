@@ -0,0 +1,174 @@
+package watcher
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// Stats 是watcher的运行统计，用于在应用里展示watcher的健康状况
+type Stats struct {
+	Files    int           // 上一次扫描时监控的文件数
+	Dirs     int           // 上一次扫描时监控的目录数
+	LastScan time.Duration // 上一次扫描文件列表花费的时间
+	Events   map[Op]uint64 // 按事件类型统计的已发送事件数
+	Errors   uint64        // 发送到Error的错误数
+	Dropped  uint64        // 被过滤或者超过maxEvents而没有发送的事件数
+
+	DroppedBy map[DropReason]uint64 // 按原因统计的没有发送的事件数
+
+	LastLatency time.Duration // 最近一个Write或Create事件从文件修改到发送的延迟
+	MaxLatency  time.Duration // 最大的延迟
+	MeanLatency time.Duration // 平均延迟
+
+	Watches    int // 原生通知后端占用的watch描述符数，轮询的时候为0
+	WatchLimit int // 系统允许的watch描述符上限(Linux上是fs.inotify.max_user_watches)，未知时为0
+}
+
+// DropReason 是事件没有被发送的原因
+type DropReason uint32
+
+const (
+	DropFilterOps     DropReason = iota // 事件类型不在FilterOps里
+	DropFilterContent                   // 文件内容不匹配FilterContent
+	DropMaxEvents                       // 一次扫描的事件超过了SetMaxEvents，剩下的事件不再检测，只计一次
+	DropFilterExpr                      // 不满足FilterExpr的表达式
+	DropRateLimit                       // 超过了SetEventRateLimit的速率上限
+)
+
+var dropReasons = map[DropReason]string{
+	DropFilterOps:     "FILTER_OPS",
+	DropFilterContent: "FILTER_CONTENT",
+	DropMaxEvents:     "MAX_EVENTS",
+	DropFilterExpr:    "FILTER_EXPR",
+	DropRateLimit:     "RATE_LIMIT",
+}
+
+func (r DropReason) String() string {
+	if reason, found := dropReasons[r]; found {
+		return reason
+	}
+	return "???"
+}
+
+// 返回当前统计信息的一份拷贝
+func (w *Watcher) Stats() Stats {
+	w.statsMu.Lock()
+	defer w.statsMu.Unlock()
+
+	stats := w.stats
+	stats.WatchLimit = watchLimit()
+	stats.Events = make(map[Op]uint64, len(w.stats.Events))
+	for op, n := range w.stats.Events {
+		stats.Events[op] = n
+	}
+	stats.DroppedBy = make(map[DropReason]uint64, len(w.stats.DroppedBy))
+	for reason, n := range w.stats.DroppedBy {
+		stats.DroppedBy[reason] = n
+	}
+	return stats
+}
+
+// 记录一次扫描的结果
+func (w *Watcher) recordScan(fileList map[string]os.FileInfo, d time.Duration) {
+	files, dirs := 0, 0
+	for _, info := range fileList {
+		if info.IsDir() {
+			dirs++
+		} else {
+			files++
+		}
+	}
+	w.statsMu.Lock()
+	w.stats.Files = files
+	w.stats.Dirs = dirs
+	w.stats.LastScan = d
+	w.recordScanDuration(d)
+	w.statsMu.Unlock()
+}
+
+func (w *Watcher) recordEvent(event Event) {
+	w.statsMu.Lock()
+	if w.stats.Events == nil {
+		w.stats.Events = make(map[Op]uint64)
+		w.pathEvents = make(map[string]uint64)
+	}
+	w.stats.Events[event.Op]++
+	w.pathEvents[event.Path]++
+	w.statsMu.Unlock()
+}
+
+// PathCount 是一个路径和它发送过的事件数
+type PathCount struct {
+	Path  string
+	Count uint64
+}
+
+// 返回发送事件最多的n个路径，用来找出应该被忽略的频繁变化的文件(缓存、锁文件等)
+func (w *Watcher) TopChanged(n int) []PathCount {
+	w.statsMu.Lock()
+	counts := make([]PathCount, 0, len(w.pathEvents))
+	for path, count := range w.pathEvents {
+		counts = append(counts, PathCount{Path: path, Count: count})
+	}
+	w.statsMu.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Path < counts[j].Path
+	})
+	if n >= 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+func (w *Watcher) recordDropped(reason DropReason) {
+	w.statsMu.Lock()
+	if w.stats.DroppedBy == nil {
+		w.stats.DroppedBy = make(map[DropReason]uint64)
+	}
+	w.stats.Dropped++
+	w.stats.DroppedBy[reason]++
+	w.statsMu.Unlock()
+}
+
+// 计算Write和Create事件从文件修改时间到现在的延迟，记录到event.Latency和统计里
+func (w *Watcher) measureLatency(event *Event) {
+	if (event.Op != Write && event.Op != Create) || event.FileInfo == nil {
+		return
+	}
+	latency := w.since(event.ModTime())
+	if latency < 0 {
+		latency = 0
+	}
+	event.Latency = latency
+
+	w.statsMu.Lock()
+	w.latencySum += latency
+	w.latencyCount++
+	w.stats.LastLatency = latency
+	w.stats.MeanLatency = w.latencySum / time.Duration(w.latencyCount)
+	if latency > w.stats.MaxLatency {
+		w.stats.MaxLatency = latency
+	}
+	w.statsMu.Unlock()
+}
+
+// 发送一个错误到w.Error并计数，Scan执行期间收集起来由Scan返回
+func (w *Watcher) sendError(err error) {
+	w.statsMu.Lock()
+	w.stats.Errors++
+	if w.collecting {
+		w.collected = append(w.collected, err)
+		w.statsMu.Unlock()
+		return
+	}
+	w.statsMu.Unlock()
+	if w.handleError(err) {
+		return
+	}
+	w.Error <- err
+}
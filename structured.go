@@ -0,0 +1,168 @@
+package watcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ParseFunc 把结构化文件的内容解析成嵌套的map
+type ParseFunc func(data []byte) (map[string]interface{}, error)
+
+var (
+	formatsMu sync.RWMutex
+	// 按扩展名注册的解析函数，默认只支持JSON
+	formats = map[string]ParseFunc{
+		".json": parseJSON,
+	}
+)
+
+// RegisterFormat 为扩展名(比如".yaml")注册解析函数，用来支持JSON以外的配置格式
+// 本包只内置JSON，YAML、TOML等格式需要调用者把第三方库的yaml.Unmarshal之类包装一下注册进来
+func RegisterFormat(ext string, parse ParseFunc) {
+	formatsMu.Lock()
+	formats[strings.ToLower(ext)] = parse
+	formatsMu.Unlock()
+}
+
+func parseJSON(data []byte) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	err := json.Unmarshal(data, &m)
+	return m, err
+}
+
+func lookupFormat(path string) ParseFunc {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	return formats[strings.ToLower(filepath.Ext(path))]
+}
+
+// 设置是否对已注册格式的文件做结构化对比
+// 开启后Write事件的ChangedKeys会记录发生变化的key，嵌套的key用"."连接；设置了ScanAsUser时不能开启
+func (w *Watcher) DiffStructured(enable bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !enable {
+		w.structured = nil
+		return nil
+	}
+	if err := w.refuseContent("DiffStructured"); err != nil {
+		return err
+	}
+	if w.structured != nil {
+		return nil
+	}
+	w.structured = make(map[string]map[string]interface{})
+	for path, info := range w.files {
+		w.loadStructured(path, info)
+	}
+	return nil
+}
+
+// 解析文件并展开成 key -> 值，文件过大、格式未注册或者解析失败的时候返回nil
+func readStructured(path string, info os.FileInfo) map[string]interface{} {
+	if info.IsDir() || info.Size() > defaultContentLimit {
+		return nil
+	}
+	parse := lookupFormat(path)
+	if parse == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(f, defaultContentLimit))
+	if err != nil {
+		return nil
+	}
+	m, err := parse(data)
+	if err != nil {
+		return nil
+	}
+	flat := make(map[string]interface{})
+	flatten("", m, flat)
+	return flat
+}
+
+// 记录文件当前的结构化内容，调用的时候需要持有w.mu
+func (w *Watcher) loadStructured(path string, info os.FileInfo) {
+	if w.structured == nil {
+		return
+	}
+	if flat := readStructured(path, info); flat != nil {
+		w.structured[path] = flat
+	}
+}
+
+// 对比Write事件前后的内容，把变化的key写到event.ChangedKeys，调用的时候需要持有w.mu
+func (w *Watcher) diffStructured(event *Event) {
+	if w.structured == nil {
+		return
+	}
+	flat := readStructured(event.Path, event.FileInfo)
+	if flat == nil {
+		return
+	}
+	old := w.structured[event.Path]
+	w.structured[event.Path] = flat
+	event.ChangedKeys = changedKeys(old, flat)
+}
+
+// 文件被重命名或者移动之后，把缓存的内容挪到新的路径下，调用的时候需要持有w.mu
+func (w *Watcher) moveStructured(oldPath, newPath string) {
+	if flat, found := w.structured[oldPath]; found {
+		delete(w.structured, oldPath)
+		w.structured[newPath] = flat
+	}
+}
+
+func flatten(prefix string, v interface{}, out map[string]interface{}) {
+	join := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, sub := range t {
+			flatten(join(k), sub, out)
+		}
+	case map[interface{}]interface{}:
+		for k, sub := range t {
+			flatten(join(fmt.Sprint(k)), sub, out)
+		}
+	case []interface{}:
+		for i, sub := range t {
+			flatten(join(fmt.Sprint(i)), sub, out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func changedKeys(old, new map[string]interface{}) []string {
+	var keys []string
+	for k, v := range new {
+		if ov, found := old[k]; !found || !reflect.DeepEqual(ov, v) {
+			keys = append(keys, k)
+		}
+	}
+	for k := range old {
+		if _, found := new[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,68 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// 设置非递归监控的目录下，Add之后新建的子目录是否也自动监控(只有一层，子目录下再新建的目录不会)，
+// 适合"监控一个不断新增任务目录的目录"这种情况，又不用递归扫描整棵树
+// 子目录从被发现的下一轮扫描开始监控，删除之后自动停止，不会发送错误
+func (w *Watcher) WatchNewSubdirs(enable bool) {
+	w.mu.Lock()
+	w.watchSubdirs = enable
+	w.mu.Unlock()
+}
+
+// 如果新建的目录直接位于一个非递归的root下，把它注册为root，调用的时候需要持有w.mu
+func (w *Watcher) watchSubdir(path string, info os.FileInfo) {
+	if !w.watchSubdirs || !info.IsDir() {
+		return
+	}
+	parent := filepath.Dir(path)
+	if recursive, found := w.names[parent]; !found || recursive || w.subdirRoots[parent] {
+		return
+	}
+	if _, found := w.names[path]; found {
+		return
+	}
+	if w.subdirRoots == nil {
+		w.subdirRoots = make(map[string]bool)
+	}
+	w.names[path] = false
+	w.subdirRoots[path] = true
+	w.setRootStatus(path, false, nil)
+	w.trace(path, Create, "watching new subdirectory of %s", parent)
+}
+
+// 自动监控的子目录被删除之后直接注销，不当作错误，
+// w.files里的内容保留，这样这一轮扫描会正常发送Remove事件，调用的时候需要持有w.mu
+func (w *Watcher) dropSubdir(name string) bool {
+	if !w.subdirRoots[name] {
+		return false
+	}
+	if _, err := os.Lstat(name); !os.IsNotExist(err) {
+		return false
+	}
+	delete(w.names, name)
+	delete(w.roots, name)
+	delete(w.subdirRoots, name)
+	return true
+}
+
+// 注销parent下自动监控的子目录，调用的时候需要持有w.mu
+func (w *Watcher) removeSubdirs(parent string) {
+	for sub := range w.subdirRoots {
+		if filepath.Dir(sub) != parent {
+			continue
+		}
+		delete(w.names, sub)
+		delete(w.roots, sub)
+		delete(w.subdirRoots, sub)
+		for path := range w.files {
+			if filepath.Dir(path) == sub {
+				delete(w.files, path)
+			}
+		}
+	}
+}
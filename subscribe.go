@@ -0,0 +1,230 @@
+package watcher
+
+import "sync"
+
+// Backpressure 是订阅者跟不上事件速度时的处理方式
+type Backpressure uint32
+
+const (
+	// 缓冲满了之后扫描等待订阅者读取，不丢事件，但是一个慢的订阅者会拖慢整个watcher
+	BackpressureBlock Backpressure = iota
+	// 缓冲满了之后丢掉最早的事件，扫描不会等待，订阅者总是看到最新的变化，但是可能漏掉中间的事件
+	BackpressureDropOldest
+	// 缓冲满了之后丢掉新来的事件，扫描不会等待，订阅者看到的是积压开始之前的变化
+	BackpressureDropNewest
+	// 同一个路径还没有被读取的事件只保留最新的一个，适合只关心"哪些文件变了"的订阅者；
+	// 不同路径的事件占满缓冲之后扫描等待，和BackpressureBlock一样
+	BackpressureCoalesce
+)
+
+var backpressures = map[Backpressure]string{
+	BackpressureBlock:      "BLOCK",
+	BackpressureDropOldest: "DROP_OLDEST",
+	BackpressureDropNewest: "DROP_NEWEST",
+	BackpressureCoalesce:   "COALESCE",
+}
+
+func (b Backpressure) String() string {
+	if name, found := backpressures[b]; found {
+		return name
+	}
+	return "???"
+}
+
+// SubscriptionStats 是一个订阅者的计数
+type SubscriptionStats struct {
+	Delivered uint64 // 订阅者读取的事件数
+	Blocked   uint64 // 扫描因为缓冲满了而等待的次数
+	Dropped   uint64 // 因为缓冲满了丢掉的事件数(DropOldest和DropNewest)
+	Coalesced uint64 // 被同一个路径更新的事件替换掉的事件数
+}
+
+// Subscription 是一个独立的事件订阅，有自己的缓冲和背压策略，事件从Events读取
+type Subscription struct {
+	w        *Watcher
+	events   chan Event
+	strategy Backpressure
+	size     int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []Event
+	inflight chan struct{} // 正在交给订阅者的事件，关闭时撤回，为nil时没有
+	stats    SubscriptionStats
+	closed   bool
+	done     chan struct{}
+}
+
+// Subscribe 创建一个订阅，buffer是缓冲的事件数(包括正在交给订阅者的那一个)，小于1时按1处理
+// 有订阅的时候事件只发送给订阅者，不再发送到w.Event，也就不需要再读取w.Event；
+// 批量模式下的w.Batch和注册的处理函数不受影响
+// 订阅者按照strategy处理积压，互相之间不影响；不再需要时调用Subscription.Close
+func (w *Watcher) Subscribe(buffer int, strategy Backpressure) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+	s := &Subscription{
+		w:        w,
+		events:   make(chan Event),
+		strategy: strategy,
+		size:     buffer,
+		done:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	go s.pump()
+
+	w.subMu.Lock()
+	w.subscriptions = append(w.subscriptions, s)
+	w.subMu.Unlock()
+	return s
+}
+
+// 返回事件channel，订阅被关闭之后也会被关闭
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// 返回订阅的计数
+func (s *Subscription) Stats() SubscriptionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+// 取消订阅，缓冲里还没有读取的事件会被丢掉
+func (s *Subscription) Close() {
+	s.w.subMu.Lock()
+	for i, sub := range s.w.subscriptions {
+		if sub == s {
+			s.w.subscriptions = append(s.w.subscriptions[:i:i], s.w.subscriptions[i+1:]...)
+			break
+		}
+	}
+	s.w.subMu.Unlock()
+	s.close()
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+	s.cond.Broadcast()
+}
+
+// 按照背压策略把事件放进缓冲
+func (s *Subscription) push(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.strategy == BackpressureCoalesce {
+		for i := range s.queue {
+			if s.queue[i].Path == e.Path {
+				s.queue[i] = e
+				s.stats.Coalesced++
+				return
+			}
+		}
+	}
+	if s.pending() >= s.size {
+		switch s.strategy {
+		case BackpressureDropOldest:
+			if s.inflight != nil {
+				// 最早的事件正在交给订阅者，撤回它，是丢掉了还是已经被读取由pump记录
+				close(s.inflight)
+				s.inflight = nil
+			} else {
+				s.queue = s.queue[1:]
+				s.stats.Dropped++
+			}
+		case BackpressureDropNewest:
+			s.stats.Dropped++
+			return
+		default:
+			s.stats.Blocked++
+			for s.pending() >= s.size && !s.closed {
+				s.cond.Wait()
+			}
+		}
+	}
+	if s.closed {
+		return
+	}
+	s.queue = append(s.queue, e)
+	s.cond.Broadcast()
+}
+
+// 缓冲里的事件数，调用的时候需要持有s.mu
+func (s *Subscription) pending() int {
+	if s.inflight != nil {
+		return len(s.queue) + 1
+	}
+	return len(s.queue)
+}
+
+// 把缓冲里的事件发送给订阅者，正在发送的事件仍然占用缓冲
+func (s *Subscription) pump() {
+	defer close(s.events)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		e := s.queue[0]
+		s.queue = s.queue[1:]
+		retract := make(chan struct{})
+		s.inflight = retract
+		s.mu.Unlock()
+
+		select {
+		case s.events <- e:
+			s.mu.Lock()
+			s.stats.Delivered++
+		case <-retract:
+			s.mu.Lock()
+			s.stats.Dropped++
+		case <-s.done:
+			return
+		}
+		if s.inflight == retract {
+			s.inflight = nil
+		}
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}
+}
+
+// 是否有订阅
+func (w *Watcher) subscribed() bool {
+	w.subMu.Lock()
+	defer w.subMu.Unlock()
+	return len(w.subscriptions) > 0
+}
+
+// 把一个事件交给所有订阅者
+func (w *Watcher) publish(e Event) {
+	w.subMu.Lock()
+	subs := w.subscriptions
+	w.subMu.Unlock()
+	for _, s := range subs {
+		s.push(e)
+	}
+}
+
+// 关闭所有订阅
+func (w *Watcher) closeSubscriptions() {
+	w.subMu.Lock()
+	subs := w.subscriptions
+	w.subscriptions = nil
+	w.subMu.Unlock()
+	for _, s := range subs {
+		s.close()
+	}
+}
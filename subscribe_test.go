@@ -0,0 +1,109 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+// 等待pump把缓冲里的第一个事件取出来交给订阅者
+func waitInflight(t *testing.T, s *Subscription) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		s.mu.Lock()
+		inflight := s.inflight != nil
+		s.mu.Unlock()
+		if inflight {
+			return
+		}
+	}
+	t.Fatal("no event handed to the subscriber")
+}
+
+func receive(t *testing.T, s *Subscription, want ...string) {
+	t.Helper()
+	for _, path := range want {
+		select {
+		case e := <-s.Events():
+			if e.Path != path {
+				t.Fatalf("got %s, want %s", e.Path, path)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no event, want %s", path)
+		}
+	}
+}
+
+func publishPaths(w *Watcher, paths ...string) {
+	for _, path := range paths {
+		w.publish(Event{Op: Write, Path: path})
+	}
+}
+
+func TestSubscribeBlock(t *testing.T) {
+	w := New()
+	s := w.Subscribe(1, BackpressureBlock)
+	defer s.Close()
+
+	publishPaths(w, "a")
+	waitInflight(t, s)
+	// 正在交给订阅者的事件占满了缓冲
+	published := make(chan struct{})
+	go func() {
+		publishPaths(w, "b")
+		close(published)
+	}()
+	select {
+	case <-published:
+		t.Fatal("publish did not block on a full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	receive(t, s, "a")
+	<-published
+	receive(t, s, "b")
+	if stats := s.Stats(); stats.Blocked != 1 || stats.Dropped != 0 {
+		t.Errorf("got %+v, want 1 blocked", stats)
+	}
+}
+
+func TestSubscribeDropOldest(t *testing.T) {
+	w := New()
+	s := w.Subscribe(2, BackpressureDropOldest)
+	defer s.Close()
+
+	publishPaths(w, "a")
+	waitInflight(t, s)
+	publishPaths(w, "b", "c", "d", "e")
+	receive(t, s, "d", "e")
+	if stats := s.Stats(); stats.Dropped != 3 {
+		t.Errorf("got %+v, want 3 dropped", stats)
+	}
+}
+
+func TestSubscribeDropNewest(t *testing.T) {
+	w := New()
+	s := w.Subscribe(2, BackpressureDropNewest)
+	defer s.Close()
+
+	publishPaths(w, "a")
+	waitInflight(t, s)
+	publishPaths(w, "b", "c", "d", "e")
+	receive(t, s, "a", "b")
+	if stats := s.Stats(); stats.Dropped != 3 {
+		t.Errorf("got %+v, want 3 dropped", stats)
+	}
+}
+
+func TestSubscribeCoalesce(t *testing.T) {
+	w := New()
+	s := w.Subscribe(3, BackpressureCoalesce)
+	defer s.Close()
+
+	publishPaths(w, "a")
+	waitInflight(t, s)
+	// 缓冲已经满了，同一个路径的事件只替换还没有读取的那个
+	publishPaths(w, "b", "c", "b", "c")
+	receive(t, s, "a", "b", "c")
+	if stats := s.Stats(); stats.Coalesced != 2 || stats.Blocked != 0 {
+		t.Errorf("got %+v, want 2 coalesced", stats)
+	}
+}
@@ -0,0 +1,217 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// 扫描某个root的时候发生了panic，panic已经被恢复，这个root按照重启退避稍后重新扫描，其他root不受影响
+var ErrRootPanic = errors.New("error: panic while scanning root")
+
+// 列出某个root超过了SetRootTimeout设置的时间，这一轮沿用上一次的文件列表，按照重启退避稍后重新扫描
+var ErrRootTimeout = errors.New("error: timed out listing root")
+
+// 默认的重启退避时间和每个root列出的超时
+const (
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = time.Minute
+	defaultRootTimeout = time.Minute
+)
+
+// 设置root扫描失败(出错或者panic)之后重新扫描的退避时间：连续失败n次之后等待min*2^(n-1)，最多等待max
+// 每个root单独计算，一个root出错或者panic不影响其他root；等待期间这个root沿用上一次的文件列表，
+// 不会因为暂时的错误产生大量Remove事件；min小于等于0时每一轮都重新扫描
+func (w *Watcher) SetRestartBackoff(min, max time.Duration) {
+	if max < min {
+		max = min
+	}
+	w.mu.Lock()
+	w.minBackoff = min
+	w.maxBackoff = max
+	w.mu.Unlock()
+}
+
+// 设置每个root一轮列出的超时，默认一分钟，d小于等于0时不限制
+// 每个root在自己的goroutine里列出，超时的root(比如没有响应的网络挂载)不会拖住其他root：
+// 这一轮沿用它上一次的文件列表，发送ErrRootTimeout并按照重启退避计算下一次重试的时间，
+// 卡住的列出结束之前不会为这个root启动新的列出，结束之后的结果被丢弃
+func (w *Watcher) SetRootTimeout(d time.Duration) {
+	w.mu.Lock()
+	w.rootTimeout = d
+	w.mu.Unlock()
+}
+
+// 在单独的goroutine里进行的一次root列出
+type rootListing struct {
+	name      string
+	recursive bool
+	start     time.Time
+	status    RootStatus // 开始列出时root的状态，root不存在被移除之后用来恢复
+	done      chan struct{}
+	list      map[string]os.FileInfo
+	err       error
+	elapsed   time.Duration
+}
+
+// 在新的goroutine里列出name，调用的时候需要持有w.mu
+func (w *Watcher) startListing(name string, recursive bool, start time.Time) *rootListing {
+	l := &rootListing{name: name, recursive: recursive, start: start, status: w.roots[name], done: make(chan struct{})}
+	var skip func(path string) bool
+	if recursive && w.helper == nil {
+		skip = w.sampleSkip(name)
+	}
+	c := w.listingCopy(name, recursive, skip != nil)
+	go func() {
+		l.list, l.err = c.superviseRoot(name, recursive, skip)
+		l.elapsed = c.since(start)
+		close(l.done)
+	}()
+	return l
+}
+
+// 复制列出name用到的设置，列出的goroutine只读副本，不需要持有w.mu，调用的时候需要持有w.mu
+func (w *Watcher) listingCopy(name string, recursive, sampled bool) *Watcher {
+	c := &Watcher{
+		mu:             new(sync.Mutex),
+		clock:          w.clock,
+		names:          map[string]bool{name: recursive},
+		ignored:        make(map[string]struct{}, len(w.ignored)),
+		ignoreGlobs:    append([]string(nil), w.ignoreGlobs...),
+		ignoreHidden:   w.ignoreHidden,
+		sameDevice:     w.sameDevice,
+		specialPolicy:  w.specialPolicy,
+		followSymlinks: w.followSymlinks,
+		concurrency:    w.concurrency,
+		maxDepth:       w.maxDepth,
+		includeRe:      w.includeRe,
+		excludeRe:      w.excludeRe,
+		ffh:            append([]FilterFileHookFunc(nil), w.ffh...),
+		helper:         w.helper,
+		traceTo:        w,
+	}
+	for path := range w.ignored {
+		c.ignored[path] = struct{}{}
+	}
+	if patterns, found := w.includes[name]; found {
+		c.includes = map[string][]string{name: append([]string(nil), patterns...)}
+	}
+	if recursive && w.fullEvery > 0 {
+		if w.dirCache == nil {
+			w.dirCache = make(map[string]*rootCache)
+		}
+		cache := w.dirCache[name]
+		if cache == nil {
+			cache = &rootCache{}
+			w.dirCache[name] = cache
+		}
+		c.fullEvery = w.fullEvery
+		c.dirCache = map[string]*rootCache{name: cache}
+	}
+	if sampled {
+		// 抽样扫描跳过的子目录沿用上一次的结果
+		c.files = w.previousList(name, true)
+	}
+	return c
+}
+
+// 上一轮超时的列出是否还没有结束，调用的时候需要持有w.mu
+func (w *Watcher) stillListing(name string) bool {
+	l, found := w.listing[name]
+	if !found {
+		return false
+	}
+	select {
+	case <-l.done:
+		// 超时之后才结束，结果已经过时
+		delete(w.listing, name)
+		return false
+	default:
+		return true
+	}
+}
+
+// 等待列出结束，timeout大于0时最多等待timeout，不能持有w.mu
+func awaitListings(listings []*rootListing, timeout time.Duration) {
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	for _, l := range listings {
+		select {
+		case <-l.done:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// 列出一个root，panic会被恢复成ErrRootPanic，skip不为nil时抽样扫描
+func (w *Watcher) superviseRoot(name string, recursive bool, skip func(path string) bool) (list map[string]os.FileInfo, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			list = nil
+			err = fmt.Errorf("%w: %v\n%s", ErrRootPanic, r, debug.Stack())
+		}
+	}()
+	if skip != nil {
+		return w.listSampled(name, skip)
+	}
+	return w.listRoot(name, recursive)
+}
+
+// root是否还在退避期间，调用的时候需要持有w.mu
+func (w *Watcher) backingOff(name string, now time.Time) bool {
+	status, found := w.roots[name]
+	return found && !status.RetryAt.IsZero() && now.Before(status.RetryAt)
+}
+
+// 记录root这一次扫描的结果，失败时计算下一次重试的时间并返回上一次的文件列表，调用的时候需要持有w.mu
+// root不存在的时候会被移除，不算失败
+func (w *Watcher) rootResult(name string, recursive bool, list map[string]os.FileInfo, err error) map[string]os.FileInfo {
+	status, found := w.roots[name]
+	if !found {
+		return list
+	}
+	if err == nil || os.IsNotExist(err) {
+		if status.Failures > 0 {
+			status.Restarts++
+		}
+		status.Failures = 0
+		status.RetryAt = time.Time{}
+		w.roots[name] = status
+		return list
+	}
+
+	status.Failures++
+	if w.minBackoff > 0 {
+		backoff := w.minBackoff
+		for i := 1; i < status.Failures && backoff < w.maxBackoff; i++ {
+			backoff *= 2
+		}
+		if backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+		status.RetryAt = w.clock.Now().Add(backoff)
+		w.trace(name, Create, "root failed %d times, retrying after %s", status.Failures, backoff)
+	}
+	w.roots[name] = status
+	return w.previousList(name, recursive)
+}
+
+// 返回上一次扫描时root下的文件，调用的时候需要持有w.mu
+func (w *Watcher) previousList(name string, recursive bool) map[string]os.FileInfo {
+	list := make(map[string]os.FileInfo)
+	for path, info := range w.files {
+		if path == name || (recursive && underPath(path, name)) || (!recursive && filepath.Dir(path) == name) {
+			list[path] = info
+		}
+	}
+	return list
+}
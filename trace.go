@@ -0,0 +1,74 @@
+package watcher
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 每个路径最多保留的调试记录数
+const traceSize = 32
+
+// TraceEntry 是调试模式下记录的一次判断：哪个比较触发了事件，或者哪个过滤条件拦下了事件
+type TraceEntry struct {
+	Time     time.Time
+	Op       Op
+	Decision string
+}
+
+func (t TraceEntry) String() string {
+	return fmt.Sprintf("%s %s %s", t.Time.Format(time.RFC3339Nano), t.Op, t.Decision)
+}
+
+// 设置是否开启调试模式，开启后每个路径都会记录事件发送或者没有发送的原因，关闭时清空所有记录
+func (w *Watcher) SetDebug(enable bool) {
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+
+	if !enable {
+		w.traces = nil
+		return
+	}
+	if w.traces == nil {
+		w.traces = make(map[string][]TraceEntry)
+	}
+}
+
+// 返回某个路径最近的调试记录，最早的在前面
+func (w *Watcher) Trace(path string) []TraceEntry {
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+
+	entries := w.traces[path]
+	return append([]TraceEntry(nil), entries...)
+}
+
+// 记录一次判断，没有开启调试模式也不在Preview期间的时候什么也不做
+func (w *Watcher) trace(path string, op Op, format string, args ...interface{}) {
+	if w.traceTo != nil {
+		w.traceTo.trace(path, op, format, args...)
+		return
+	}
+	w.traceMu.Lock()
+	defer w.traceMu.Unlock()
+
+	if w.traces == nil && w.excluded == nil {
+		return
+	}
+	decision := fmt.Sprintf(format, args...)
+	if w.excluded != nil && (strings.HasPrefix(decision, "not listed: ") || strings.HasPrefix(decision, "not descended: ")) {
+		w.excluded[path] = decision
+	}
+	if w.traces == nil {
+		return
+	}
+	entries := append(w.traces[path], TraceEntry{
+		Time:     w.clock.Now(),
+		Op:       op,
+		Decision: decision,
+	})
+	if len(entries) > traceSize {
+		entries = entries[len(entries)-traceSize:]
+	}
+	w.traces[path] = entries
+}
@@ -0,0 +1,121 @@
+package watcher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 一个root上正在进行的事务
+type transaction struct {
+	id     string
+	start  time.Time
+	last   time.Time // 最后一个事件的时间
+	events int       // 经过过滤之后真正发送的事件数
+}
+
+// 设置事务分组：同一个root下相隔不超过window的事件属于同一个事务，每个事件的Transaction是事务的ID，
+// 超过window没有新事件之后发送一个TransactionEnd事件表示事务结束，使用者可以把一次rsync或者部署当作一个整体处理
+// TransactionEnd的Detail里只统计经过FilterOps、FilterExpr等过滤之后真正发送的事件，事件全部被过滤掉的事务不发送TransactionEnd
+// 时间按扫描计算，window应该比轮询间隔长；window小于等于0时关闭，进行中的事务不再发送TransactionEnd
+func (w *Watcher) GroupTransactions(window time.Duration) {
+	w.mu.Lock()
+	w.txnWindow = window
+	w.txns = nil
+	w.mu.Unlock()
+}
+
+func newTransactionID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// 返回path所属的root，有多个时取最长的，调用的时候需要持有w.mu
+func (w *Watcher) rootOf(path string) (string, bool) {
+	root, found := "", false
+	for name := range w.names {
+		if underPath(path, name) && len(name) > len(root) {
+			root, found = name, true
+		}
+	}
+	return root, found
+}
+
+// 给这一轮的事件加上事务ID，并为已经结束的事务追加TransactionEnd事件
+func (w *Watcher) groupTransactions(events []Event) []Event {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.txnWindow <= 0 {
+		return events
+	}
+	if w.txns == nil {
+		w.txns = make(map[string]*transaction)
+	}
+	now := w.clock.Now()
+	var ended []Event
+	end := func(root string, t *transaction) {
+		delete(w.txns, root)
+		if t.events == 0 {
+			w.trace(root, TransactionEnd, "suppressed: no events of transaction %s were sent", t.id)
+			return
+		}
+		detail := fmt.Sprintf("%d events in %s", t.events, t.last.Sub(t.start))
+		var info os.FileInfo = &fileInfo{name: filepath.Base(root), modTime: t.last, dir: true}
+		if fi, found := w.files[root]; found {
+			info = fi
+		}
+		w.trace(root, TransactionEnd, "detected: transaction %s ended, %s", t.id, detail)
+		ended = append(ended, Event{Op: TransactionEnd, Path: root, FileInfo: info, Transaction: t.id, Detail: detail})
+	}
+
+	for i := range events {
+		root, found := w.rootOf(eventPaths(events[i])[0])
+		if !found {
+			continue
+		}
+		t := w.txns[root]
+		if t != nil && now.Sub(t.last) > w.txnWindow {
+			end(root, t)
+			t = nil
+		}
+		if t == nil {
+			t = &transaction{id: newTransactionID(), start: now}
+			w.txns[root] = t
+		}
+		t.last = now
+		events[i].Transaction = t.id
+	}
+
+	roots := make([]string, 0, len(w.txns))
+	for root := range w.txns {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		if t := w.txns[root]; now.Sub(t.last) > w.txnWindow {
+			end(root, t)
+		}
+	}
+	return append(ended, events...)
+}
+
+// 记录一个已经发送的事件，调用的时候不能持有w.mu
+func (w *Watcher) countTransaction(e Event) {
+	if e.Transaction == "" || e.Op == TransactionEnd {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, t := range w.txns {
+		if t.id == e.Transaction {
+			t.events++
+			return
+		}
+	}
+}
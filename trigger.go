@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+)
+
+// Trigger 收集事件，等到一段时间内没有新事件之后，把这段时间里的事件一次性交给回调，
+// 用来实现"文件改完了再重新构建"这种常见需求
+type Trigger struct {
+	mu      sync.Mutex
+	quiet   time.Duration
+	fn      func([]Event)
+	onError func(error)
+	clock   Clock
+}
+
+// 创建一个Trigger，quiet是触发前需要保持安静的时间，比如300ms
+func NewTrigger(quiet time.Duration, fn func([]Event)) *Trigger {
+	return &Trigger{quiet: quiet, fn: fn, clock: realClock{}}
+}
+
+// 设置处理错误的函数，不设置时错误会被丢弃
+func (t *Trigger) HandleError(f func(error)) {
+	t.mu.Lock()
+	t.onError = f
+	t.mu.Unlock()
+}
+
+// 设置Trigger使用的时钟，c为nil时恢复成系统时钟
+func (t *Trigger) SetClock(c Clock) {
+	if c == nil {
+		c = realClock{}
+	}
+	t.mu.Lock()
+	t.clock = c
+	t.mu.Unlock()
+}
+
+// Serve 从n读取事件，每次安静期结束后调用一次回调，直到done被关闭
+// 回调在Serve所在的goroutine里执行，执行期间到达的事件会留到下一批
+// 对于Watcher可以把w.Closed作为done
+func (t *Trigger) Serve(n Notifier, done <-chan struct{}) {
+	t.mu.Lock()
+	quiet, fn, clock := t.quiet, t.fn, t.clock
+	t.mu.Unlock()
+
+	events, errors := n.Events(), n.Errors()
+	var pending []Event
+	var fire <-chan time.Time
+	for {
+		select {
+		case e := <-events:
+			pending = append(pending, e)
+			// 每来一个事件就重新开始计时
+			fire = clock.After(quiet)
+		case err := <-errors:
+			t.mu.Lock()
+			onError := t.onError
+			t.mu.Unlock()
+			if onError != nil {
+				onError(err)
+			}
+		case <-fire:
+			batch := pending
+			pending, fire = nil, nil
+			fn(batch)
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// WebAssembly插件的ABI：
+//
+// 模块导出memory和下面几个函数，事件以MarshalEvent的JSON格式(不带签名)写到模块的内存里
+//
+//	alloc(size i32) i32              在模块内存里分配size字节，返回起始地址
+//	filter(ptr i32, len i32) i32     返回0丢弃事件，非0保留，可选
+//	transform(ptr i32, len i32) i64  返回新事件JSON的位置，高32位是地址、低32位是长度，长度为0表示丢弃，可选
+//
+// 这个包只定义ABI，不带WebAssembly运行时(标准库里没有，也不想让所有使用者都依赖一个)，
+// 需要的程序自己用SetWASMRuntime接入一个(比如wazero)之后才能加载插件；命令行工具本身也不带运行时，
+// 要用-plugin加载一个在init里调用SetWASMRuntime的Go插件，再用-wasm加载WebAssembly插件；
+// 插件在沙箱里运行，可以用任何能编译成WebAssembly的语言编写
+
+// WASMModule 是一个实例化之后的模块
+type WASMModule interface {
+	// Call 调用导出的函数，模块没有导出这个函数时返回ErrWASMNoExport
+	Call(name string, args ...uint64) ([]uint64, error)
+	Read(offset, size uint32) ([]byte, bool)
+	Write(offset uint32, data []byte) bool
+	Close() error
+}
+
+// WASMRuntime 编译并实例化模块
+type WASMRuntime interface {
+	Instantiate(code []byte) (WASMModule, error)
+}
+
+var (
+	// 没有通过SetWASMRuntime设置运行时的时候返回这个错误
+	ErrNoWASMRuntime = errors.New("error: no WebAssembly runtime configured")
+	// 模块没有导出要调用的函数时，WASMModule.Call应该返回这个错误
+	ErrWASMNoExport = errors.New("error: WebAssembly module does not export function")
+)
+
+// WASMFailure 决定插件调用出错(模块trap、返回值不合法等)时怎样处理事件
+type WASMFailure uint32
+
+const (
+	// 丢弃事件，默认的处理方式，用插件做过滤或者脱敏的时候出错不会把不该发出去的事件放过去
+	WASMFailClosed WASMFailure = iota
+	// 原样保留事件
+	WASMFailOpen
+)
+
+var wasmFailures = map[WASMFailure]string{
+	WASMFailClosed: "FAIL_CLOSED",
+	WASMFailOpen:   "FAIL_OPEN",
+}
+
+func (f WASMFailure) String() string {
+	if name, found := wasmFailures[f]; found {
+		return name
+	}
+	return "???"
+}
+
+var (
+	wasmMu      sync.Mutex
+	wasmRuntime WASMRuntime
+)
+
+// 设置加载WebAssembly插件使用的运行时
+func SetWASMRuntime(r WASMRuntime) {
+	wasmMu.Lock()
+	wasmRuntime = r
+	wasmMu.Unlock()
+}
+
+// WASMPlugin 是一个加载好的WebAssembly过滤/转换插件，可以在多个goroutine里使用，调用是串行的
+type WASMPlugin struct {
+	mu      sync.Mutex
+	mod     WASMModule
+	failure WASMFailure
+	errors  uint64 // 调用出错的次数
+}
+
+// 从文件加载WebAssembly插件
+func LoadWASM(path string) (*WASMPlugin, error) {
+	wasmMu.Lock()
+	r := wasmRuntime
+	wasmMu.Unlock()
+	if r == nil {
+		return nil, ErrNoWASMRuntime
+	}
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := r.Instantiate(code)
+	if err != nil {
+		return nil, err
+	}
+	return &WASMPlugin{mod: mod}, nil
+}
+
+// 设置调用出错时怎样处理事件，默认WASMFailClosed
+func (p *WASMPlugin) SetFailure(f WASMFailure) {
+	p.mu.Lock()
+	p.failure = f
+	p.mu.Unlock()
+}
+
+// 返回调用出错的次数
+func (p *WASMPlugin) Errors() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.errors
+}
+
+// 调用出错时是否保留事件，调用的时候需要持有p.mu
+func (p *WASMPlugin) failed() bool {
+	p.errors++
+	return p.failure == WASMFailOpen
+}
+
+// 把事件写到模块内存里，返回地址和长度，调用的时候需要持有p.mu
+func (p *WASMPlugin) write(e Event) (uint64, uint64, error) {
+	data, err := MarshalEvent(e, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := p.mod.Call("alloc", uint64(len(data)))
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(res) != 1 || !p.mod.Write(uint32(res[0]), data) {
+		return 0, 0, errors.New("error: WebAssembly alloc returned an invalid buffer")
+	}
+	return uint64(uint32(res[0])), uint64(len(data)), nil
+}
+
+// Filter 调用模块的filter，模块没有导出filter时保留事件，出错时按照SetFailure的设置处理
+func (p *WASMPlugin) Filter(e Event) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ptr, size, err := p.write(e)
+	if err != nil {
+		return p.failed()
+	}
+	res, err := p.mod.Call("filter", ptr, size)
+	if errors.Is(err, ErrWASMNoExport) {
+		return true
+	}
+	if err != nil || len(res) != 1 {
+		return p.failed()
+	}
+	return uint32(res[0]) != 0
+}
+
+// Transform 调用模块的transform，返回转换之后的事件，第二个返回值为false时丢弃事件，
+// 模块没有导出transform时原样返回
+func (p *WASMPlugin) Transform(e Event) (Event, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ptr, size, err := p.write(e)
+	if err != nil {
+		return e, true, err
+	}
+	res, err := p.mod.Call("transform", ptr, size)
+	if errors.Is(err, ErrWASMNoExport) {
+		return e, true, nil
+	}
+	if err != nil {
+		return e, true, err
+	}
+	if len(res) != 1 {
+		return e, true, fmt.Errorf("error: WebAssembly transform returned %d values", len(res))
+	}
+	outPtr, outSize := uint32(res[0]>>32), uint32(res[0])
+	if outSize == 0 {
+		return Event{}, false, nil
+	}
+	data, ok := p.mod.Read(outPtr, outSize)
+	if !ok {
+		return e, true, errors.New("error: WebAssembly transform returned an invalid buffer")
+	}
+	out, err := UnmarshalEvent(data, nil)
+	if err != nil {
+		return e, true, err
+	}
+	return out, true, nil
+}
+
+// Middleware 先过滤再转换，转换出错时按照SetFailure的设置丢弃或者原样传递事件
+func (p *WASMPlugin) Middleware() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(e Event) {
+			if !p.Filter(e) {
+				return
+			}
+			out, keep, err := p.Transform(e)
+			if !keep {
+				return
+			}
+			if err != nil {
+				p.mu.Lock()
+				keep = p.failed()
+				p.mu.Unlock()
+				if !keep {
+					return
+				}
+				out = e
+			}
+			next(out)
+		}
+	}
+}
+
+// 释放模块
+func (p *WASMPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mod.Close()
+}
+
+func init() {
+	// 配置path是模块文件的路径，failure为open时出错保留事件，默认丢弃
+	// 通过OpenFilter创建，不再使用时Close释放模块
+	RegisterFilterCloser("wasm", func(config map[string]string) (Filter, io.Closer, error) {
+		failure := WASMFailClosed
+		switch config["failure"] {
+		case "", "closed":
+		case "open":
+			failure = WASMFailOpen
+		default:
+			return nil, nil, fmt.Errorf("error: unknown WebAssembly failure policy %q", config["failure"])
+		}
+		p, err := LoadWASM(config["path"])
+		if err != nil {
+			return nil, nil, err
+		}
+		p.SetFailure(failure)
+		return p.Filter, p, nil
+	})
+}
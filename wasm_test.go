@@ -0,0 +1,136 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 用Go实现的假模块：filter保留Path以.go结尾的事件，Path以.trap结尾时出错
+type fakeModule struct {
+	mem    []byte
+	closed bool
+}
+
+func (m *fakeModule) Call(name string, args ...uint64) ([]uint64, error) {
+	switch name {
+	case "alloc":
+		m.mem = make([]byte, args[0])
+		return []uint64{0}, nil
+	case "filter":
+		var e struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal(m.mem[args[0]:args[0]+args[1]], &e); err != nil {
+			return nil, err
+		}
+		if filepath.Ext(e.Path) == ".trap" {
+			return nil, errors.New("trap")
+		}
+		if filepath.Ext(e.Path) == ".go" {
+			return []uint64{1}, nil
+		}
+		return []uint64{0}, nil
+	}
+	return nil, ErrWASMNoExport
+}
+
+func (m *fakeModule) Read(offset, size uint32) ([]byte, bool) {
+	if int(offset+size) > len(m.mem) {
+		return nil, false
+	}
+	return m.mem[offset : offset+size], true
+}
+
+func (m *fakeModule) Write(offset uint32, data []byte) bool {
+	if int(offset)+len(data) > len(m.mem) {
+		return false
+	}
+	copy(m.mem[offset:], data)
+	return true
+}
+
+func (m *fakeModule) Close() error {
+	m.closed = true
+	return nil
+}
+
+type fakeRuntime struct{ mod *fakeModule }
+
+func (r *fakeRuntime) Instantiate(code []byte) (WASMModule, error) {
+	r.mod = &fakeModule{}
+	return r.mod, nil
+}
+
+func TestWASMFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	if err := os.WriteFile(path, []byte("\x00asm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := map[string]string{"path": path}
+
+	SetWASMRuntime(nil)
+	if _, _, err := OpenFilter("wasm", config); !errors.Is(err, ErrNoWASMRuntime) {
+		t.Fatalf("OpenFilter without runtime: %v", err)
+	}
+	r := &fakeRuntime{}
+	SetWASMRuntime(r)
+	defer SetWASMRuntime(nil)
+
+	if _, err := NewFilter("wasm", config); err == nil {
+		t.Error("NewFilter(wasm) succeeded, the module could never be closed")
+	}
+	f, closer, err := OpenFilter("wasm", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f(Event{Op: Write, Path: "/src/main.go"}) || f(Event{Op: Write, Path: "/src/notes.txt"}) {
+		t.Error("filter did not follow the module")
+	}
+	if f(Event{Op: Write, Path: "/src/x.trap"}) {
+		t.Error("filter kept an event the module failed on")
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.mod.closed {
+		t.Error("module not closed")
+	}
+}
+
+func TestWASMFailOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filter.wasm")
+	if err := os.WriteFile(path, []byte("\x00asm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	SetWASMRuntime(&fakeRuntime{})
+	defer SetWASMRuntime(nil)
+
+	if _, _, err := OpenFilter("wasm", map[string]string{"path": path, "failure": "maybe"}); err == nil {
+		t.Error("unknown failure policy accepted")
+	}
+	f, closer, err := OpenFilter("wasm", map[string]string{"path": path, "failure": "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if !f(Event{Op: Write, Path: "/src/x.trap"}) {
+		t.Error("fail-open filter dropped the event")
+	}
+	if errs := closer.(*WASMPlugin).Errors(); errs != 1 {
+		t.Errorf("got %d errors, want 1", errs)
+	}
+}
+
+func TestOpenFilterPlain(t *testing.T) {
+	f, closer, err := OpenFilter("ops", map[string]string{"ops": "CREATE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if !f(Event{Op: Create}) || f(Event{Op: Write}) {
+		t.Error("ops filter")
+	}
+}
@@ -1,563 +1,1566 @@
-package watcher
-
-import (
-	"time"
-	"strings"
-	"path/filepath"
-	"errors"
-	"fmt"
-	"os"
-	"sync"
-	"io/ioutil"
-)
-
-var (
-	// 当调用watcher的start方法的事件小于1纳秒的时候会提示这个错误
-	ErrDurationTooShort = errors.New("error:duration is less than 1ns")
-	// 如果已经调用了watcher的start方法，并且轮询已经开始，再次调用start方法提示这个错误
-	ErrWatcherRunning = errors.New("error:watcher is already running")
-	// 如果被监控的文件或目录已经被删除了，提示这个错误
-	ErrWatchedFileDeleted = errors.New("error: watched file or folder deleted")
-)
-
-// 从这里到String方法之间的代码方式可以学习学习这种风格
-type Op uint32
-
-const (
-	Create Op = iota
-	Write
-	Remove
-	Rename
-	Chmod
-	Move
-)
-
-var ops = map[Op]string{
-	Create: "CREATE",
-	Write:  "WRITE",
-	Remove: "REMOVE",
-	Rename: "RENAME",
-	Chmod:  "CHMOD",
-	Move:   "MOVE",
-}
-
-func (e Op) String() string {
-	if op, found := ops[e]; found {
-		return op
-	}
-	return "???"
-}
-
-type Event struct {
-	Op
-	Path string
-	os.FileInfo
-}
-
-func (e Event) String() string {
-	if e.FileInfo != nil {
-		pathType := "FILE"
-		if e.IsDir() {
-			pathType = "DIRECTORY"
-		}
-		return fmt.Sprintf("%s %q %s [%s]", pathType, e.Name(), e.Op, e.Path)
-	}
-	return "???"
-}
-
-// 这个是核心的结构体
-type Watcher struct {
-	Event  chan Event
-	Error  chan error
-	Closed chan struct{}
-	close  chan struct{}
-	wg     *sync.WaitGroup
-
-	mu           *sync.Mutex
-	runnning     bool
-	names        map[string]bool
-	files        map[string]os.FileInfo
-	ignored      map[string]struct{}		// 要被忽略的文件或目录
-	ops          map[Op]struct{}
-	ignoreHidden bool						// 是否忽略隐藏文件
-	maxEvents    int
-}
-
-// 用于初始化Watcher
-func New() *Watcher {
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	return &Watcher{
-		Event:   make(chan Event),
-		Error:   make(chan error),
-		Closed:  make(chan struct{}),
-		close:   make(chan struct{}),
-		mu:      new(sync.Mutex),
-		wg:      &wg,
-		files:   make(map[string]os.FileInfo),
-		ignored: make(map[string]struct{}),
-		names:   make(map[string]bool),
-	}
-}
-
-func (w *Watcher) SetMaxEvents(delta int) {
-	w.mu.Lock()
-	w.maxEvents = delta
-	w.mu.Unlock()
-}
-
-// 设置是否忽略隐藏的文件或目录
-func (w *Watcher) IgnoreHiddenFiles(ignore bool) {
-	w.mu.Lock()
-	w.ignoreHidden = ignore
-	w.mu.Unlock()
-}
-
-// 设置自己需要过滤的事件
-func (w *Watcher) FilterOps(ops ...Op) {
-	w.mu.Lock()
-	w.ops = make(map[Op]struct{})
-	for _, op := range ops {
-		w.ops[op] = struct{}{}
-	}
-	w.mu.Unlock()
-}
-
-// 添加一个单独文件或者一个目录到file list
-func (w *Watcher) Add(name string) (err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	name, err = filepath.Abs(name)
-	if err != nil {
-		return err
-	}
-
-	// 如果文件在要忽略的list
-	_, ignored := w.ignored[name]
-	if ignored || (w.ignoreHidden && strings.HasPrefix(name, ".")) {
-		return nil
-	}
-	fileList, err := w.list(name)
-	if err != nil {
-		return err
-	}
-	for k,v := range fileList {
-		w.files[k] = v
-	}
-	w.names[name] = false
-	return nil
-}
-
-func (w *Watcher) list(name string) (map[string]os.FileInfo, error) {
-	fileList := make(map[string]os.FileInfo)
-
-	// 确认文件是否存在
-	stat, err := os.Stat(name)
-	if err != nil {
-		return nil, err
-	}
-
-	fileList[name] = stat
-	// 如果不是一个目录的话直接返回
-	if !stat.IsDir() {
-		return fileList, nil
-	}
-	// 如果是一个目录按照下面处理
-	fInfoList, err := ioutil.ReadDir(name)
-	if err != nil {
-		return nil, err
-	}
-
-	// 循环将在这个目录下的所有文件添加到 file list,当然这些文件不能是在要忽略的列表或者ignoreHidden设置为true
-	for _, fInfo := range fInfoList {
-		path := filepath.Join(name, fInfo.Name())
-		_, ignored := w.ignored[path]
-		if ignored || (w.ignoreHidden && strings.HasPrefix(fInfo.Name(), ".")) {
-			continue
-		}
-		fileList[path] = fInfo
-	}
-	return fileList, nil
-}
-
-// 递归添加一个文件或者目录下的文件到file list
-func (w *Watcher) AddRecursive(name string) (err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	name, err = filepath.Abs(name)
-	if err != nil {
-		return err
-	}
-
-	fileList, err := w.listRecursive(name)
-	if err != nil {
-		return err
-	}
-	for k, v := range fileList {
-		w.files[k] = v
-	}
-
-	w.names[name] = true
-	return nil
-}
-
-func (w *Watcher) listRecursive(name string) (map[string]os.FileInfo, error) {
-	fileList := make(map[string]os.FileInfo)
-
-	return fileList, filepath.Walk(name,func (path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		_, ignored := w.ignored[path]
-		if ignored || (w.ignoreHidden && strings.HasPrefix(info.Name(), ".")) {
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		fileList[path] = info
-		return nil
-	})
-}
-
-// 从file list 中删除一个文件或者目录
-func (w *Watcher) Remove(name string) (err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	name, err = filepath.Abs(name)
-	if err != nil {
-		return err
-	}
-
-	// 从w.names中删除一个name
-	delete(w.names, name)
-
-	// 如果name 是一个文件，则从files中删除
-	info, found := w.files[name]
-	if !found {
-		return nil
-	}
-	if !info.IsDir() {
-		delete(w.files, name)
-		return nil
-	}
-
-	// 删除目录从w.files中
-	delete(w.files, name)
-
-	// 如果是一个目录则删除它包含的所有内容从files中
-	for path := range w.files {
-		if filepath.Dir(path) == name {
-			delete(w.files, path)
-		}
-	}
-	return nil
-}
-
-// 从文件列表中递归删除单个文件或者目录
-func (w *Watcher) RemoveRecursive(name string) (err error) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	name, err = filepath.Abs(name)
-	if err!= nil {
-		return err
-	}
-	// 从names list中删除指定name
-	delete(w.names, name)
-
-	// 如果name是一个单个文件，删除它并且return
-	info, found := w.files[name]
-	if !found {
-		return nil
-	}
-
-	if !info.IsDir() {
-		delete(w.files,name)
-		return nil
-	}
-	// 如果是一个目录， 删除所有的以及递归删除它包含的从w.files
-	for path := range w.files {
-		if strings.HasPrefix(path, name) {
-			delete(w.files, path)
-		}
-	}
-	return nil
-
-}
-
-// 添加要忽略的路径
-// 将已经添加到files中的，忽略移除他们
-func (w *Watcher) Ignore(paths ...string) (err error) {
-	for _, path := range paths {
-		path, err = filepath.Abs(path)
-		if err != nil {
-			return err
-		}
-		// 地推的删除所有我们添加的
-		if err := w.RemoveRecursive(path); err != nil {
-			return err
-		}
-		w.mu.Lock()
-		w.ignored[path] = struct{}{}
-		w.mu.Unlock()
-	}
-	return nil
-}
-
-// 返回一个files map 
-func (w *Watcher) WatchedFiles() map[string]os.FileInfo {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	return w.files
-}
-
-type fileInfo struct {
-	name 		string
-	size 		int64
-	mode 		os.FileMode
-	modTime	 	time.Time
-	sys			interface{}
-	dir 		bool
-}
-
-func (fs *fileInfo) IsDir() bool {
-	return fs.dir
-}
-
-func (fs *fileInfo) ModTime() time.Time {
-	return fs.modTime
-}
-
-func (fs *fileInfo) Mode() os.FileMode {
-	return fs.mode
-}
-
-func (fs *fileInfo) Name() string {
-	return fs.name
-}
-
-func (fs *fileInfo) Size() int64 {
-	return fs.size
-}
-
-func (fs *fileInfo) Sys() interface{} {
-	return fs.sys
-}
-
-// TriggerEvent 是一个用来触发事件的方法，与文件watching 进程是分开的
-func (w *Watcher) TriggerEvent(eventType Op, file os.FileInfo) {
-	w.Wait()
-	if file == nil {
-		file = &fileInfo{name: "triggered event", modTime: time.Now()}
-	}
-	w.Event <- Event{Op: eventType, Path: "-", FileInfo: file}
-}
-
-func(w *Watcher) retrieveFileList() map[string]os.FileInfo {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	fileList := make(map[string]os.FileInfo)
-	var list map[string]os.FileInfo
-	var err error
-	for name, recursive := range w.names {
-		if recursive {
-			list , err = w.listRecursive(name)
-			if err != nil {
-				if os.IsNotExist(err) {
-					w.Error <- ErrWatchedFileDeleted
-					w.mu.Unlock()
-					w.RemoveRecursive(name)
-					w.mu.Lock()
-				} else {
-					w.Error <- err
-				}
-			}
-		} else {
-			list ,err = w.list(name)
-			if err != nil {
-				if os.IsNotExist(err) {
-					w.Error <- ErrWatchedFileDeleted
-					w.mu.Unlock()
-					w.Remove(name)
-					w.mu.Lock()
-
-				} else {
-					w.Error <- err
-				}
-			}
-		}
-		for k,v := range list {
-			fileList[k] = v
-		}
-	}
-	return fileList
-}
-
-func (w *Watcher) Start(d time.Duration) error {
-	if d < time.Nanosecond {
-		return ErrDurationTooShort
-	}
-	w.mu.Lock()
-	if w.runnning {
-		w.mu.Unlock()
-		return ErrWatcherRunning
-	}
-	w.runnning = true
-	w.mu.Unlock()
-	w.wg.Done()
-
-	for {
-		done := make(chan struct{})
-
-		evt := make(chan Event)
-
-		fileList := w.retrieveFileList()
-
-		cancel := make(chan struct{})
-
-		go func() {
-			done <- struct{}{}
-		}()
-		
-		numEvents := 0
-	inner:
-		for {
-			select {
-			case <- w.close:
-				close(cancel)
-				close(w.Closed)
-				return nil
-			case event := <-evt:
-				if len(w.ops) >0 {
-					_, found := w.ops[event.Op]
-					if !found {
-						continue
-					}
-				}
-				numEvents++
-				if w.maxEvents >0 && numEvents > w.maxEvents {
-					close(cancel)
-					break inner
-				}
-				w.Event <- event
-			case <- done:
-				break inner
-			}
-
-		}
-		w.mu.Lock()
-		w.files = fileList
-		w.mu.Unlock()
-
-		time.Sleep(d)
-	}
-}
-
-func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event,cancel chan struct{}) {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	creates := make(map[string]os.FileInfo)
-	removes := make(map[string]os.FileInfo)
-
-	for path, info := range w.files {
-		if _, found := files[path]; !found {
-			removes[path] = info
-		}
-	}
-
-	for path, info := range files {
-		oldInfo, found := w.files[path]
-		if !found {
-			creates[path] = info
-			continue
-		}
-		if oldInfo.ModTime() != info.ModTime() {
-			select {
-			case <- cancel:
-				return
-			case evt <- Event{Write, path, info}:
-
-			}
-		}
-
-		if oldInfo.Mode() != info.Mode() {
-			select {
-			case <- cancel:
-				return
-			case evt <- Event{Chmod, path, info}:
-			}
-		}
-	}
-	for path1, info1 := range removes {
-		for path2, info2 := range creates {
-			if sameFile(info1, info2) {
-				e := Event{
-					Op:		Move,
-					Path:	fmt.Sprintf("%s -> %s", path1, path2),
-					FileInfo: info1,
-				}
-				if filepath.Dir(path1) == filepath.Dir(path2) {
-					e.Op = Rename
-				}
-				delete(removes, path1)
-				delete(creates, path2)
-
-				select {
-				case <- cancel:
-					return
-				case evt <- e:
-
-				}
-			}
-		}
-	}
-
-	for path, info := range creates {
-		select {
-		case <- cancel:
-			return
-		case evt <- Event{Create, path, info}:
-
-		}
-	}
-
-	for path, info := range removes {
-		select {
-		case <- cancel:
-			return
-		case evt <- Event{Remove, path, info}:
-		}
-	}
-
-}
-
-func (w *Watcher) Wait() {
-	w.wg.Wait()
-}
-
-func (w *Watcher) Close() {
-	w.mu.Lock()
-	if !w.runnning {
-		w.mu.Unlock()
-		return
-	}
-	w.runnning = false
-	w.files = make(map[string]os.FileInfo)
-	w.names = make(map[string]bool)
-	w.mu.Unlock()
-
-	w.close <- struct{}{}
-}
-
-
-
-
-
+package watcher
+
+import (
+	"time"
+	"strings"
+	"path/filepath"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"io/ioutil"
+	"regexp"
+	"bufio"
+	"io"
+	"encoding/json"
+	"sort"
+	"context"
+	"hash"
+)
+
+var (
+	// 当调用watcher的start方法的事件小于1纳秒的时候会提示这个错误
+	ErrDurationTooShort = errors.New("error:duration is less than 1ns")
+	// 如果已经调用了watcher的start方法，并且轮询已经开始，再次调用start方法提示这个错误
+	ErrWatcherRunning = errors.New("error:watcher is already running")
+	// 如果被监控的文件或目录已经被删除了，提示这个错误
+	// 发送到Error的是包装过的WatchError，需要用errors.Is(err, ErrWatchedFileDeleted)判断
+	ErrWatchedFileDeleted = errors.New("error: watched file or folder deleted")
+)
+
+// 从这里到String方法之间的代码方式可以学习学习这种风格
+type Op uint32
+
+const (
+	Create Op = iota
+	Write
+	Remove
+	Rename
+	Chmod
+	Move
+	Alert		// 受保护路径的内容、权限或者属主和基线不一致
+	Escalation	// 文件获得了setuid、setgid位或者变成所有人可写，或者目录失去了sticky位
+	Attrib		// 通过TrackAttrs跟踪的文件属性发生了变化
+	Violation	// 文件违反了通过AddRule添加的策略规则
+	Response	// 通过AddResponse添加的响应动作执行完毕
+	Anomaly		// 短时间内出现了大量变化，见DetectBursts
+	Rotated		// 日志文件被轮转，见DetectRotation
+	Complete	// 投递目录里的文件上传完成，见DetectCompletion
+	RootAdded	// 通过AutoAdd自动添加了一个root
+	HeldOpen	// 被删除的文件仍然被进程打开着，见DetectHeldOpen
+	Allocated	// 文件分配的空间发生了变化，见TrackAllocation
+	Link		// 文件的硬链接数发生了变化，见TrackLinks
+	ChildMoved	// 所在的目录被重命名或移动，文件跟着挪到了新路径下
+	Evicted		// 条目数超过上限，文件不再被跟踪，见SetMaxEntries
+	QuotaExceeded	// root下的文件数超过了限额，见SetQuota
+	Degraded	// root太大，降级为抽样扫描，见SetSamplingPolicy
+	DataAvailable	// 命名管道里有数据可以读取，见WatchFIFOs
+	TransactionEnd	// 一个事务结束了，见GroupTransactions
+	Reattached	// Follow的路径上出现了新的文件，跟踪转到新文件上
+	Overflow	// 事件超过了速率上限被丢掉，见SetEventRateLimit
+	Chown		// 文件的属主或属组发生了变化
+	Truncate	// 文件变小了，见DetectSizeChanges
+	Append		// 文件变大了，见DetectSizeChanges
+	RateAlert	// 路径上的事件频率超过了阈值，见SetRateThreshold
+)
+
+var ops = map[Op]string{
+	Create:         "CREATE",
+	Write:          "WRITE",
+	Remove:         "REMOVE",
+	Rename:         "RENAME",
+	Chmod:          "CHMOD",
+	Move:           "MOVE",
+	Alert:          "ALERT",
+	Escalation:     "ESCALATION",
+	Attrib:         "ATTRIB",
+	Violation:      "VIOLATION",
+	Response:       "RESPONSE",
+	Anomaly:        "ANOMALY",
+	Rotated:        "ROTATED",
+	Complete:       "COMPLETE",
+	RootAdded:      "ROOT_ADDED",
+	HeldOpen:       "HELD_OPEN",
+	Allocated:      "ALLOCATED",
+	Link:           "LINK",
+	ChildMoved:     "CHILD_MOVED",
+	Evicted:        "EVICTED",
+	QuotaExceeded:  "QUOTA_EXCEEDED",
+	Degraded:       "DEGRADED",
+	DataAvailable:  "DATA_AVAILABLE",
+	TransactionEnd: "TRANSACTION_END",
+	Reattached:     "REATTACHED",
+	Overflow:       "OVERFLOW",
+	Chown:          "CHOWN",
+	Truncate:       "TRUNCATE",
+	Append:         "APPEND",
+	RateAlert:      "RATE_ALERT",
+}
+
+func (e Op) String() string {
+	if op, found := ops[e]; found {
+		return op
+	}
+	return "???"
+}
+
+// 汇总其他事件的合成事件，不经过FilterOps、FilterExpr等使用者的过滤，
+// 否则被过滤掉的普通事件触发的告警也会一起被过滤掉
+func syntheticOp(op Op) bool {
+	switch op {
+	case RateAlert, Anomaly, Overflow, TransactionEnd:
+		return true
+	}
+	return false
+}
+
+// ParseOp 按名字找到事件类型，比如 "create"、"WRITE"，不区分大小写
+func ParseOp(name string) (Op, error) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for op, opName := range ops {
+		if opName == name {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("error: unknown op %s", name)
+}
+
+type Event struct {
+	Op
+	Path string
+	os.FileInfo
+	ChangedKeys []string		// 结构化文件(JSON等)Write事件中发生变化的key
+	Latency     time.Duration	// Write和Create事件从文件修改时间到事件发送的延迟
+	Detail      string			// 事件的补充说明，比如Alert事件具体是什么和基线不一致
+	Change      ChangeKind		// Write事件是内容变了还是只有元数据变了，见ClassifyChanges
+	Transaction string			// 事件所属的事务，见GroupTransactions
+	OldPath     string			// Rename、Move和ChildMoved事件的旧路径，Path仍然是 "旧路径 -> 新路径"
+	NewPath     string			// Rename、Move和ChildMoved事件的新路径
+	OldInfo     os.FileInfo		// Rename、Move和ChildMoved事件移动之前的文件信息，和FileInfo相同；Write事件修改之前的文件信息
+}
+
+// 这个是核心的结构体
+type Watcher struct {
+	Event  chan Event
+	Batch  chan []Event		// 开启SetBatchMode之后，每一轮扫描的事件作为一个切片发送到这里
+	Error  chan error
+	Closed chan struct{}
+	close  chan struct{}
+	wg     *sync.WaitGroup
+
+	mu           *sync.Mutex
+	clock        Clock
+	runnning     bool
+	interval     time.Duration					// Start的轮询间隔，见SetPollInterval
+	intervalChanged chan struct{}				// 轮询间隔被修改时通知Start的等待
+	adaptiveMin  time.Duration					// 自适应轮询的最短间隔
+	adaptiveMax  time.Duration					// 自适应轮询的最长间隔，小于等于0时不自适应
+	adaptiveIdle int							// 连续多少轮没有事件之后放慢
+	idleScans    int							// 连续没有事件的扫描轮数
+	names        map[string]bool
+	roots        map[string]RootStatus			// 每个注册过的root的状态
+	minBackoff   time.Duration					// root扫描失败之后重试的退避时间
+	maxBackoff   time.Duration
+	rootTimeout  time.Duration					// 每个root一轮列出的超时，小于等于0时不限制
+	listing      map[string]*rootListing		// 超时之后还没有结束的root列出
+	globs        map[string]bool				// 通过AutoAdd注册的路径模式，值表示是否递归
+	rootEvents   []Event						// 自动添加root产生的还没有发送的事件
+	files        map[string]os.FileInfo
+	ignored      map[string]struct{}		// 要被忽略的文件或目录
+	ops          map[Op]struct{}
+	ignoreHidden bool						// 是否忽略隐藏文件
+	maxEvents    int
+	rateLimit    int							// 每ratePer时间内最多发送的事件数，小于等于0时不限制
+	ratePer      time.Duration
+	rateStart    time.Time						// 当前时间窗口的开始时间
+	rateSent     int							// 当前时间窗口里已经发送的事件数
+	paused       bool							// Pause之后为true，不再扫描
+	absorbing    bool							// Resume之后的第一轮扫描，只更新文件列表，不发送事件
+	batchMode    bool							// 是否把每一轮的事件一起发送到w.Batch
+	sortEvents   bool						// 每一轮的事件是否按路径排序后发送
+	detectEscalation bool					// 是否检测setuid/setgid等权限提升
+	detectRotation bool						// 是否检测日志轮转
+	detectHeldOpen bool						// 是否检测被删除但仍然打开的文件
+	watchFIFOs   bool							// 是否检测命名管道里有没有数据
+	classify     bool							// 是否给Write事件分类
+	classifyHash bool							// 分类时是否比较内容的哈希
+	hashes       map[string]string				// 普通文件上一次的SHA-256
+	sums         map[string]string				// Hash模式下普通文件上一次的内容哈希，为nil时比较修改时间
+	newHash      func() hash.Hash				// Hash模式使用的哈希算法，为nil时使用SHA-256
+	hashLimit    int64							// Hash模式下计算哈希的文件大小上限
+	checkOpen    bool							// 发送Write和Create之前是否确认文件没有被其他进程打开着
+	openDeferred map[string]Op					// 因为文件还被打开着而推迟的事件
+	fifos        map[string]*fifoState			// 为了检测数据打开着的命名管道
+	backend      Backend						// 发现变化的方式
+	native       notifyBackend					// Start期间打开的原生通知，轮询时为nil
+	watchExhausted bool							// watch描述符是否已经用完
+	followSymlinks bool							// 是否跟随符号链接
+	fullEvery    int							// 增量扫描时每隔多少轮完整扫描一次，小于等于0时不做增量扫描
+	dirCache     map[string]*rootCache			// 增量扫描时每个root下目录上一次读取的条目
+	concurrency  int							// 递归列出目录时并发读取目录的worker数
+	maxDepth     int							// 递归监控时最多进入的层数，小于等于0时不限制
+	watchSubdirs bool						// 非递归的root下新建的子目录是否自动监控
+	overlapPolicy OverlapPolicy				// 添加重叠的root时的处理方式
+	sameDevice   bool						// 递归监控时是否不进入其他文件系统
+	specialPolicy SpecialPolicy				// socket、FIFO、设备文件等特殊文件的处理方式
+	trackAlloc   bool						// 是否跟踪文件分配的块数
+	trackLinks   bool						// 是否跟踪文件的硬链接数
+	maxEntries   int							// 最多跟踪的条目数，小于等于0时不限制
+	evicted      map[string]bool				// 因为超过条目上限被淘汰的文件
+	quotas       map[string]int					// 每个root最多跟踪的文件数
+	overQuota    map[string]bool				// 已经报告过超过限额的root
+	samplingPolicy SamplingPolicy				// 超大root降级为抽样扫描的条件
+	sampling     map[string]*samplingState		// 每个递归root的降级状态
+	subdirRoots  map[string]bool				// 自动监控的子目录
+	rules        []namedRule					// 策略规则
+	helper       *scanHelper					// 设置了ScanAsUser时负责扫描的子进程
+	burstThreshold int							// 突发变化的阈值，小于等于0时不检测
+	burstWindow    time.Duration
+	burstEntries   []burstEntry					// 窗口内的变化
+	lastBurst      time.Time					// 上一次报告突发的时间
+	rates        map[string]*rateThreshold		// 每个路径的事件频率阈值
+	includes     map[string][]string			// 通过glob添加的root下需要匹配的模式
+	ignoreGlobs  []string						// 忽略的glob模式
+	includeRe    *regexp.Regexp					// 需要跟踪的文件路径，见FilterPaths
+	excludeRe    *regexp.Regexp					// 不跟踪的文件和目录路径
+	ffh          []FilterFileHookFunc			// 列出文件时调用的过滤钩子
+	rootOpts     map[string]*rootOptions		// 通过AddWithOptions给root单独设置的选项
+	detectSize   bool							// 是否区分文件变小和变大
+	followed     map[string]*followState		// 通过Follow按路径跟踪的文件
+	debounce     time.Duration					// 去抖的时间窗口，小于等于0时不去抖
+	debouncing   map[string]*debounced			// 每个路径等待合并的事件
+	txnWindow    time.Duration					// 事务分组的时间窗口，小于等于0时不分组
+	txns         map[string]*transaction		// 每个root上正在进行的事务
+	responses    []response						// 命中规则时执行的响应动作
+	contentRe    *regexp.Regexp			// Write和Create事件需要匹配的文件内容
+	contentLimit int64					// 匹配内容时最多读取的字节数
+	expr         *Expr					// 事件需要满足的过滤表达式
+	middleware   []Middleware			// 事件发送之前经过的中间件
+	handlers     *Dispatcher					// OnEvent、OnError等注册的处理函数
+	handlerMu    sync.Mutex
+	handling     bool							// 是否注册了事件处理函数
+	handlingErrors bool							// 是否注册了错误处理函数
+	handlerWorkers int							// 运行处理函数的worker数
+	handlerQueues []chan func()					// 每个worker的队列，第一次处理事件时启动
+	handlersDone chan struct{}
+	subMu        sync.Mutex
+	subscriptions []*Subscription				// Subscribe创建的订阅
+	recentMu     sync.Mutex
+	recent       []RecentEvent					// 最近发送的事件的环形缓冲，见KeepRecent
+	recentHead   int							// 下一个事件写入的位置
+	recentLen    int
+	structured   map[string]map[string]interface{}	// 结构化文件上一次解析的内容，为nil时不做结构化对比
+	archives     map[string]map[string]archiveEntry	// 压缩包上一次的成员列表，为nil时不对比成员
+	sampleRules  []SampleRule						// 大文件抽样指纹的规则，按MinSize从大到小排列
+	fingerprints map[string]fingerprint				// 命中抽样规则的文件上一次的指纹
+	protected    map[string]bool					// 受保护的路径，发生变化时对比基线
+	baselines    map[string]baseline				// 受保护路径下每个文件的基线
+	alerted      map[string]string				// 受保护的文件上一次报告的不一致，同样的不一致不重复报告
+	trackedAttrs []Attr							// 需要跟踪变化的文件属性
+	attrs        map[string]map[Attr]string			// 每个文件上一次的属性，为nil时不跟踪属性
+	dropDirs     map[string]CompletionPolicy		// 投递目录和判断上传完成的策略
+	completion   map[string]completionState			// 投递目录里每个文件的状态
+
+	onScanStart    func()
+	onScanComplete func(ScanSummary)
+
+	statsMu      sync.Mutex						// 保护stats、pathEvents和collected，扫描期间w.mu会被一直持有，所以单独加锁
+	stats        Stats
+	collecting   bool							// Scan执行期间为true，错误收集到collected里而不是发送到Error
+	collected    []error
+	pathEvents   map[string]uint64				// 每个路径发送过的事件数
+	scanHistory     []time.Duration				// 最近若干次扫描的耗时，写满之后循环覆盖
+	scanHistoryNext int
+	latencySum      time.Duration
+	latencyCount    int64
+
+	recMu        sync.Mutex
+	recorder     *json.Encoder					// 录制事件的目标，为nil时不录制
+	signKey      []byte							// 录制事件时签名用的密钥
+
+	manifestMu   sync.Mutex
+	manifestMode bool							// 是否把事件汇总成清单而不是发送到w.Event
+	manifestDir  string							// 清单写入的目录，为空时只保存在内存里
+	manifests    []Manifest						// 还没有被取走的清单，只在manifestDir为空时保存
+
+	traceMu      sync.Mutex
+	traces       map[string][]TraceEntry			// 调试模式下每个路径的判断记录，为nil时没有开启调试模式
+	excluded     map[string]string				// Preview期间没有列出的路径和原因，为nil时不记录
+	traceTo      *Watcher						// listingCopy返回的副本把判断记录到原来的Watcher
+	ready        sync.Once						// Start或者加入Pool时让Wait返回，只能释放一次
+}
+
+// 用于初始化Watcher
+func New() *Watcher {
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	return &Watcher{
+		Event:   make(chan Event),
+		Batch:   make(chan []Event),
+		Error:   make(chan error),
+		Closed:  make(chan struct{}),
+		close:   make(chan struct{}),
+		intervalChanged: make(chan struct{}, 1),
+		mu:      new(sync.Mutex),
+		clock:   realClock{},
+		wg:      &wg,
+		files:   make(map[string]os.FileInfo),
+		ignored: make(map[string]struct{}),
+		names:   make(map[string]bool),
+		roots:   make(map[string]RootStatus),
+		handlers: NewDispatcher(),
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		rootTimeout: defaultRootTimeout,
+	}
+}
+
+func (w *Watcher) SetMaxEvents(delta int) {
+	w.mu.Lock()
+	w.maxEvents = delta
+	w.mu.Unlock()
+}
+
+// 设置批量发送：开启后每一轮扫描检测到的所有事件在扫描结束时作为一个切片发送到w.Batch，不再逐个发送到w.Event，
+// 静态网站生成器这类使用者每一轮只需要重新构建一次；没有事件的扫描不发送；默认关闭
+func (w *Watcher) SetBatchMode(enable bool) {
+	w.mu.Lock()
+	w.batchMode = enable
+	w.mu.Unlock()
+}
+
+// 设置是否把每一轮扫描的事件按路径(路径相同时按事件类型)排序之后再发送，
+// 默认按检测到的顺序发送，顺序是不确定的；需要在多次运行之间比较输出时可以打开
+func (w *Watcher) SortEvents(sorted bool) {
+	w.mu.Lock()
+	w.sortEvents = sorted
+	w.mu.Unlock()
+}
+
+// 设置是否忽略隐藏的文件或目录，名字以.开头的，以及Windows上带有隐藏属性、macOS上被chflags hidden的都算隐藏；
+// 隐藏目录下的整棵子树都被忽略，Add的路径里任何一级是隐藏的也会被忽略
+func (w *Watcher) IgnoreHiddenFiles(ignore bool) {
+	w.mu.Lock()
+	w.ignoreHidden = ignore
+	w.mu.Unlock()
+}
+
+// 设置是否跟随符号链接：开启后指向文件的链接使用目标文件的信息，目标文件的修改会以链接的路径报告；
+// 递归监控时会进入指向目录的链接，里面的文件同样以链接下的路径报告，链接到自己的上级目录或者
+// 已经遍历过的目录时链接本身会被监控，但是不进入；默认不跟随，符号链接被当作普通文件
+func (w *Watcher) FollowSymlinks(follow bool) {
+	w.mu.Lock()
+	w.followSymlinks = follow
+	w.mu.Unlock()
+}
+
+// 设置递归监控时最多监控root下的n层，第n层的目录本身会被监控，但是不进入；
+// 1表示只监控root下直接的文件和目录，和Add一样；n小于等于0时不限制，默认不限制
+// 像node_modules这样很深的目录树，只关心上面几层的时候可以省掉每一轮遍历整棵树的开销
+func (w *Watcher) SetMaxDepth(n int) {
+	w.mu.Lock()
+	w.maxDepth = n
+	w.mu.Unlock()
+}
+
+// 设置递归监控时是否只停留在root所在的文件系统上(类似find -xdev)，
+// 开启后不会进入网络挂载、bind挂载、/proc这样的其他文件系统，挂载点目录本身仍然会被监控
+// 在不能获得设备号的平台上(Windows)没有效果
+func (w *Watcher) SameDevice(enable bool) {
+	w.mu.Lock()
+	w.sameDevice = enable
+	w.mu.Unlock()
+}
+
+// 设置自己需要过滤的事件，RateAlert、Anomaly、Overflow、TransactionEnd这些汇总事件不受影响
+func (w *Watcher) FilterOps(ops ...Op) {
+	w.mu.Lock()
+	w.ops = make(map[Op]struct{})
+	for _, op := range ops {
+		w.ops[op] = struct{}{}
+	}
+	w.mu.Unlock()
+}
+
+// 内容过滤时默认最多读取的字节数
+const defaultContentLimit = 1 << 20
+
+// 设置内容过滤，Write和Create事件只有在文件内容匹配re的时候才会发送；Create检查文件的前limit个字节，
+// Write检查文件变大时追加的部分，没有变大时检查最后limit个字节，追加的部分超过limit时只检查最后limit个字节
+// limit 小于等于0时使用默认的1MB，re为nil时取消内容过滤；设置了ScanAsUser时不能开启
+func (w *Watcher) FilterContent(re *regexp.Regexp, limit int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if re != nil {
+		if err := w.refuseContent("FilterContent"); err != nil {
+			return err
+		}
+	}
+	if limit <= 0 {
+		limit = defaultContentLimit
+	}
+	w.contentRe = re
+	w.contentLimit = limit
+	return nil
+}
+
+// 判断事件是否通过内容过滤，只检查Write和Create事件，目录和读取失败的文件都不能通过
+func (w *Watcher) matchContent(event Event) bool {
+	w.mu.Lock()
+	re, limit := w.contentRe, w.contentLimit
+	w.mu.Unlock()
+	return contentMatches(re, limit, event)
+}
+
+// 用re检查事件对应的文件内容，检查的范围见FilterContent，re为nil时都通过
+func contentMatches(re *regexp.Regexp, limit int64, event Event) bool {
+	if re == nil || (event.Op != Write && event.Op != Create) {
+		return true
+	}
+	if event.IsDir() {
+		return false
+	}
+	f, err := os.Open(event.Path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	if event.Op == Write {
+		// 按打开之后的大小计算，事件之后文件可能又变了
+		info, err := f.Stat()
+		if err != nil {
+			return false
+		}
+		start := info.Size() - limit
+		if event.OldInfo != nil && event.OldInfo.Size() < info.Size() && event.OldInfo.Size() > start {
+			start = event.OldInfo.Size()
+		}
+		if start > 0 {
+			if _, err := f.Seek(start, io.SeekStart); err != nil {
+				return false
+			}
+		}
+	}
+	return re.MatchReader(bufio.NewReader(io.LimitReader(f, limit)))
+}
+
+// 添加一个单独文件或者一个目录到file list
+// name可以是glob模式(比如*.log、src/**/*.go)，这时模式里不含通配符的目录作为root，只跟踪匹配的文件，
+// 每一轮扫描重新匹配，之后新出现的匹配文件也会被跟踪
+func (w *Watcher) Add(name string) (err error) {
+	if hasMeta(name) {
+		return w.addGlob(name)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	delete(w.includes, name)
+
+	// 如果文件在要忽略的list，或者在忽略的目录下面
+	if w.ignoredPath(name) || (w.ignoreHidden && hiddenPath(name)) {
+		return nil
+	}
+	register, warning := w.checkOverlap(name, false)
+	if !register {
+		return warning
+	}
+	fileList, err := w.listAdded(name, false)
+	if err != nil {
+		return err
+	}
+	for k,v := range fileList {
+		w.files[k] = v
+		w.trackFile(k, v)
+	}
+	w.names[name] = false
+	w.setRootStatus(name, false, nil)
+	return warning
+}
+
+func (w *Watcher) list(name string) (map[string]os.FileInfo, error) {
+	fileList := make(map[string]os.FileInfo)
+
+	// 确认文件是否存在
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fileList[name] = stat
+	// 如果不是一个目录的话直接返回
+	if !stat.IsDir() {
+		return fileList, nil
+	}
+	// 如果是一个目录按照下面处理
+	fInfoList, err := ioutil.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 循环将在这个目录下的所有文件添加到 file list,当然这些文件不能是在要忽略的列表或者ignoreHidden设置为true
+	for _, fInfo := range fInfoList {
+		path := filepath.Join(name, fInfo.Name())
+		if _, ignored := w.ignored[path]; ignored || w.ignoredGlob(path) {
+			w.trace(path, Create, "not listed: path is ignored")
+			continue
+		}
+		if w.ignoreHidden && isHidden(path, fInfo) {
+			w.trace(path, Create, "not listed: hidden file")
+			continue
+		}
+		if w.skipSpecial(path, fInfo) {
+			continue
+		}
+		if !w.included(name, path) {
+			w.trace(path, Create, "not listed: does not match %s", strings.Join(w.includes[name], ", "))
+			continue
+		}
+		if w.followSymlinks && fInfo.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil {
+				fInfo = target
+			}
+		}
+		if reason := w.pathFiltered(path, fInfo.IsDir()); reason != "" {
+			w.trace(path, Create, "not listed: %s", reason)
+			continue
+		}
+		if skip, err := w.hookFiltered(path, fInfo); err != nil {
+			return nil, err
+		} else if skip {
+			w.trace(path, Create, "not listed: skipped by filter hook")
+			continue
+		}
+		fileList[path] = fInfo
+	}
+	return fileList, nil
+}
+
+// 递归添加一个文件或者目录下的文件到file list
+func (w *Watcher) AddRecursive(name string) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	delete(w.includes, name)
+
+	if w.ignoredPath(name) || (w.ignoreHidden && hiddenPath(name)) {
+		return nil
+	}
+	register, warning := w.checkOverlap(name, true)
+	if !register {
+		return warning
+	}
+	fileList, err := w.listAdded(name, true)
+	if err != nil {
+		return err
+	}
+	for k, v := range fileList {
+		w.files[k] = v
+		w.trackFile(k, v)
+	}
+
+	w.names[name] = true
+	w.setRootStatus(name, true, nil)
+	return warning
+}
+
+func (w *Watcher) listRecursive(name string) (map[string]os.FileInfo, error) {
+	return w.walkTree(name, nil, true)
+}
+
+// 递归列出name下的文件，skip不为nil时，skip返回true的目录本身会被列出，但是不进入
+// cached为false时不使用也不更新增量扫描的缓存，用于Preview这种不能改变状态的列出
+func (w *Watcher) walkTree(name string, skip func(path string) bool, cached bool) (map[string]os.FileInfo, error) {
+	fileList := make(map[string]os.FileInfo)
+	var rootDev uint64
+	var checkDev bool
+
+	// 跟随符号链接时记录已经遍历过的目录，链接回root也算循环
+	visited := make(map[string]bool)
+	if w.followSymlinks {
+		if real, err := filepath.EvalSymlinks(name); err == nil {
+			visited[real] = true
+		}
+	}
+
+	var walk filepath.WalkFunc
+	walk = func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// 跟随符号链接时，链接到的目录按链接的路径继续遍历，链接到的文件使用目标文件的信息
+		if w.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+			path = filepath.Clean(path)
+			if target, err := os.Stat(path); err == nil {
+				if !target.IsDir() {
+					info = target
+				} else if symlinkCycle(path, visited) {
+					w.trace(path, Create, "not descended: symlink cycle")
+					fileList[path] = target
+					return nil
+				} else {
+					// 结尾加上分隔符，Walk才会进入链接到的目录
+					return filepath.Walk(path+string(filepath.Separator), walk)
+				}
+			}
+		}
+		path = filepath.Clean(path)
+
+		if skip != nil && info.IsDir() && path != name && skip(path) {
+			fileList[path] = info
+			return filepath.SkipDir
+		}
+		descend := true
+		if w.maxDepth > 0 && info.IsDir() && path != name {
+			rel, _ := filepath.Rel(name, path)
+			descend = strings.Count(rel, string(filepath.Separator))+1 < w.maxDepth
+		}
+
+		// 开启了SameDevice时，其他文件系统的挂载点本身会被列出，但是不进入
+		if w.sameDevice && info.IsDir() {
+			dev, _, ok := fileID(info)
+			if path == name {
+				rootDev, checkDev = dev, ok
+			} else if checkDev && ok && dev != rootDev {
+				w.trace(path, Create, "not descended: on another device")
+				fileList[path] = info
+				return filepath.SkipDir
+			}
+		}
+
+		_, ignored := w.ignored[path]
+		ignored = ignored || w.ignoredGlob(path)
+		if ignored || (w.ignoreHidden && isHidden(path, info)) {
+			if ignored {
+				w.trace(path, Create, "not listed: path is ignored")
+			} else {
+				w.trace(path, Create, "not listed: hidden file")
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path != name && w.skipSpecial(path, info) {
+			return nil
+		}
+		if path != name {
+			if reason := w.pathFiltered(path, info.IsDir()); reason != "" {
+				w.trace(path, Create, "not listed: %s", reason)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if skip, err := w.hookFiltered(path, info); err != nil {
+				return err
+			} else if skip {
+				w.trace(path, Create, "not listed: skipped by filter hook")
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		// 通过glob添加的root下，不匹配的目录仍然要进入
+		if !w.included(name, path) {
+			if !info.IsDir() {
+				w.trace(path, Create, "not listed: does not match %s", strings.Join(w.includes[name], ", "))
+			}
+			if !descend {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fileList[path] = info
+		if !descend {
+			w.trace(path, Create, "not descended: deeper than max depth %d", w.maxDepth)
+			return filepath.SkipDir
+		}
+		return nil
+	}
+	if w.fullEvery > 0 && cached {
+		return fileList, w.walkIncremental(name, walk)
+	}
+	if w.concurrency > 1 {
+		return fileList, walkParallel(name, w.concurrency, readDir, nil, walk)
+	}
+	return fileList, filepath.Walk(name, walk)
+}
+
+// 跟随path这个指向目录的符号链接是否会形成循环(链接到了自己的上级目录)或者重复遍历同一个目录，
+// 不能解析的链接也当作循环处理
+func symlinkCycle(path string, visited map[string]bool) bool {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return true
+	}
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil || visited[target] || underPath(parent, target) {
+		return true
+	}
+	visited[target] = true
+	return false
+}
+
+// 从file list 中删除一个文件或者目录
+func (w *Watcher) Remove(name string) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name, err = filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+
+	// 从w.names中删除一个name
+	delete(w.names, name)
+	delete(w.roots, name)
+	delete(w.includes, name)
+	delete(w.dirCache, name)
+	delete(w.listing, name)
+	delete(w.rootOpts, name)
+
+	// 如果name 是一个文件，则从files中删除
+	info, found := w.files[name]
+	if !found {
+		return nil
+	}
+	if !info.IsDir() {
+		delete(w.files, name)
+		return nil
+	}
+
+	// 删除目录从w.files中
+	delete(w.files, name)
+
+	// 如果是一个目录则删除它包含的所有内容从files中
+	for path := range w.files {
+		if filepath.Dir(path) == name {
+			delete(w.files, path)
+		}
+	}
+	w.removeSubdirs(name)
+	return nil
+}
+
+// 从文件列表中递归删除单个文件或者目录
+func (w *Watcher) RemoveRecursive(name string) (err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	name, err = filepath.Abs(name)
+	if err!= nil {
+		return err
+	}
+	// 从names list中删除指定name
+	delete(w.names, name)
+	delete(w.roots, name)
+	delete(w.includes, name)
+	delete(w.dirCache, name)
+	delete(w.listing, name)
+	delete(w.rootOpts, name)
+
+	// 如果name是一个单个文件，删除它并且return
+	info, found := w.files[name]
+	if !found {
+		return nil
+	}
+
+	if !info.IsDir() {
+		delete(w.files,name)
+		return nil
+	}
+	// 如果是一个目录， 删除所有的以及递归删除它包含的从w.files
+	for path := range w.files {
+		if strings.HasPrefix(path, name) {
+			delete(w.files, path)
+		}
+	}
+	return nil
+
+}
+
+// 添加要忽略的路径，也可以是glob模式，不含路径分隔符的模式(比如*.log)匹配任意目录下的文件名
+// 忽略一个目录时忽略它下面的整棵子树，包括之后才创建的文件，以及之后Add的在这个目录下面的路径
+// 将已经添加到files中的，忽略移除他们
+func (w *Watcher) Ignore(paths ...string) (err error) {
+	for _, path := range paths {
+		// glob模式，比如*.log
+		if hasMeta(path) {
+			if err := w.ignoreGlob(path); err != nil {
+				return err
+			}
+			continue
+		}
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		// 地推的删除所有我们添加的
+		if err := w.RemoveRecursive(path); err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.ignored[path] = struct{}{}
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// 添加要忽略的glob模式，和Ignore不同，不含通配符的模式也按glob处理：
+// 不含路径分隔符的模式(比如node_modules、*.log)匹配任意目录下的名字，匹配的目录下面的整棵子树都被忽略
+func (w *Watcher) IgnoreGlob(patterns ...string) error {
+	for _, pattern := range patterns {
+		if err := w.ignoreGlob(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// path或者它的上级目录是否被忽略，调用的时候需要持有w.mu
+func (w *Watcher) ignoredPath(path string) bool {
+	for p := path; ; p = filepath.Dir(p) {
+		if _, ignored := w.ignored[p]; ignored {
+			return true
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+	return w.ignoredGlobTree(path)
+}
+
+// 返回被监控的文件，返回的是一份拷贝，可以在扫描进行的同时遍历和修改
+func (w *Watcher) WatchedFiles() map[string]os.FileInfo {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files := make(map[string]os.FileInfo, len(w.files))
+	for path, info := range w.files {
+		files[path] = info
+	}
+	return files
+}
+
+type fileInfo struct {
+	name 		string
+	size 		int64
+	mode 		os.FileMode
+	modTime	 	time.Time
+	sys			interface{}
+	dir 		bool
+}
+
+func (fs *fileInfo) IsDir() bool {
+	return fs.dir
+}
+
+func (fs *fileInfo) ModTime() time.Time {
+	return fs.modTime
+}
+
+func (fs *fileInfo) Mode() os.FileMode {
+	return fs.mode
+}
+
+func (fs *fileInfo) Name() string {
+	return fs.name
+}
+
+func (fs *fileInfo) Size() int64 {
+	return fs.size
+}
+
+func (fs *fileInfo) Sys() interface{} {
+	return fs.sys
+}
+
+// TriggerEvent 是一个用来触发事件的方法，与文件watching 进程是分开的
+func (w *Watcher) TriggerEvent(eventType Op, file os.FileInfo) {
+	w.Wait()
+	if file == nil {
+		file = &fileInfo{name: "triggered event", modTime: w.clock.Now()}
+	}
+	w.Event <- Event{Op: eventType, Path: "-", FileInfo: file}
+}
+
+// 返回所有被监控的文件，以及每个root列出文件花费的时间
+// 每个root在自己的goroutine里列出，等待的时候不持有w.mu，超过rootTimeout的root这一轮沿用上一次的文件列表
+func(w *Watcher) retrieveFileList() (map[string]os.FileInfo, map[string]time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expandGlobs()
+	fileList := make(map[string]os.FileInfo)
+	durations := make(map[string]time.Duration)
+	var listings []*rootListing
+	for name, recursive := range w.names {
+		if w.dropSubdir(name) {
+			continue
+		}
+		start := w.clock.Now()
+		if w.backingOff(name, start) {
+			// 上一次失败之后还在退避，沿用上一次的文件列表
+			for k,v := range w.previousList(name, recursive) {
+				fileList[k] = v
+			}
+			continue
+		}
+		if w.rootNotDue(name, start) {
+			// 还没到这个root自己的轮询间隔
+			for k,v := range w.previousList(name, recursive) {
+				fileList[k] = v
+			}
+			continue
+		}
+		if w.stillListing(name) {
+			// 超时的列出还没有结束
+			for k,v := range w.previousList(name, recursive) {
+				fileList[k] = v
+			}
+			continue
+		}
+		listings = append(listings, w.startListing(name, recursive, start))
+	}
+	timeout := w.rootTimeout
+	w.mu.Unlock()
+	awaitListings(listings, timeout)
+	w.mu.Lock()
+
+	for _, l := range listings {
+		name, recursive := l.name, l.recursive
+		if r, found := w.names[name]; !found || r != recursive {
+			// 等待期间root被移除或者重新添加了
+			continue
+		}
+		var list map[string]os.FileInfo
+		var err error
+		select {
+		case <-l.done:
+			list, err = l.list, l.err
+			durations[name] = l.elapsed
+			w.checkDegraded(name, list, durations[name])
+		default:
+			if w.listing == nil {
+				w.listing = make(map[string]*rootListing)
+			}
+			w.listing[name] = l
+			err = fmt.Errorf("%w after %s", ErrRootTimeout, timeout)
+			durations[name] = w.since(l.start)
+		}
+		if err != nil {
+			// 先移除再发送错误，使用者收到错误之后重新添加的root不会被移除
+			if os.IsNotExist(err) {
+				w.mu.Unlock()
+				if recursive {
+					w.RemoveRecursive(name)
+				} else {
+					w.Remove(name)
+				}
+				w.mu.Lock()
+			}
+			w.sendError(listError(name, recursive, err))
+		}
+		// 被删除的root会被Remove掉，这里保留它之前的状态
+		if _, found := w.roots[name]; !found {
+			w.roots[name] = l.status
+		}
+		w.setRootStatus(name, recursive, err)
+		list = w.rootResult(name, recursive, list, err)
+		list = w.applyQuota(name, list)
+		for k,v := range list {
+			fileList[k] = v
+		}
+	}
+	w.filterEvicted(fileList)
+	return fileList, durations
+}
+
+func (w *Watcher) Start(d time.Duration) error {
+	if d < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	w.mu.Lock()
+	if w.runnning {
+		w.mu.Unlock()
+		return ErrWatcherRunning
+	}
+	w.runnning = true
+	w.interval = d
+	if w.adaptiveMax > 0 {
+		w.interval = clampInterval(d, w.adaptiveMin, w.adaptiveMax)
+	}
+	wake, err := w.openNative()
+	w.mu.Unlock()
+	w.ready.Do(w.wg.Done)
+	if err != nil {
+		// 打不开原生通知时退回轮询
+		w.sendError(err)
+	}
+
+	for {
+		if closed := w.scan(w.pollInterval(), nil); closed {
+			return nil
+		}
+
+		// 等待期间间隔被修改时按新的间隔重新计算剩下的时间
+		scanned := w.clock.Now()
+	wait:
+		for {
+			select {
+			case <- w.close:
+				close(w.Closed)
+				return nil
+			case <-w.clock.After(w.pollInterval() - w.since(scanned)):
+				break wait
+			case <-wake:
+				break wait
+			case <-w.intervalChanged:
+			}
+		}
+	}
+}
+
+// 设置轮询间隔，可以在Start之后随时调用，正在等待的这一轮马上按新的间隔计算，
+// 应用空闲的时候可以放慢轮询，用户正在编辑的时候再加快，不需要重新启动
+func (w *Watcher) SetPollInterval(d time.Duration) error {
+	if d < time.Nanosecond {
+		return ErrDurationTooShort
+	}
+	w.mu.Lock()
+	w.interval = d
+	w.mu.Unlock()
+	select {
+	case w.intervalChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 返回当前的轮询间隔，通过AddWithOptions设置的root间隔更短时取更短的
+func (w *Watcher) pollInterval() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.shortestInterval()
+}
+
+// StartContext 和Start一样开始监控，ctx被取消或者超时之后停止监控(相当于调用Close)，返回ctx.Err()；
+// 在ctx结束之前调用Close时返回nil
+func (w *Watcher) StartContext(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			w.Close()
+		case <-done:
+		}
+	}()
+	err := w.Start(d)
+	close(done)
+	<-stopped
+	if err == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// 暂停监控：之后的扫描都会跳过，不发送事件，文件列表和各种设置都保留，不需要Close之后重新Add
+// 适合构建脚本往被监控的目录里写文件的时候临时关掉监控
+func (w *Watcher) Pause() {
+	w.mu.Lock()
+	w.paused = true
+	w.mu.Unlock()
+}
+
+// 恢复监控：下一轮扫描只把暂停期间的变化更新到文件列表里，不发送事件，之后的变化照常发送
+func (w *Watcher) Resume() {
+	w.mu.Lock()
+	if w.paused {
+		w.paused = false
+		w.absorbing = true
+	}
+	w.mu.Unlock()
+}
+
+// 是否处于暂停状态
+func (w *Watcher) Paused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.paused
+}
+
+// Step 同步执行一轮扫描，把检测到的事件发送到w.Event之后返回，不需要调用Start
+// 没有定时器和等待，适合测试和批处理工具；w.Event没有缓冲，所以需要在另一个goroutine里读取事件
+func (w *Watcher) Step() error {
+	w.mu.Lock()
+	if w.runnning {
+		w.mu.Unlock()
+		return ErrWatcherRunning
+	}
+	w.mu.Unlock()
+
+	w.scan(0, nil)
+	return nil
+}
+
+// Pool调度的一轮扫描，d是Pool的轮询间隔，用来检测扫描超时和按root的间隔跳过root，listed在列出文件之后调用
+func (w *Watcher) poolStep(d time.Duration, listed func()) {
+	w.mu.Lock()
+	if w.runnning {
+		w.mu.Unlock()
+		return
+	}
+	w.interval = d
+	w.mu.Unlock()
+
+	w.scanListed(d, nil, listed)
+}
+
+// Scan 同步执行一轮扫描，返回和上一次扫描(或者Add时的状态)相比检测到的事件，事件不会发送到w.Event
+// 扫描中的错误也不会发送到w.Error，而是返回第一个错误，适合cron任务和CI里只想知道"上次之后改了什么"的场景
+func (w *Watcher) Scan() ([]Event, error) {
+	w.mu.Lock()
+	if w.runnning {
+		w.mu.Unlock()
+		return nil, ErrWatcherRunning
+	}
+	w.mu.Unlock()
+
+	w.statsMu.Lock()
+	w.collecting = true
+	w.collected = nil
+	w.statsMu.Unlock()
+
+	events := []Event{}
+	w.scan(0, &events)
+
+	w.statsMu.Lock()
+	errs := w.collected
+	w.collecting = false
+	w.collected = nil
+	w.statsMu.Unlock()
+	if len(errs) > 0 {
+		return events, errs[0]
+	}
+	return events, nil
+}
+
+// 执行一轮扫描并发送事件，d是轮询间隔，为0时不检查扫描是否超时
+// collect不为nil时事件追加到collect里，不发送到w.Event
+// 扫描期间watcher被关闭的话返回true
+func (w *Watcher) scan(d time.Duration, collect *[]Event) (closed bool) {
+	return w.scanListed(d, collect, nil)
+}
+
+// 和scan一样，listed不为nil时在列出文件之后、发送事件之前调用
+func (w *Watcher) scanListed(d time.Duration, collect *[]Event, listed func()) (closed bool) {
+	w.mu.Lock()
+	if w.paused {
+		w.mu.Unlock()
+		return false
+	}
+	absorbing := w.absorbing
+	w.absorbing = false
+	w.mu.Unlock()
+
+	done := make(chan struct{}, 1)
+
+	evt := make(chan Event)
+
+	w.scanStarted()
+	scanStart := w.clock.Now()
+	fileList, durations := w.retrieveFileList()
+	if listed != nil {
+		listed()
+	}
+	elapsed := w.since(scanStart)
+	w.recordScan(fileList, elapsed)
+	if d > 0 && elapsed > d {
+		w.sendError(&ScanOverrunError{Duration: elapsed, Interval: d, Roots: durations})
+	}
+
+	cancel := make(chan struct{})
+
+	go func() {
+		w.pollEvents(fileList, evt, cancel)
+		done <- struct{}{}
+	}()
+
+	manifest := w.newManifest(scanStart)
+	w.mu.Lock()
+	batching := w.batchMode
+	w.mu.Unlock()
+	var batch []Event
+	var overflowed []string		// 这一轮因为速率限制被丢掉的事件的路径
+	numEvents := 0
+	sent := 0
+	deliver := w.chain(func(event Event) {
+		w.trace(event.Path, event.Op, "emitted")
+		w.measureLatency(&event)
+		if collect != nil {
+			*collect = append(*collect, event)
+		} else if manifest != nil {
+			manifest.add(event)
+		} else if batching {
+			batch = append(batch, event)
+		} else if !w.handleEvent(event) && !w.subscribed() {
+			w.Event <- event
+		}
+		w.publish(event)
+		w.keepRecent(event)
+		w.recordEvent(event)
+		w.recordTo(event)
+		w.countTransaction(event)
+		sent++
+	})
+inner:
+	for {
+		select {
+		case <- w.close:
+			close(cancel)
+			close(w.Closed)
+			return true
+		case event := <-evt:
+			if absorbing {
+				w.trace(event.Path, event.Op, "suppressed: changed while paused")
+				continue
+			}
+			if syntheticOp(event.Op) {
+				deliver(event)
+				continue
+			}
+			if len(w.ops) >0 {
+				_, found := w.ops[event.Op]
+				if !found {
+					w.trace(event.Path, event.Op, "suppressed: op not in FilterOps")
+					w.recordDropped(DropFilterOps)
+					continue
+				}
+			}
+			if !w.rootAllows(event) {
+				w.trace(event.Path, event.Op, "suppressed: op not in root Ops")
+				w.recordDropped(DropFilterOps)
+				continue
+			}
+			if !w.matchContent(event) {
+				w.trace(event.Path, event.Op, "suppressed: content does not match FilterContent")
+				w.recordDropped(DropFilterContent)
+				continue
+			}
+			if !w.matchExpr(event) {
+				w.trace(event.Path, event.Op, "suppressed: FilterExpr is false")
+				w.recordDropped(DropFilterExpr)
+				continue
+			}
+			numEvents++
+			if w.maxEvents >0 && numEvents > w.maxEvents {
+				w.trace(event.Path, event.Op, "suppressed: more than %d events in this scan", w.maxEvents)
+				w.recordDropped(DropMaxEvents)
+				close(cancel)
+				break inner
+			}
+			if !w.allowEvent() {
+				w.trace(event.Path, event.Op, "suppressed: over event rate limit")
+				w.recordDropped(DropRateLimit)
+				overflowed = append(overflowed, eventPaths(event)[0])
+				continue
+			}
+			deliver(event)
+		case <- done:
+			break inner
+		}
+
+	}
+	if len(overflowed) > 0 {
+		deliver(w.overflowEvent(overflowed))
+	}
+	if len(batch) > 0 {
+		select {
+		case w.Batch <- batch:
+		case <- w.close:
+			close(w.Closed)
+			return true
+		}
+	}
+	w.mu.Lock()
+	w.files = fileList
+	err := w.syncWatches(fileList)
+	w.mu.Unlock()
+	if err != nil {
+		w.sendError(err)
+	}
+	w.finishManifest(manifest)
+	w.scanCompleted(ScanSummary{
+		Started:  scanStart,
+		Duration: w.since(scanStart),
+		Files:    len(fileList),
+		Events:   sent,
+	})
+	w.adaptInterval(sent > 0)
+	return false
+}
+
+// 记录文件的附加状态(结构化内容、压缩包成员、抽样指纹、属性)，调用的时候需要持有w.mu
+func (w *Watcher) trackFile(path string, info os.FileInfo) {
+	w.loadStructured(path, info)
+	w.loadArchive(path, info)
+	w.loadFingerprint(path, info)
+	w.loadAttrs(path, info)
+	w.loadHash(path, info)
+	w.loadSum(path, info)
+}
+
+// 删除文件的附加状态，调用的时候需要持有w.mu
+func (w *Watcher) untrackFile(path string) {
+	delete(w.structured, path)
+	delete(w.archives, path)
+	delete(w.fingerprints, path)
+	delete(w.attrs, path)
+	delete(w.hashes, path)
+	delete(w.sums, path)
+}
+
+// 文件被重命名或者移动之后，把附加状态挪到新的路径下，调用的时候需要持有w.mu
+func (w *Watcher) moveTracked(oldPath, newPath string) {
+	w.moveStructured(oldPath, newPath)
+	w.moveArchive(oldPath, newPath)
+	if fp, found := w.fingerprints[oldPath]; found {
+		delete(w.fingerprints, oldPath)
+		w.fingerprints[newPath] = fp
+	}
+	if values, found := w.attrs[oldPath]; found {
+		delete(w.attrs, oldPath)
+		w.attrs[newPath] = values
+	}
+	if sum, found := w.hashes[oldPath]; found {
+		delete(w.hashes, oldPath)
+		w.hashes[newPath] = sum
+	}
+	if sum, found := w.sums[oldPath]; found {
+		delete(w.sums, oldPath)
+		w.sums[newPath] = sum
+	}
+}
+
+func (w *Watcher) pollEvents(files map[string]os.FileInfo, evt chan Event,cancel chan struct{}) {
+	events, pending := w.detectEvents(files)
+	events = append(events, w.checkIntegrity(files)...)
+	events = append(events, w.runResponses(pending)...)
+	// Anomaly和RateAlert优先级比较高，放在这一轮的最前面
+	events = append(append(w.detectBurst(events), w.detectRate(events)...), events...)
+	events = w.debounceEvents(events)
+	events = w.groupTransactions(events)
+
+	w.mu.Lock()
+	sorted := w.sortEvents
+	w.mu.Unlock()
+	if sorted {
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Path != events[j].Path {
+				return events[i].Path < events[j].Path
+			}
+			return events[i].Op < events[j].Op
+		})
+	}
+
+	for _, e := range events {
+		select {
+		case <- cancel:
+			return
+		case evt <- e:
+		}
+	}
+}
+
+// 对比w.files和这次扫描到的files，返回这一轮的所有事件以及需要执行的响应
+func (w *Watcher) detectEvents(files map[string]os.FileInfo) ([]Event, []pendingResponse) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	events := w.rootEvents
+	w.rootEvents = nil
+	var pending []pendingResponse
+	creates := make(map[string]os.FileInfo)
+	removes := make(map[string]os.FileInfo)
+
+	for path, info := range w.files {
+		if _, found := files[path]; !found {
+			removes[path] = info
+		}
+	}
+
+	for path, info := range files {
+		if _, found := w.files[path]; !found {
+			creates[path] = info
+		}
+	}
+
+	for path, info := range files {
+		oldInfo, found := w.files[path]
+		if !found {
+			continue
+		}
+		if w.specialPolicy == SpecialExistence && isSpecial(info) {
+			continue
+		}
+		if e, movedTo, found := w.rotation(path, oldInfo, info, creates); found {
+			// 附加状态跟着旧文件走，当前路径上的文件重新记录
+			if movedTo != "" {
+				w.moveTracked(path, movedTo)
+				delete(creates, movedTo)
+			}
+			w.trackFile(path, info)
+			events = append(events, e)
+			continue
+		}
+		changed, reason := w.contentChanged(path, oldInfo, info)
+		if !changed && reason != "" {
+			w.trace(path, Write, "not detected: %s", reason)
+		}
+		if changed {
+			w.trace(path, Write, "detected: %s", reason)
+			e := Event{Op: Write, Path: path, FileInfo: info, OldInfo: oldInfo, Change: w.classifyChange(path, oldInfo, info)}
+			w.diffStructured(&e)
+			events = append(events, e)
+			if e, found := w.sizeChange(path, oldInfo, info); found {
+				events = append(events, e)
+			}
+			events = append(events, w.diffArchive(path, info)...)
+		}
+
+		if oldInfo.Mode() != info.Mode() {
+			w.trace(path, Chmod, "detected: mode changed %s -> %s", oldInfo.Mode(), info.Mode())
+			events = append(events, Event{Op: Chmod, Path: path, FileInfo: info})
+			if e, found := w.escalation(path, oldInfo, info); found {
+				events = append(events, e)
+			}
+		}
+		e, chowned := w.ownerChanged(path, oldInfo, info)
+		if chowned {
+			events = append(events, e)
+		}
+		if e, found := w.allocation(path, oldInfo, info); found {
+			events = append(events, e)
+		}
+		if e, found := w.linkCount(path, oldInfo, info); found {
+			events = append(events, e)
+		}
+		events = append(events, w.diffAttrs(path, info)...)
+		if changed || oldInfo.Mode() != info.Mode() || chowned {
+			events = append(events, w.applyRules(path, oldInfo, info)...)
+			pending = append(pending, w.matchResponses(path, oldInfo, info)...)
+		}
+	}
+	// 按路径排序，目录在它下面的文件之前处理，这样目录移动时子文件可以整体挪过去
+	removed := make([]string, 0, len(removes))
+	for path := range removes {
+		removed = append(removed, path)
+	}
+	sort.Strings(removed)
+	for _, path1 := range removed {
+		info1, found := removes[path1]
+		if !found {
+			continue
+		}
+		for path2, info2 := range creates {
+			if sameFile(info1, info2) {
+				e := Event{
+					Op:		Move,
+					Path:	fmt.Sprintf("%s -> %s", path1, path2),
+					FileInfo: info1,
+					OldPath: path1,
+					NewPath: path2,
+					OldInfo: info1,
+				}
+				if filepath.Dir(path1) == filepath.Dir(path2) {
+					e.Op = Rename
+				}
+				w.trace(path1, e.Op, "detected: same file reappeared at %s", path2)
+				w.trace(path2, e.Op, "detected: same file as removed %s", path1)
+				delete(removes, path1)
+				delete(creates, path2)
+				w.moveTracked(path1, path2)
+				events = append(events, e)
+				if info1.IsDir() {
+					events = append(events, w.moveChildren(path1, path2, removes, creates)...)
+				}
+				break
+			}
+		}
+	}
+
+	for path, info := range creates {
+		w.trackFile(path, info)
+		w.watchSubdir(path, info)
+		w.trace(path, Create, "detected: new path")
+		events = append(events, Event{Op: Create, Path: path, FileInfo: info})
+		if e, found := w.escalation(path, nil, info); found {
+			events = append(events, e)
+		}
+		events = append(events, w.applyRules(path, nil, info)...)
+		pending = append(pending, w.matchResponses(path, nil, info)...)
+	}
+
+	for path, info := range removes {
+		w.untrackFile(path)
+		w.trace(path, Remove, "detected: path disappeared")
+		events = append(events, Event{Op: Remove, Path: path, FileInfo: info})
+	}
+	events = append(events, w.heldOpen(removes)...)
+	events = append(events, w.detectCompletion(files)...)
+	events = append(events, w.fifoEvents(files)...)
+	events = append(events, w.followEvents()...)
+	events = append(events, w.evict(files)...)
+	events = w.deferOpen(events, files)
+	return events, pending
+}
+
+func (w *Watcher) Wait() {
+	w.wg.Wait()
+}
+
+func (w *Watcher) Close() {
+	// 只用Step的时候也要停掉处理函数的worker
+	w.stopHandlers()
+	w.mu.Lock()
+	helper := w.helper
+	w.mu.Unlock()
+	if helper != nil {
+		helper.stop()
+	}
+	w.mu.Lock()
+	if !w.runnning {
+		w.mu.Unlock()
+		return
+	}
+	w.runnning = false
+	w.closeFIFOs()
+	w.closeNative()
+	w.files = make(map[string]os.FileInfo)
+	w.names = make(map[string]bool)
+	w.roots = make(map[string]RootStatus)
+	w.mu.Unlock()
+
+	// 阻塞在订阅者上的扫描需要先放开，才能收到关闭的通知
+	w.closeSubscriptions()
+	w.close <- struct{}{}
+}
+
+
+
+
+
@@ -0,0 +1,575 @@
+package watcher_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pythonsite/watcher"
+	"github.com/pythonsite/watcher/watchertest"
+)
+
+// 把Scan返回的事件格式化成 "OP 相对路径"，按字符串排序
+func scanOps(t *testing.T, w *watcher.Watcher, root string) []string {
+	t.Helper()
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range events {
+		if e.IsDir() && e.Op == watcher.Write {
+			// 目录里的条目变化时目录本身的Write
+			continue
+		}
+		path := e.Path
+		if e.NewPath != "" {
+			path = e.NewPath
+		}
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, e.Op.String()+" "+filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	return got
+}
+
+func expectOps(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestScanDetectsChanges(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"a": "a", "b": "b", "sub/c": "c"})
+	w := watcher.New()
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, scanOps(t, w, root))
+
+	watchertest.Apply(t, root,
+		watchertest.WriteFile("new", "x"),
+		watchertest.WriteFile("a", "changed"),
+		watchertest.Touch("a", time.Now().Add(time.Hour)),
+		watchertest.Remove("b"),
+	)
+	expectOps(t, scanOps(t, w, root), "CREATE new", "REMOVE b", "WRITE a")
+
+	watchertest.Apply(t, root, watchertest.Rename("sub/c", "sub/d"))
+	expectOps(t, scanOps(t, w, root), "RENAME sub/d")
+}
+
+func TestIgnoreAndFilterOps(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"keep": "a", "skip/x": "x"})
+	w := watcher.New()
+	if err := w.Ignore(filepath.Join(root, "skip")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := w.WatchedFiles()[filepath.Join(root, "skip", "x")]; found {
+		t.Fatal("ignored path is watched")
+	}
+
+	w.FilterOps(watcher.Remove)
+	watchertest.Apply(t, root, watchertest.WriteFile("skip/y", "y"), watchertest.WriteFile("other", "o"))
+	expectOps(t, scanOps(t, w, root))
+	watchertest.Apply(t, root, watchertest.Remove("keep"), watchertest.Remove("skip/x"))
+	expectOps(t, scanOps(t, w, root), "REMOVE keep")
+}
+
+func TestMiddlewareSharedWithDispatcher(t *testing.T) {
+	// 同一个中间件既能给Watcher用也能给Dispatcher用
+	tag := func(next watcher.HandlerFunc) watcher.HandlerFunc {
+		return func(e watcher.Event) {
+			if filepath.Base(e.Path) == "drop" {
+				return
+			}
+			e.Detail = "tagged"
+			next(e)
+		}
+	}
+
+	root := watchertest.TempTree(t, nil)
+	w := watcher.New()
+	w.Use(tag)
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.WriteFile("keep", "k"), watchertest.WriteFile("drop", "d"))
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, e := range events {
+		if e.Detail != "tagged" {
+			t.Errorf("event %v did not pass through the middleware", e)
+		}
+		kept = append(kept, filepath.Base(e.Path))
+	}
+	sort.Strings(kept)
+	expectOps(t, kept, filepath.Base(root), "keep")
+
+	d := watcher.NewDispatcher()
+	d.Use(tag)
+	var got []string
+	d.HandleAll(func(e watcher.Event) {
+		got = append(got, filepath.Base(e.Path)+" "+e.Detail)
+	})
+	d.Dispatch(watcher.Event{Op: watcher.Create, Path: filepath.Join(root, "drop")})
+	d.Dispatch(watcher.Event{Op: watcher.Create, Path: filepath.Join(root, "keep")})
+	expectOps(t, got, "keep tagged")
+}
+
+func TestRateThresholdSendsRateAlert(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w := watcher.New()
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetRateThreshold(root, 2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"), watchertest.WriteFile("b", "b"))
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 || events[0].Op != watcher.RateAlert || events[0].Path != root {
+		t.Fatalf("got %v, want a RateAlert for %s first", events, root)
+	}
+	for _, e := range events[1:] {
+		if e.Op == watcher.Alert || e.Op == watcher.RateAlert {
+			t.Errorf("unexpected %v", e)
+		}
+	}
+}
+
+func TestPanickingRootDoesNotStopOthers(t *testing.T) {
+	good := watchertest.TempTree(t, map[string]string{"a": "a"})
+	bad := watchertest.TempTree(t, map[string]string{"b": "b"})
+	w := watcher.New()
+	armed := false
+	w.AddFilterHook(func(info os.FileInfo, path string) error {
+		if armed && filepath.Dir(path) == bad {
+			panic("hook")
+		}
+		return nil
+	})
+	if err := w.Add(good); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(bad); err != nil {
+		t.Fatal(err)
+	}
+	armed = true
+	watchertest.Apply(t, good, watchertest.WriteFile("new", "x"))
+	watchertest.Apply(t, bad, watchertest.Remove("b"), watchertest.WriteFile("new", "x"))
+
+	events, err := w.Scan()
+	if !errors.Is(err, watcher.ErrRootPanic) {
+		t.Fatalf("got error %v, want ErrRootPanic", err)
+	}
+	var created []string
+	for _, e := range events {
+		if e.Op == watcher.Create {
+			created = append(created, e.Path)
+		}
+		if e.Op == watcher.Remove {
+			t.Errorf("failed root produced %v", e)
+		}
+	}
+	expectOps(t, created, filepath.Join(good, "new"))
+}
+
+func TestHungRootDoesNotStallOthers(t *testing.T) {
+	good := watchertest.TempTree(t, map[string]string{"a": "a"})
+	hung := watchertest.TempTree(t, map[string]string{"b": "b"})
+	w := watcher.New()
+	w.SetRootTimeout(100 * time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	armed := false
+	w.AddFilterHook(func(info os.FileInfo, path string) error {
+		if armed && filepath.Dir(path) == hung {
+			<-release
+		}
+		return nil
+	})
+	if err := w.Add(good); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(hung); err != nil {
+		t.Fatal(err)
+	}
+	armed = true
+
+	for i := 0; i < 2; i++ {
+		name := fmt.Sprintf("new%d", i)
+		watchertest.Apply(t, good, watchertest.WriteFile(name, "x"))
+		events, err := w.Scan()
+		if i == 0 && !errors.Is(err, watcher.ErrRootTimeout) {
+			t.Fatalf("got error %v, want ErrRootTimeout", err)
+		}
+		var created []string
+		for _, e := range events {
+			if e.Op == watcher.Create {
+				created = append(created, e.Path)
+			}
+			if e.Op == watcher.Remove {
+				t.Errorf("hung root produced %v", e)
+			}
+		}
+		expectOps(t, created, filepath.Join(good, name))
+	}
+}
+
+func TestAutoAddSkipsFiles(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"old/a": "a", "old.txt": "x"})
+	w := watcher.New()
+	if err := w.AutoAdd(filepath.Join(root, "*"), false); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.Mkdir("new"), watchertest.WriteFile("new/b", "b"), watchertest.WriteFile("new.txt", "y"))
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var added []string
+	for _, e := range events {
+		if e.Op == watcher.RootAdded {
+			added = append(added, filepath.Base(e.Path))
+		}
+	}
+	expectOps(t, added, "new")
+	for _, name := range []string{"old.txt", "new.txt"} {
+		if _, found := w.WatchedFiles()[filepath.Join(root, name)]; found {
+			t.Errorf("file %s matched by the pattern was added as a root", name)
+		}
+	}
+}
+
+func TestRateAlertBypassesFilters(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w := watcher.New()
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	w.FilterOps(watcher.Remove)
+	if err := w.FilterExpr(`op == "REMOVE"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetRateThreshold(root, 2, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"), watchertest.WriteFile("b", "b"))
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != watcher.RateAlert {
+		t.Fatalf("got %v, want only the RateAlert", events)
+	}
+}
+
+func TestAnomalyBypassesFilters(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w := watcher.New()
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	w.FilterOps(watcher.Remove)
+	w.SetMaxEvents(1)
+	w.DetectBursts(3, time.Minute)
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"), watchertest.WriteFile("b", "b"), watchertest.WriteFile("c", "c"))
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != watcher.Anomaly {
+		t.Fatalf("got %v, want only the Anomaly", events)
+	}
+}
+
+func TestManifestDirNotKeptInMemory(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"a": "a"})
+	dir := t.TempDir()
+	w := watcher.New()
+	if err := w.ManifestMode(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	go w.Start(10 * time.Millisecond)
+	defer w.Close()
+	w.Wait()
+	watchertest.Apply(t, root, watchertest.WriteFile("b", "b"))
+
+	var written []string
+	for deadline := time.Now().Add(2 * time.Second); len(written) == 0 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		written, _ = filepath.Glob(filepath.Join(dir, "manifest-*.json"))
+	}
+	if len(written) == 0 {
+		t.Fatal("no manifest written")
+	}
+	if m := w.Manifests(); m != nil {
+		t.Fatalf("got %d manifests in memory, want none", len(m))
+	}
+}
+
+func TestProtectDetectsUnchangedModTimeEdit(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"conf": "original"})
+	mtime := time.Now().Add(-time.Hour)
+	watchertest.Apply(t, root, watchertest.Touch("conf", mtime))
+	w := watcher.New()
+	if err := w.Protect(root); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, scanOps(t, w, root))
+
+	// 大小和修改时间都不变，只有校验和能发现
+	watchertest.Apply(t, root, watchertest.WriteFile("conf", "tampered"), watchertest.Touch("conf", mtime))
+	expectOps(t, scanOps(t, w, root), "ALERT conf")
+	// 同样的不一致不重复报告
+	expectOps(t, scanOps(t, w, root))
+
+	if err := w.AcceptBaseline(root); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, scanOps(t, w, root))
+}
+
+func TestSubscriptionWithoutReadingEvent(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	w := watcher.New()
+	w.FilterOps(watcher.Create)
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	s := w.Subscribe(10, watcher.BackpressureBlock)
+	go w.Start(10 * time.Millisecond)
+	defer w.Close()
+	w.Wait()
+
+	// 没有人读w.Event
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("f%d", i)
+		watchertest.Apply(t, root, watchertest.WriteFile(name, "x"))
+		select {
+		case e := <-s.Events():
+			if e.Op != watcher.Create || e.Path != filepath.Join(root, name) {
+				t.Fatalf("got %v, want CREATE %s", e, name)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("subscriber got no event for %s", name)
+		}
+	}
+}
+
+func TestHashChangeDetection(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"a": "original"})
+	w := watcher.New()
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetChangeDetection(watcher.Hash); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, scanOps(t, w, root))
+
+	// 只改修改时间，内容没变
+	watchertest.Apply(t, root, watchertest.Touch("a", time.Now().Add(time.Hour)))
+	expectOps(t, scanOps(t, w, root))
+
+	// 内容变了，修改时间保留原样
+	info, err := os.Stat(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "tampered"), watchertest.Touch("a", info.ModTime()))
+	expectOps(t, scanOps(t, w, root), "WRITE a")
+}
+
+func TestDebounceCoalesces(t *testing.T) {
+	root := watchertest.TempTree(t, nil)
+	clk := watchertest.NewFakeClock(time.Unix(0, 0))
+	w := watcher.New()
+	w.SetClock(clk)
+	w.SetDebounce(5 * time.Second)
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	expectOps(t, scanOps(t, w, root))
+
+	// Create -> Write -> Chmod 合并成一个Create
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "a"))
+	expectOps(t, scanOps(t, w, root))
+	clk.Advance(time.Second)
+	watchertest.Apply(t, root, watchertest.WriteFile("a", "changed"), watchertest.Touch("a", time.Now().Add(time.Hour)))
+	expectOps(t, scanOps(t, w, root))
+	clk.Advance(time.Second)
+	watchertest.Apply(t, root, watchertest.Chmod("a", 0600))
+	expectOps(t, scanOps(t, w, root))
+	clk.Advance(5 * time.Second)
+	expectOps(t, scanOps(t, w, root), "CREATE a")
+
+	// Create -> Remove 不发送事件
+	watchertest.Apply(t, root, watchertest.WriteFile("b", "b"))
+	expectOps(t, scanOps(t, w, root))
+	clk.Advance(time.Second)
+	watchertest.Apply(t, root, watchertest.Remove("b"))
+	expectOps(t, scanOps(t, w, root))
+	clk.Advance(10 * time.Second)
+	expectOps(t, scanOps(t, w, root))
+}
+
+func TestFollowSymlinksCycleTerminates(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"d/f": "f"})
+	for link, target := range map[string]string{"d/up": root, "d/self": ".", "e": "d"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+	w := watcher.New()
+	w.FollowSymlinks(true)
+	done := make(chan error, 1)
+	go func() { done <- w.AddRecursive(root) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddRecursive did not terminate on a symlink cycle")
+	}
+
+	files := w.WatchedFiles()
+	for _, rel := range []string{"d/f", "d/up", "d/self", "e"} {
+		if _, found := files[filepath.Join(root, rel)]; !found {
+			t.Errorf("%s not watched", rel)
+		}
+	}
+	for _, rel := range []string{"d/up/d", "d/self/f", "e/up/d", "e/self/f"} {
+		if _, found := files[filepath.Join(root, rel)]; found {
+			t.Errorf("descended into %s", rel)
+		}
+	}
+	expectOps(t, scanOps(t, w, root))
+}
+
+func TestIncrementalScan(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"sub/a": "a", "other/b": "b"})
+	w := watcher.New()
+	w.SetIncremental(3)
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// sub的修改时间变了会被重新读取；other没有变化，里面就地修改的文件要等完整扫描
+	watchertest.Apply(t, root, watchertest.WriteFile("sub/new", "x"), watchertest.Touch("other/b", time.Now().Add(time.Hour)))
+	expectOps(t, scanOps(t, w, root), "CREATE sub/new")
+	expectOps(t, scanOps(t, w, root))
+	expectOps(t, scanOps(t, w, root), "WRITE other/b")
+}
+
+func TestDirectoryRenameMovesChildren(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"dir/a": "a", "dir/sub/b": "b"})
+	w := watcher.New()
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root, watchertest.Rename("dir", "moved"))
+	expectOps(t, scanOps(t, w, root),
+		"CHILD_MOVED moved/a", "CHILD_MOVED moved/sub", "CHILD_MOVED moved/sub/b", "RENAME moved")
+
+	if _, found := w.WatchedFiles()[filepath.Join(root, "moved", "sub", "b")]; !found {
+		t.Error("moved child not tracked at its new path")
+	}
+}
+
+func TestTransactionEndCountsSentEvents(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"b": "b"})
+	clk := watchertest.NewFakeClock(time.Unix(0, 0))
+	w := watcher.New()
+	w.SetClock(clk)
+	w.GroupTransactions(5 * time.Second)
+	w.FilterOps(watcher.Create)
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root,
+		watchertest.WriteFile("a", "a"),
+		watchertest.WriteFile("b", "changed"),
+		watchertest.Touch("b", time.Now().Add(time.Hour)),
+	)
+	events, err := w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != watcher.Create || events[0].Transaction == "" {
+		t.Fatalf("got %v, want one CREATE in a transaction", events)
+	}
+	id := events[0].Transaction
+
+	clk.Advance(10 * time.Second)
+	events, err = w.Scan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 被FilterOps过滤掉的Write不算在事务里
+	if len(events) != 1 || events[0].Op != watcher.TransactionEnd || events[0].Transaction != id || !strings.HasPrefix(events[0].Detail, "1 events") {
+		t.Fatalf("got %v, want TRANSACTION_END with 1 event", events)
+	}
+}
+
+func TestFilterContentChecksAppendedData(t *testing.T) {
+	root := watchertest.TempTree(t, map[string]string{"log": "ERROR old\n"})
+	w := watcher.New()
+	if err := w.FilterContent(regexp.MustCompile("ERROR"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(root); err != nil {
+		t.Fatal(err)
+	}
+	// 文件开头原有的内容匹配不算
+	watchertest.Apply(t, root, watchertest.WriteFile("log", "ERROR old\ninfo\n"))
+	expectOps(t, scanOps(t, w, root))
+	watchertest.Apply(t, root, watchertest.WriteFile("log", "ERROR old\ninfo\nERROR new\n"))
+	expectOps(t, scanOps(t, w, root), "WRITE log")
+}
+
+func TestEscalationDetectsDangerousModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are emulated on windows")
+	}
+	root := watchertest.TempTree(t, map[string]string{"a": "a", "b": "b"})
+	watchertest.Apply(t, root, watchertest.Mkdir("d"), watchertest.Chmod("d", os.ModeSticky|0777))
+	w := watcher.New()
+	w.DetectEscalation(true)
+	if err := w.AddRecursive(root); err != nil {
+		t.Fatal(err)
+	}
+	watchertest.Apply(t, root,
+		watchertest.Chmod("a", 0666),
+		watchertest.Chmod("b", 0600),
+		watchertest.Chmod("d", 0777),
+	)
+	expectOps(t, scanOps(t, w, root), "CHMOD a", "CHMOD b", "CHMOD d", "ESCALATION a", "ESCALATION d")
+}
@@ -0,0 +1,90 @@
+package watchertest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pythonsite/watcher"
+)
+
+// FakeNotifier 是watcher.Notifier的假实现，不做任何轮询，
+// 测试通过Send和SendError把事件和错误推给被测代码，通过Added等字段检查被测代码的调用
+type FakeNotifier struct {
+	mu      sync.Mutex
+	Added   []string // Add和AddRecursive添加过的路径，按调用顺序
+	Removed []string // Remove和RemoveRecursive删除过的路径，按调用顺序
+	Started bool
+	Closed  bool
+
+	events chan watcher.Event
+	errors chan error
+}
+
+var _ watcher.Notifier = (*FakeNotifier)(nil)
+
+// NewFakeNotifier 创建一个FakeNotifier
+func NewFakeNotifier() *FakeNotifier {
+	return &FakeNotifier{
+		events: make(chan watcher.Event),
+		errors: make(chan error),
+	}
+}
+
+func (n *FakeNotifier) Add(name string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Added = append(n.Added, name)
+	return nil
+}
+
+func (n *FakeNotifier) AddRecursive(name string) error {
+	return n.Add(name)
+}
+
+func (n *FakeNotifier) Remove(name string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Removed = append(n.Removed, name)
+	return nil
+}
+
+func (n *FakeNotifier) RemoveRecursive(name string) error {
+	return n.Remove(name)
+}
+
+func (n *FakeNotifier) Start(d time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if d < time.Nanosecond {
+		return watcher.ErrDurationTooShort
+	}
+	if n.Started {
+		return watcher.ErrWatcherRunning
+	}
+	n.Started = true
+	return nil
+}
+
+func (n *FakeNotifier) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.Closed = true
+}
+
+func (n *FakeNotifier) Events() <-chan watcher.Event {
+	return n.events
+}
+
+func (n *FakeNotifier) Errors() <-chan error {
+	return n.errors
+}
+
+// Send 把事件发给正在读取Events()的被测代码，会阻塞到事件被读走
+func (n *FakeNotifier) Send(event watcher.Event) {
+	n.events <- event
+}
+
+// SendError 把错误发给正在读取Errors()的被测代码，会阻塞到错误被读走
+func (n *FakeNotifier) SendError(err error) {
+	n.errors <- err
+}
@@ -0,0 +1,202 @@
+// watchertest 提供测试watcher集成代码的辅助函数：
+// 创建临时文件树、按脚本修改文件、在超时时间内断言收到的事件，以及可以手动推进的时钟
+package watchertest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pythonsite/watcher"
+)
+
+// TempTree 在一个临时目录里创建文件树并返回根目录，测试结束后自动删除
+// files的key是以"/"分隔的相对路径，以"/"结尾的表示目录，value是文件内容
+func TempTree(t testing.TB, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for rel, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		if strings.HasSuffix(rel, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// Mutation 是对文件树的一步修改，root是文件树的根目录
+type Mutation func(root string) error
+
+func abs(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+// WriteFile 写入文件，文件不存在时创建
+func WriteFile(rel, content string) Mutation {
+	return func(root string) error {
+		return os.WriteFile(abs(root, rel), []byte(content), 0644)
+	}
+}
+
+// Mkdir 创建目录
+func Mkdir(rel string) Mutation {
+	return func(root string) error {
+		return os.MkdirAll(abs(root, rel), 0755)
+	}
+}
+
+// Remove 递归删除文件或目录
+func Remove(rel string) Mutation {
+	return func(root string) error {
+		return os.RemoveAll(abs(root, rel))
+	}
+}
+
+// Rename 重命名或者移动文件
+func Rename(from, to string) Mutation {
+	return func(root string) error {
+		return os.Rename(abs(root, from), abs(root, to))
+	}
+}
+
+// Chmod 修改文件权限
+func Chmod(rel string, mode os.FileMode) Mutation {
+	return func(root string) error {
+		return os.Chmod(abs(root, rel), mode)
+	}
+}
+
+// Chown 修改文件的属主和属组，通常需要root权限，Windows上不支持
+func Chown(rel string, uid, gid int) Mutation {
+	return func(root string) error {
+		return os.Chown(abs(root, rel), uid, gid)
+	}
+}
+
+// Touch 把文件的访问和修改时间设置成t，用来在修改时间精度较低的文件系统上确保产生Write
+func Touch(rel string, t time.Time) Mutation {
+	return func(root string) error {
+		return os.Chtimes(abs(root, rel), t, t)
+	}
+}
+
+// Apply 依次执行修改，任何一步失败都会终止测试
+func Apply(t testing.TB, root string, mutations ...Mutation) {
+	t.Helper()
+
+	for _, m := range mutations {
+		if err := m(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Start 在后台启动w并等待轮询开始，测试结束的时候关闭w
+func Start(t testing.TB, w *watcher.Watcher, d time.Duration) {
+	t.Helper()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- w.Start(d)
+	}()
+	go func() {
+		w.Wait()
+		errc <- nil
+	}()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		done := make(chan struct{})
+		go func() {
+			w.Close()
+			close(done)
+		}()
+		// 关闭的时候轮询可能正阻塞在发送事件或错误上
+		for {
+			select {
+			case <-done:
+				return
+			case <-w.Event:
+			case <-w.Error:
+			}
+		}
+	})
+}
+
+// Expect 是一个期望收到的事件，Path是相对于根目录、以"/"分隔的路径，
+// Rename和Move事件的Path写成 "旧路径 -> 新路径"
+type Expect struct {
+	Op   watcher.Op
+	Path string
+}
+
+// 把事件的路径转换成相对于root的路径
+func relPath(root, path string) string {
+	prefix := root + string(filepath.Separator)
+	path = strings.ReplaceAll(path, prefix, "")
+	if path == root {
+		path = "."
+	}
+	return filepath.ToSlash(path)
+}
+
+// ExpectEvents 在timeout内从w.Event读取事件，直到收到所有期望的事件为止
+// 同一次扫描里事件的顺序是不确定的，所以不要求顺序；没有期望的事件(比如父目录的Write)会被忽略，
+// 超时或者从w.Error收到错误都会终止测试
+func ExpectEvents(t testing.TB, w *watcher.Watcher, root string, timeout time.Duration, want ...Expect) {
+	t.Helper()
+
+	pending := make(map[Expect]int)
+	for _, e := range want {
+		pending[e]++
+	}
+	var got []string
+	deadline := time.After(timeout)
+	for len(pending) > 0 {
+		select {
+		case event := <-w.Event:
+			e := Expect{Op: event.Op, Path: relPath(root, event.Path)}
+			got = append(got, e.Op.String()+" "+e.Path)
+			if pending[e] > 0 {
+				pending[e]--
+				if pending[e] == 0 {
+					delete(pending, e)
+				}
+			}
+		case err := <-w.Error:
+			t.Fatalf("unexpected error: %v", err)
+		case <-deadline:
+			var missing []string
+			for e := range pending {
+				missing = append(missing, e.Op.String()+" "+e.Path)
+			}
+			t.Fatalf("timed out after %s waiting for %v, got %v", timeout, missing, got)
+		}
+	}
+}
+
+// ExpectNoEvents 断言在d时间内没有收到任何事件
+func ExpectNoEvents(t testing.TB, w *watcher.Watcher, root string, d time.Duration) {
+	t.Helper()
+
+	select {
+	case event := <-w.Event:
+		t.Fatalf("unexpected event %s %s", event.Op, relPath(root, event.Path))
+	case err := <-w.Error:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,17 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// 返回当前用户最多可以使用的inotify watch数，读取失败时返回0
+func watchLimit() int {
+	data, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return n
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package watcher
+
+func watchLimit() int {
+	return 0
+}